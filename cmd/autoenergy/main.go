@@ -8,7 +8,9 @@ import (
 	"os/signal"
 	"syscall"
 
+	"github.com/jameshartig/autoenergy/pkg/carbon"
 	"github.com/jameshartig/autoenergy/pkg/ess"
+	"github.com/jameshartig/autoenergy/pkg/forecast"
 	"github.com/jameshartig/autoenergy/pkg/server"
 	"github.com/jameshartig/autoenergy/pkg/storage"
 	"github.com/jameshartig/autoenergy/pkg/utility"
@@ -22,9 +24,11 @@ func main() {
 	u := utility.Configured()
 	e := ess.Configured()
 	s := storage.Configured()
+	f := forecast.Configured()
+	c := carbon.Configured()
 
 	// init server
-	srv := server.Configured(u, e, s)
+	srv := server.Configured(u, e, s, f, c)
 
 	// parse flags
 	lflag.Configure()
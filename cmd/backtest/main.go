@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/backtest"
+	"github.com/jameshartig/autoenergy/pkg/controller"
+	"github.com/jameshartig/autoenergy/pkg/storage"
+	"github.com/jameshartig/autoenergy/pkg/types"
+
+	"github.com/levenlabs/go-lflag"
+)
+
+func main() {
+	s := storage.Configured()
+
+	start := lflag.String("start", "", "First day to simulate (YYYY-MM-DD, defaults to --days ago)")
+	days := lflag.Int("days", 14, "Number of days to simulate when --start isn't set")
+	end := lflag.String("end", "", "Day to stop simulating at, exclusive (YYYY-MM-DD, defaults to today)")
+	timezone := lflag.String("timezone", "America/Chicago", "Time zone the days are in")
+	strategyName := lflag.String("strategy", controller.DefaultStrategy, "Strategy to simulate")
+	capacity := lflag.String("battery-capacity-kwh", "", "Capacity of the simulated battery in kWh")
+	chargeKW := lflag.String("battery-charge-kw", "0", "Maximum charge rate of the simulated battery in kW (0 to assume 3 hours to fill)")
+	dischargeKW := lflag.String("battery-discharge-kw", "0", "Maximum discharge rate of the simulated battery in kW (0 for no limit)")
+	startSOC := lflag.String("battery-start-soc", "50", "State of charge (0-100) of the simulated battery at the start")
+	lookback := lflag.Duration("load-history-lookback", 28*24*time.Hour, "how much energy history to use when modeling home load")
+	priceLookback := lflag.Duration("price-forecast-lookback", 28*24*time.Hour, "how much price history to use when forecasting future prices for the strategy")
+	perfectPrices := lflag.Bool("perfect-price-forecast", false, "Give the strategy the actual future prices instead of a forecast")
+	format := lflag.String("format", "table", "Output format (table or json)")
+	tune := lflag.Bool("tune", false, "Search for the settings with the lowest cost instead of simulating the current settings")
+	tuneRandom := lflag.Int("tune-random", 0, "Number of random candidates to try instead of every combination (0 for a grid search)")
+	tuneAlwaysCharge := lflag.String("tune-always-charge-under", "0:0.05:0.01", "Always charge under prices to try as min:max:step ($/kWh)")
+	tuneMinArbitrage := lflag.String("tune-min-arbitrage-difference", "0:0.05:0.01", "Minimum arbitrage differences to try as min:max:step ($/kWh)")
+	tuneLoadOutlier := lflag.String("tune-load-outlier-std-devs", "2:5:1.5", "Usage outlier thresholds to try as min:max:step (robust standard deviations)")
+	tuneApply := lflag.Bool("tune-apply", false, "Save the best settings if they beat the current settings")
+
+	lflag.Configure()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	defer func() {
+		if err := s.Close(); err != nil {
+			slog.Error("failed to close storage", "error", err)
+		}
+	}()
+
+	if err := run(ctx, s, options{
+		start:         *start,
+		days:          *days,
+		end:           *end,
+		timezone:      *timezone,
+		strategy:      *strategyName,
+		capacity:      *capacity,
+		chargeKW:      *chargeKW,
+		dischargeKW:   *dischargeKW,
+		startSOC:      *startSOC,
+		lookback:      *lookback,
+		priceLookback: *priceLookback,
+		perfectPrices: *perfectPrices,
+		outputFormat:  *format,
+		tune:          *tune,
+		tuneRandom:    *tuneRandom,
+		tuneAlways:    *tuneAlwaysCharge,
+		tuneMinArb:    *tuneMinArbitrage,
+		tuneOutlier:   *tuneLoadOutlier,
+		tuneApply:     *tuneApply,
+		out:           os.Stdout,
+	}); err != nil {
+		slog.Error("backtest failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+type options struct {
+	start       string
+	days        int
+	end         string
+	timezone    string
+	strategy    string
+	capacity    string
+	chargeKW    string
+	dischargeKW string
+	startSOC    string
+	lookback    time.Duration
+	// priceLookback is how much price history forecasts future prices
+	priceLookback time.Duration
+	perfectPrices bool
+	outputFormat  string
+	tune          bool
+	tuneRandom    int
+	tuneAlways    string
+	tuneMinArb    string
+	tuneOutlier   string
+	tuneApply     bool
+	// out is where the results are written
+	out io.Writer
+}
+
+func run(ctx context.Context, s storage.Provider, opts options) error {
+	loc, err := time.LoadLocation(opts.timezone)
+	if err != nil {
+		return fmt.Errorf("invalid timezone: %w", err)
+	}
+	end := time.Now().In(loc).Truncate(time.Hour)
+	if opts.end != "" {
+		if end, err = time.ParseInLocation(time.DateOnly, opts.end, loc); err != nil {
+			return fmt.Errorf("invalid end: %w", err)
+		}
+	}
+	y, m, d := end.AddDate(0, 0, -opts.days).Date()
+	start := time.Date(y, m, d, 0, 0, 0, 0, loc)
+	if opts.start != "" {
+		if start, err = time.ParseInLocation(time.DateOnly, opts.start, loc); err != nil {
+			return fmt.Errorf("invalid start: %w", err)
+		}
+	}
+
+	var battery backtest.Battery
+	for _, v := range []struct {
+		name  string
+		value string
+		dest  *float64
+	}{
+		{"battery-capacity-kwh", opts.capacity, &battery.CapacityKWH},
+		{"battery-charge-kw", opts.chargeKW, &battery.MaxChargeKW},
+		{"battery-discharge-kw", opts.dischargeKW, &battery.MaxDischargeKW},
+		{"battery-start-soc", opts.startSOC, &battery.StartSOC},
+	} {
+		if *v.dest, err = strconv.ParseFloat(v.value, 64); err != nil {
+			return fmt.Errorf("invalid %s (%s): %w", v.name, v.value, err)
+		}
+	}
+
+	strategy, err := controller.NewStrategy(opts.strategy)
+	if err != nil {
+		return err
+	}
+
+	settings, err := s.GetSettings(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get settings: %w", err)
+	}
+	prices, err := s.GetPriceHistory(ctx, start.Add(-opts.priceLookback), end.Add(settings.PlanningHorizon()))
+	if err != nil {
+		return fmt.Errorf("failed to get prices: %w", err)
+	}
+	history, err := s.GetEnergyHistory(ctx, start.Add(-opts.lookback), end)
+	if err != nil {
+		return fmt.Errorf("failed to get energy history: %w", err)
+	}
+
+	cfg := backtest.Config{
+		Start:                 start,
+		End:                   end,
+		Settings:              settings,
+		Battery:               battery,
+		LoadHistoryLookback:   opts.lookback,
+		PriceForecastLookback: opts.priceLookback,
+		PerfectPriceForecast:  opts.perfectPrices,
+	}
+	if opts.tune {
+		return runTune(ctx, s, opts, prices, history, cfg)
+	}
+
+	res, err := backtest.Run(ctx, strategy, prices, history, cfg)
+	if err != nil {
+		return err
+	}
+
+	switch opts.outputFormat {
+	case "json":
+		enc := json.NewEncoder(opts.out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res)
+	case "table":
+		return writeTable(opts.out, res)
+	default:
+		return fmt.Errorf("unknown format: %s", opts.outputFormat)
+	}
+}
+
+// runTune backtests candidate settings around the current ones, prints them
+// ranked by net cost and optionally saves the best ones.
+func runTune(ctx context.Context, s storage.Provider, opts options, prices []types.Price, history []types.EnergyStats, cfg backtest.Config) error {
+	var space backtest.TuneSpace
+	var err error
+	if space.AlwaysChargeUnderDollarsPerKWH, err = backtest.ParseTuneRange(opts.tuneAlways); err != nil {
+		return fmt.Errorf("invalid tune-always-charge-under: %w", err)
+	}
+	if space.MinArbitrageDifferenceDollarsPerKWH, err = backtest.ParseTuneRange(opts.tuneMinArb); err != nil {
+		return fmt.Errorf("invalid tune-min-arbitrage-difference: %w", err)
+	}
+	if space.LoadOutlierStdDevs, err = backtest.ParseTuneRange(opts.tuneOutlier); err != nil {
+		return fmt.Errorf("invalid tune-load-outlier-std-devs: %w", err)
+	}
+
+	current := cfg.Settings
+	// always include the current settings so we know if anything beats them
+	candidates := []types.Settings{current}
+	if opts.tuneRandom > 0 {
+		rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+		candidates = append(candidates, backtest.RandomCandidates(current, space, opts.tuneRandom, rng)...)
+	} else {
+		candidates = append(candidates, backtest.GridCandidates(current, space)...)
+	}
+	slog.InfoContext(ctx, "tuning settings", slog.Int("candidates", len(candidates)))
+
+	ranked, err := backtest.Tune(ctx, func() (controller.Strategy, error) {
+		return controller.NewStrategy(opts.strategy)
+	}, prices, history, cfg, candidates)
+	if err != nil {
+		return err
+	}
+
+	switch opts.outputFormat {
+	case "json":
+		enc := json.NewEncoder(opts.out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(ranked); err != nil {
+			return err
+		}
+	case "table":
+		w := tabwriter.NewWriter(opts.out, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(w, "Rank\tAlways Charge Under\tMin Arbitrage\tOutlier Std Devs\tNet Cost\tSimulated\tvs No Battery\tBattery kWh\t")
+		for i, c := range ranked {
+			fmt.Fprintf(w, "%d\t%.3f\t%.3f\t%.1f\t%.2f\t%.2f\t%.2f\t%.1f\t\n",
+				i+1,
+				c.Settings.AlwaysChargeUnderDollarsPerKWH,
+				c.Settings.MinArbitrageDifferenceDollarsPerKWH,
+				c.Settings.LoadOutlierDeviations(),
+				c.NetCost,
+				c.Total.SimulatedCost,
+				c.Total.SavingsVsNoBattery,
+				c.Total.BatteryUsedKWH,
+			)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown format: %s", opts.outputFormat)
+	}
+
+	best := ranked[0]
+	if best.Settings.AlwaysChargeUnderDollarsPerKWH == current.AlwaysChargeUnderDollarsPerKWH &&
+		best.Settings.MinArbitrageDifferenceDollarsPerKWH == current.MinArbitrageDifferenceDollarsPerKWH &&
+		best.Settings.LoadOutlierDeviations() == current.LoadOutlierDeviations() {
+		slog.InfoContext(ctx, "current settings are already the best")
+		return nil
+	}
+	slog.InfoContext(
+		ctx,
+		"proposed settings",
+		slog.Float64("alwaysChargeUnderDollarsPerKWH", best.Settings.AlwaysChargeUnderDollarsPerKWH),
+		slog.Float64("minArbitrageDifferenceDollarsPerKWH", best.Settings.MinArbitrageDifferenceDollarsPerKWH),
+		slog.Float64("loadOutlierStdDevs", best.Settings.LoadOutlierDeviations()),
+		slog.Float64("netCost", best.NetCost),
+	)
+	if !opts.tuneApply {
+		return nil
+	}
+	// re-read the settings so we only change the tuned ones
+	latest, err := s.GetSettings(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get settings: %w", err)
+	}
+	latest.AlwaysChargeUnderDollarsPerKWH = best.Settings.AlwaysChargeUnderDollarsPerKWH
+	latest.MinArbitrageDifferenceDollarsPerKWH = best.Settings.MinArbitrageDifferenceDollarsPerKWH
+	latest.LoadOutlierStdDevs = best.Settings.LoadOutlierStdDevs
+	if err := s.SetSettings(ctx, latest); err != nil {
+		return fmt.Errorf("failed to save settings: %w", err)
+	}
+	slog.InfoContext(ctx, "applied tuned settings")
+	return nil
+}
+
+// writeTable prints the per-day costs and totals to out.
+func writeTable(out io.Writer, res backtest.Result) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "Date\tHours\tSimulated\tActual\tNo Battery\tvs Actual\tvs No Battery\tBattery kWh\tGrid Charge kWh\t")
+	for _, day := range append(res.Days, res.Total) {
+		fmt.Fprintf(w, "%s\t%d\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.1f\t%.1f\t\n",
+			day.Date,
+			day.Hours,
+			day.SimulatedCost,
+			day.ActualCost,
+			day.NoBatteryCost,
+			day.SavingsVsActual,
+			day.SavingsVsNoBattery,
+			day.BatteryUsedKWH,
+			day.GridChargeKWH,
+		)
+	}
+	return w.Flush()
+}
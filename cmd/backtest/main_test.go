@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/backtest"
+	"github.com/jameshartig/autoenergy/pkg/controller"
+	"github.com/jameshartig/autoenergy/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunFixture(t *testing.T) {
+	s, err := storage.NewFileProvider("testdata/fixture.json")
+	require.NoError(t, err)
+
+	opts := options{
+		start:         "2026-09-04",
+		end:           "2026-09-06",
+		timezone:      "America/Chicago",
+		strategy:      controller.DefaultStrategy,
+		capacity:      "13.5",
+		chargeKW:      "5",
+		dischargeKW:   "5",
+		startSOC:      "50",
+		lookback:      72 * time.Hour,
+		priceLookback: 72 * time.Hour,
+		outputFormat:  "json",
+	}
+
+	t.Run("Backtest", func(t *testing.T) {
+		var out bytes.Buffer
+		opts := opts
+		opts.out = &out
+		require.NoError(t, run(context.Background(), s, opts))
+
+		var res backtest.Result
+		require.NoError(t, json.Unmarshal(out.Bytes(), &res))
+		require.Len(t, res.Days, 2)
+		assert.Equal(t, "2026-09-04", res.Days[0].Date)
+		assert.Equal(t, 48, res.Total.Hours)
+		// cheap nights and expensive evenings leave room to save with a battery
+		assert.Greater(t, res.Total.SavingsVsNoBattery, 0.0)
+		assert.Greater(t, res.Total.BatteryUsedKWH, 0.0)
+		assert.False(t, res.PerfectPriceForecast)
+	})
+
+	t.Run("Perfect Price Forecast", func(t *testing.T) {
+		var out bytes.Buffer
+		opts := opts
+		opts.out = &out
+		opts.perfectPrices = true
+		require.NoError(t, run(context.Background(), s, opts))
+
+		var res backtest.Result
+		require.NoError(t, json.Unmarshal(out.Bytes(), &res))
+		assert.True(t, res.PerfectPriceForecast)
+		assert.Equal(t, 48, res.Total.Hours)
+		assert.Greater(t, res.Total.SavingsVsNoBattery, 0.0)
+	})
+
+	t.Run("Tune", func(t *testing.T) {
+		var out bytes.Buffer
+		opts := opts
+		opts.out = &out
+		opts.tune = true
+		opts.tuneAlways = "0:0.04:0.04"
+		opts.tuneMinArb = "0:0.03:0.03"
+		opts.tuneOutlier = "2:5:3"
+		require.NoError(t, run(context.Background(), s, opts))
+
+		var ranked []backtest.Candidate
+		require.NoError(t, json.Unmarshal(out.Bytes(), &ranked))
+		// the current settings and every combination
+		require.Len(t, ranked, 9)
+		var outliers []float64
+		for _, c := range ranked {
+			outliers = append(outliers, c.Settings.LoadOutlierStdDevs)
+		}
+		assert.Contains(t, outliers, 2.0)
+		assert.Contains(t, outliers, 5.0)
+	})
+}
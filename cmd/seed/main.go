@@ -138,7 +138,7 @@ func main() {
 		case types.BatteryModeChargeAny, types.BatteryModeChargeSolar:
 			batKW = -3.0 // charging
 			currentSOC += 15.0
-		case types.BatteryModeLoad:
+		case types.BatteryModeLoad, types.BatteryModeExport:
 			batKW = 3.0 // discharging
 			currentSOC -= 15.0
 		case types.BatteryModeStandby, types.BatteryModeNoChange:
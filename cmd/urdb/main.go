@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+	"github.com/jameshartig/autoenergy/pkg/utility"
+
+	"github.com/levenlabs/go-lflag"
+)
+
+// output is the part of the settings the rate fills in.
+type output struct {
+	TOUSchedule types.TOUSchedule `json:"touSchedule"`
+	Tariff      types.Tariff      `json:"tariff"`
+}
+
+func main() {
+	file := lflag.String("file", "", "Path to an OpenEI URDB rate JSON")
+	label := lflag.String("label", "", "Label of the OpenEI URDB rate to fetch when --file isn't set")
+	apiURL := lflag.String("openei-api-url", "https://api.openei.org", "URL for the OpenEI API")
+	apiKey := lflag.String("openei-api-key", "", "API Key for the OpenEI API")
+	timezone := lflag.String("timezone", "", "Timezone of the rate's hours (required)")
+
+	lflag.Configure()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	if err := run(ctx, *file, *label, *apiURL, *apiKey, *timezone); err != nil {
+		slog.Error("urdb conversion failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+// run converts the rate and prints the settings for it.
+func run(ctx context.Context, file, label, apiURL, apiKey, timezone string) error {
+	if timezone == "" {
+		return fmt.Errorf("--timezone is required")
+	}
+	var rate utility.URDBRate
+	var err error
+	switch {
+	case file != "":
+		rate, err = utility.LoadURDBFile(file)
+	case label != "":
+		rate, err = utility.FetchURDB(ctx, &http.Client{Timeout: 10 * time.Second}, apiURL, apiKey, label)
+	default:
+		return fmt.Errorf("--file or --label is required")
+	}
+	if err != nil {
+		return err
+	}
+
+	schedule, err := rate.Schedule(timezone)
+	if err != nil {
+		return fmt.Errorf("failed to convert rate: %w", err)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(output{
+		TOUSchedule: schedule,
+		Tariff:      types.Tariff{MonthlyFixedDollars: rate.MonthlyFixedDollars()},
+	})
+}
@@ -0,0 +1,325 @@
+// Package backtest replays stored price and energy history through a
+// controller strategy to estimate what it would have cost.
+package backtest
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/controller"
+	"github.com/jameshartig/autoenergy/pkg/types"
+	"github.com/jameshartig/autoenergy/pkg/utility"
+)
+
+// Battery describes the simulated battery.
+type Battery struct {
+	CapacityKWH    float64 `json:"capacityKWH"`
+	MaxChargeKW    float64 `json:"maxChargeKW"`
+	MaxDischargeKW float64 `json:"maxDischargeKW"`
+	// StartSOC is the state of charge (0-100) at the start of the backtest
+	StartSOC float64 `json:"startSOC"`
+}
+
+// Config configures a backtest.
+type Config struct {
+	Start    time.Time
+	End      time.Time
+	Settings types.Settings
+	Battery  Battery
+	// LoadHistoryLookback is how much energy history before each hour is given
+	// to the strategy.
+	LoadHistoryLookback time.Duration
+	// PriceForecastLookback is how much price history before each hour is
+	// used to forecast the future prices given to the strategy, like the
+	// server does for hours without day-ahead prices.
+	PriceForecastLookback time.Duration
+	// PerfectPriceForecast gives the strategy the actual future prices
+	// instead of a forecast to show the most the strategy could save.
+	PerfectPriceForecast bool
+}
+
+// Day is the simulated, actual and no battery cost over a day. Costs use the
+// all-in import price and subtract export credits.
+type Day struct {
+	Date          string  `json:"date"`
+	Hours         int     `json:"hours"`
+	SimulatedCost float64 `json:"simulatedCost"`
+	ActualCost    float64 `json:"actualCost"`
+	NoBatteryCost float64 `json:"noBatteryCost"`
+	// SavingsVsActual is ActualCost - SimulatedCost
+	SavingsVsActual float64 `json:"savingsVsActual"`
+	// SavingsVsNoBattery is NoBatteryCost - SimulatedCost
+	SavingsVsNoBattery float64 `json:"savingsVsNoBattery"`
+	GridImportKWH      float64 `json:"gridImportKWH"`
+	GridExportKWH      float64 `json:"gridExportKWH"`
+	BatteryUsedKWH     float64 `json:"batteryUsedKWH"`
+	GridChargeKWH      float64 `json:"gridChargeKWH"`
+}
+
+// add accumulates o into d.
+func (d *Day) add(o Day) {
+	d.Hours += o.Hours
+	d.SimulatedCost += o.SimulatedCost
+	d.ActualCost += o.ActualCost
+	d.NoBatteryCost += o.NoBatteryCost
+	d.SavingsVsActual += o.SavingsVsActual
+	d.SavingsVsNoBattery += o.SavingsVsNoBattery
+	d.GridImportKWH += o.GridImportKWH
+	d.GridExportKWH += o.GridExportKWH
+	d.BatteryUsedKWH += o.BatteryUsedKWH
+	d.GridChargeKWH += o.GridChargeKWH
+}
+
+// Hour is a single simulated hour.
+type Hour struct {
+	TSHourStart   time.Time         `json:"tsHourStart"`
+	BatteryMode   types.BatteryMode `json:"batteryMode"`
+	Description   string            `json:"description"`
+	StartSOC      float64           `json:"startSOC"`
+	EndSOC        float64           `json:"endSOC"`
+	DollarsPerKWH float64           `json:"dollarsPerKWH"`
+	SimulatedCost float64           `json:"simulatedCost"`
+	ActualCost    float64           `json:"actualCost"`
+	NoBatteryCost float64           `json:"noBatteryCost"`
+}
+
+// Result is the outcome of a backtest.
+type Result struct {
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Battery Battery   `json:"battery"`
+	// PerfectPriceForecast is true if the strategy saw the actual future
+	// prices.
+	PerfectPriceForecast bool   `json:"perfectPriceForecast"`
+	Total                Day    `json:"total"`
+	Days                 []Day  `json:"days"`
+	Hours                []Hour `json:"hours"`
+}
+
+// recentActionsLookback is how many of the previous actions are given to the
+// strategy.
+const recentActionsLookback = 24 * time.Hour
+
+// Run simulates the battery hour by hour from cfg.Start until cfg.End. Each
+// hour the strategy decides with its clock set to the start of the hour, the
+// history before it and future prices forecasted from the prices before it,
+// or the actual future prices if cfg.PerfectPriceForecast is set. The battery is then run in the chosen mode against the actual
+// home load and solar for the hour. Hours without a price or energy history
+// are skipped. history must include cfg.LoadHistoryLookback before cfg.Start
+// and prices must include cfg.PriceForecastLookback before it.
+func Run(
+	ctx context.Context,
+	strategy controller.Strategy,
+	prices []types.Price,
+	history []types.EnergyStats,
+	cfg Config,
+) (Result, error) {
+	if cfg.Battery.CapacityKWH <= 0 {
+		return Result{}, fmt.Errorf("battery capacity must be positive")
+	}
+	if !cfg.End.After(cfg.Start) {
+		return Result{}, fmt.Errorf("end must be after start")
+	}
+	if !cfg.PerfectPriceForecast && cfg.PriceForecastLookback <= 0 {
+		return Result{}, fmt.Errorf("price forecast lookback must be positive")
+	}
+
+	var now time.Time
+	if clocked, ok := strategy.(controller.ClockedStrategy); ok {
+		clocked.SetClock(func() time.Time { return now })
+	}
+
+	prices = append([]types.Price(nil), prices...)
+	sort.Slice(prices, func(i, j int) bool {
+		return prices[i].TSStart.Before(prices[j].TSStart)
+	})
+	history = append([]types.EnergyStats(nil), history...)
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].TSHourStart.Before(history[j].TSHourStart)
+	})
+	hourly := hourlyPrices(prices, cfg.Settings)
+	// the maps are keyed in UTC since stored times and cfg.Start can be in
+	// different locations
+	statsByHour := make(map[time.Time]types.EnergyStats, len(history))
+	for _, h := range history {
+		statsByHour[h.TSHourStart.Truncate(time.Hour).UTC()] = h
+	}
+
+	forecaster := utility.NewPriceForecaster(priceHistory(prices), cfg.PriceForecastLookback)
+
+	res := Result{
+		Start:                cfg.Start,
+		End:                  cfg.End,
+		Battery:              cfg.Battery,
+		PerfectPriceForecast: cfg.PerfectPriceForecast,
+	}
+	sim := newSimulator(cfg.Battery, cfg.Settings)
+	days := make(map[string]*Day)
+	var order []string
+	var actions []types.Action
+	horizon := cfg.Settings.PlanningHorizon()
+
+	for ts := cfg.Start.Truncate(time.Hour); ts.Before(cfg.End); ts = ts.Add(time.Hour) {
+		if err := ctx.Err(); err != nil {
+			return Result{}, err
+		}
+		stat, ok := statsByHour[ts.UTC()]
+		price, hasPrice := hourly[ts.UTC()]
+		if !ok || !hasPrice {
+			continue
+		}
+		now = ts
+
+		currentPrice, ok := priceAt(prices, ts)
+		if !ok {
+			continue
+		}
+		var futurePrices []types.Price
+		var err error
+		if cfg.PerfectPriceForecast {
+			for _, p := range prices {
+				if p.TSStart.After(ts) && p.TSStart.Before(ts.Add(horizon)) {
+					futurePrices = append(futurePrices, p)
+				}
+			}
+		} else {
+			// stored prices are real-time prices so there are no day-ahead
+			// prices to give the forecaster
+			futurePrices, err = forecaster.Forecast(ctx, ts, nil, horizon)
+			if err != nil {
+				return Result{}, fmt.Errorf("failed to forecast prices at %s: %w", ts, err)
+			}
+		}
+		var past []types.EnergyStats
+		for _, h := range history {
+			if !h.TSHourStart.Before(ts) {
+				break
+			}
+			if ts.Sub(h.TSHourStart) <= cfg.LoadHistoryLookback {
+				past = append(past, h)
+			}
+		}
+
+		for len(actions) > 0 && ts.Sub(actions[0].Timestamp) > recentActionsLookback {
+			actions = actions[1:]
+		}
+
+		decision, err := strategy.Decide(ctx, sim.status(ts, statsByHour[ts.Add(-time.Hour).UTC()]), currentPrice, futurePrices, past, nil, actions, cfg.Settings)
+		if err != nil {
+			return Result{}, fmt.Errorf("failed to decide at %s: %w", ts, err)
+		}
+		action := decision.Action
+		action.Timestamp = ts
+		actions = append(actions, action)
+
+		startSOC := sim.soc()
+		out := sim.run(decision.Action, stat)
+
+		h := Hour{
+			TSHourStart:   ts,
+			BatteryMode:   sim.mode,
+			Description:   decision.Action.Description,
+			StartSOC:      startSOC,
+			EndSOC:        sim.soc(),
+			DollarsPerKWH: price.importCost,
+			SimulatedCost: out.gridImportKWH*price.importCost - out.gridExportKWH*price.exportValue,
+			ActualCost:    stat.GridImportKWH*price.importCost - stat.GridExportKWH*price.exportValue,
+			NoBatteryCost: math.Max(0, stat.HomeKWH-stat.SolarKWH) * price.importCost,
+		}
+		if cfg.Settings.GridExportSolar {
+			h.NoBatteryCost -= math.Max(0, stat.SolarKWH-stat.HomeKWH) * price.exportValue
+		}
+		res.Hours = append(res.Hours, h)
+
+		date := ts.In(cfg.Start.Location()).Format(time.DateOnly)
+		day, ok := days[date]
+		if !ok {
+			day = &Day{Date: date}
+			days[date] = day
+			order = append(order, date)
+		}
+		day.add(Day{
+			Hours:              1,
+			SimulatedCost:      h.SimulatedCost,
+			ActualCost:         h.ActualCost,
+			NoBatteryCost:      h.NoBatteryCost,
+			SavingsVsActual:    h.ActualCost - h.SimulatedCost,
+			SavingsVsNoBattery: h.NoBatteryCost - h.SimulatedCost,
+			GridImportKWH:      out.gridImportKWH,
+			GridExportKWH:      out.gridExportKWH,
+			BatteryUsedKWH:     out.batteryUsedKWH,
+			GridChargeKWH:      out.gridChargeKWH,
+		})
+	}
+
+	res.Total.Date = "total"
+	for _, date := range order {
+		res.Days = append(res.Days, *days[date])
+		res.Total.add(*days[date])
+	}
+	return res, nil
+}
+
+// hourPrice is the average price over an hour.
+type hourPrice struct {
+	importCost  float64
+	exportValue float64
+}
+
+// hourlyPrices averages prices into hours keyed by the start of the hour. The
+// import cost is the all-in import price.
+func hourlyPrices(prices []types.Price, settings types.Settings) map[time.Time]hourPrice {
+	sums := make(map[time.Time]hourPrice)
+	counts := make(map[time.Time]int)
+	for _, p := range prices {
+		ts := p.TSStart.Truncate(time.Hour).UTC()
+		sum := sums[ts]
+		sum.importCost += settings.ImportPrice(p)
+		sum.exportValue += settings.ExportPrice(p)
+		sums[ts] = sum
+		counts[ts]++
+	}
+	for ts, sum := range sums {
+		n := float64(counts[ts])
+		sums[ts] = hourPrice{
+			importCost:  sum.importCost / n,
+			exportValue: math.Max(0, sum.exportValue/n),
+		}
+	}
+	return sums
+}
+
+// priceHistory serves sorted prices to the price forecaster.
+type priceHistory []types.Price
+
+// GetPriceHistory returns the prices starting in [start, end).
+func (p priceHistory) GetPriceHistory(_ context.Context, start, end time.Time) ([]types.Price, error) {
+	i := sort.Search(len(p), func(i int) bool {
+		return !p[i].TSStart.Before(start)
+	})
+	j := sort.Search(len(p), func(i int) bool {
+		return !p[i].TSStart.Before(end)
+	})
+	if i >= j {
+		return nil, nil
+	}
+	return p[i:j], nil
+}
+
+// priceAt returns the price covering t from sorted prices.
+func priceAt(prices []types.Price, t time.Time) (types.Price, bool) {
+	i := sort.Search(len(prices), func(i int) bool {
+		return prices[i].TSStart.After(t)
+	})
+	if i == 0 {
+		return types.Price{}, false
+	}
+	p := prices[i-1]
+	if !p.TSEnd.IsZero() && !t.Before(p.TSEnd) {
+		return types.Price{}, false
+	}
+	return p, true
+}
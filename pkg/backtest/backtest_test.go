@@ -0,0 +1,186 @@
+package backtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jameshartig/autoenergy/pkg/controller"
+	"github.com/jameshartig/autoenergy/pkg/types"
+)
+
+// fixedStrategy always returns the same mode and records when it was asked and
+// the future prices it was given.
+type fixedStrategy struct {
+	mode    types.BatteryMode
+	now     func() time.Time
+	times   []time.Time
+	futures [][]types.Price
+}
+
+func (f *fixedStrategy) SetClock(now func() time.Time) {
+	f.now = now
+}
+
+func (f *fixedStrategy) Decide(
+	_ context.Context,
+	_ types.SystemStatus,
+	_ types.Price,
+	futurePrices []types.Price,
+	_ []types.EnergyStats,
+	_ []types.SolarForecast,
+	_ []types.Action,
+	_ types.Settings,
+) (controller.Decision, error) {
+	f.times = append(f.times, f.now())
+	f.futures = append(f.futures, futurePrices)
+	return controller.Decision{Action: types.Action{BatteryMode: f.mode}}, nil
+}
+
+// fixture returns days of hourly prices and history ending at end where the
+// home uses 1kWh every hour from the grid and power is expensive from 5pm to
+// 9pm.
+func fixture(end time.Time, days int) ([]types.Price, []types.EnergyStats) {
+	var prices []types.Price
+	var history []types.EnergyStats
+	for ts := end.AddDate(0, 0, -days); ts.Before(end); ts = ts.Add(time.Hour) {
+		price := 0.05
+		if ts.Hour() >= 17 && ts.Hour() < 21 {
+			price = 0.30
+		}
+		prices = append(prices, types.Price{TSStart: ts, TSEnd: ts.Add(time.Hour), DollarsPerKWH: price})
+		history = append(history, types.EnergyStats{TSHourStart: ts, HomeKWH: 1, GridImportKWH: 1})
+	}
+	return prices, history
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 2)
+	prices, history := fixture(end, 9)
+	settings := types.Settings{
+		MinBatterySOC:               20,
+		GridChargeBatteries:         true,
+		AdditionalFeesDollarsPerKWH: 0.01,
+	}
+	battery := Battery{CapacityKWH: 10, MaxChargeKW: 5, MaxDischargeKW: 5, StartSOC: 20}
+
+	t.Run("Fixed Load", func(t *testing.T) {
+		strategy := &fixedStrategy{mode: types.BatteryModeLoad}
+		res, err := Run(ctx, strategy, prices, history, Config{
+			Start:                 start,
+			End:                   end,
+			Settings:              settings,
+			Battery:               Battery{CapacityKWH: 10, StartSOC: 100},
+			PriceForecastLookback: 7 * 24 * time.Hour,
+		})
+		require.NoError(t, err)
+
+		// the clock follows each hour
+		require.Len(t, strategy.times, 48)
+		assert.True(t, strategy.times[0].Equal(start))
+		assert.True(t, strategy.times[47].Equal(end.Add(-time.Hour)))
+
+		require.Len(t, res.Days, 2)
+		assert.Equal(t, "2026-10-01", res.Days[0].Date)
+		assert.Equal(t, 24, res.Days[0].Hours)
+		// 8kWh covers the first 8 hours of the first day at 0.06
+		assert.InDelta(t, 8.0, res.Days[0].BatteryUsedKWH, 0.001)
+		assert.InDelta(t, 0.48, res.Days[0].SavingsVsActual, 0.001)
+		assert.InDelta(t, 0.0, res.Days[1].SavingsVsActual, 0.001)
+		assert.InDelta(t, res.Days[0].ActualCost, res.Days[0].NoBatteryCost, 0.001)
+		assert.InDelta(t, 20.0, res.Hours[47].EndSOC, 0.001)
+		assert.InDelta(t, res.Days[0].SimulatedCost+res.Days[1].SimulatedCost, res.Total.SimulatedCost, 0.001)
+	})
+
+	t.Run("Heuristic Saves", func(t *testing.T) {
+		res, err := Run(ctx, controller.NewController(), prices, history, Config{
+			Start:                 start,
+			End:                   end,
+			Settings:              settings,
+			Battery:               battery,
+			LoadHistoryLookback:   7 * 24 * time.Hour,
+			PriceForecastLookback: 7 * 24 * time.Hour,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 48, res.Total.Hours)
+		assert.Greater(t, res.Total.GridChargeKWH, 0.0)
+		// charging at 0.06 to avoid 0.31 saves money every day
+		for _, day := range res.Days {
+			assert.Greater(t, day.SavingsVsNoBattery, 0.5, day.Date)
+		}
+		for _, h := range res.Hours {
+			assert.GreaterOrEqual(t, h.EndSOC, settings.MinBatterySOC-0.001)
+			assert.LessOrEqual(t, h.EndSOC, 100.001)
+		}
+	})
+
+	t.Run("Price Forecast", func(t *testing.T) {
+		// an unexpected spike that only perfect foresight would know about
+		spiked := append([]types.Price(nil), prices...)
+		for i := range spiked {
+			if spiked[i].TSStart.Equal(start.Add(5 * time.Hour)) {
+				spiked[i].DollarsPerKWH = 1
+			}
+		}
+		maxFuture := func(futures []types.Price) float64 {
+			var m float64
+			for _, p := range futures {
+				m = max(m, p.DollarsPerKWH)
+			}
+			return m
+		}
+		cfg := Config{
+			Start:                 start,
+			End:                   end,
+			Settings:              settings,
+			Battery:               battery,
+			PriceForecastLookback: 7 * 24 * time.Hour,
+		}
+
+		strategy := &fixedStrategy{mode: types.BatteryModeLoad}
+		res, err := Run(ctx, strategy, spiked, history, cfg)
+		require.NoError(t, err)
+		assert.False(t, res.PerfectPriceForecast)
+		require.NotEmpty(t, strategy.futures[0])
+		for _, p := range strategy.futures[0] {
+			assert.Equal(t, types.PriceSourceHistorical, p.Source)
+		}
+		assert.InDelta(t, 0.30, maxFuture(strategy.futures[0]), 0.001)
+
+		cfg.PerfectPriceForecast = true
+		strategy = &fixedStrategy{mode: types.BatteryModeLoad}
+		res, err = Run(ctx, strategy, spiked, history, cfg)
+		require.NoError(t, err)
+		assert.True(t, res.PerfectPriceForecast)
+		assert.InDelta(t, 1.0, maxFuture(strategy.futures[0]), 0.001)
+	})
+
+	t.Run("Missing Data Skipped", func(t *testing.T) {
+		strategy := &fixedStrategy{mode: types.BatteryModeStandby}
+		res, err := Run(ctx, strategy, prices[:len(prices)-5], history, Config{
+			Start:                 start,
+			End:                   end,
+			Settings:              settings,
+			Battery:               battery,
+			PriceForecastLookback: 7 * 24 * time.Hour,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 43, res.Total.Hours)
+		assert.InDelta(t, 0.0, res.Total.SavingsVsActual, 0.001)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := Run(ctx, controller.NewController(), prices, history, Config{Start: start, End: end})
+		assert.Error(t, err)
+		_, err = Run(ctx, controller.NewController(), prices, history, Config{Start: end, End: start, Battery: battery})
+		assert.Error(t, err)
+		// a forecast needs price history
+		_, err = Run(ctx, controller.NewController(), prices, history, Config{Start: start, End: end, Battery: battery})
+		assert.Error(t, err)
+	})
+}
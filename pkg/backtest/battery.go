@@ -0,0 +1,109 @@
+package backtest
+
+import (
+	"math"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/controller"
+	"github.com/jameshartig/autoenergy/pkg/types"
+)
+
+// simulator tracks the simulated battery and the mode it was last put in.
+type simulator struct {
+	battery   Battery
+	settings  types.Settings
+	limits    controller.BatteryLimits
+	energyKWH float64
+	mode      types.BatteryMode
+	solarMode types.SolarMode
+	lastBatKW float64
+}
+
+func newSimulator(battery Battery, settings types.Settings) *simulator {
+	s := &simulator{
+		battery:  battery,
+		settings: settings,
+		limits: controller.BatteryLimits{
+			CapacityKWH:         battery.CapacityKWH,
+			MinKWH:              battery.CapacityKWH * settings.MinBatterySOC / 100,
+			ChargeKW:            battery.MaxChargeKW,
+			DischargeKW:         battery.MaxDischargeKW,
+			GridCharge:          settings.GridChargeBatteries,
+			GridExport:          settings.GridExportBatteries,
+			RoundTripEfficiency: settings.BatteryRoundTripEfficiency / 100,
+			MaxImportKW:         settings.MaxGridUseKW,
+		},
+		energyKWH: battery.CapacityKWH * battery.StartSOC / 100,
+		mode:      types.BatteryModeLoad,
+		solarMode: types.SolarModeAny,
+	}
+	if s.limits.ChargeKW <= 0 {
+		// conservatively assume it takes 3 hours to charge the battery from 0->100
+		s.limits.ChargeKW = battery.CapacityKWH / 3
+	}
+	if !settings.GridExportSolar {
+		s.solarMode = types.SolarModeNoExport
+	}
+	return s
+}
+
+// soc returns the current state of charge (0-100).
+func (s *simulator) soc() float64 {
+	return s.energyKWH / s.battery.CapacityKWH * 100
+}
+
+// status returns what the ESS would report at ts given the previous hour of
+// energy history.
+func (s *simulator) status(ts time.Time, prev types.EnergyStats) types.SystemStatus {
+	return types.SystemStatus{
+		Timestamp:             ts,
+		BatterySOC:            s.soc(),
+		BatteryKW:             s.lastBatKW,
+		BatteryCapacityKWH:    s.battery.CapacityKWH,
+		MaxBatteryChargeKW:    s.battery.MaxChargeKW,
+		MaxBatteryDischargeKW: s.battery.MaxDischargeKW,
+		SolarKW:               prev.SolarKWH,
+		HomeKW:                prev.HomeKWH,
+		GridKW:                prev.HomeKWH - prev.SolarKWH - s.lastBatKW,
+		CanExportSolar:        s.solarMode != types.SolarModeNoExport,
+		CanExportBattery:      s.mode == types.BatteryModeExport,
+		CanImportBattery:      s.settings.GridChargeBatteries && (s.mode == types.BatteryModeLoad || s.mode == types.BatteryModeChargeAny),
+		ElevatedMinBatterySOC: s.mode != types.BatteryModeLoad && s.mode != types.BatteryModeExport,
+	}
+}
+
+// hourOutcome is the energy flows over a simulated hour.
+type hourOutcome struct {
+	gridImportKWH  float64
+	gridExportKWH  float64
+	gridChargeKWH  float64
+	batteryUsedKWH float64
+}
+
+// run applies the action and runs the battery for an hour against the actual
+// home load and solar in stat. NoChange keeps the previous mode.
+func (s *simulator) run(action types.Action, stat types.EnergyStats) hourOutcome {
+	if action.BatteryMode != types.BatteryModeNoChange {
+		s.mode = action.BatteryMode
+	}
+	if action.SolarMode != types.SolarModeNoChange {
+		s.solarMode = action.SolarMode
+	}
+
+	flows := controller.StepBattery(s.limits, s.mode, s.energyKWH, stat.HomeKWH-stat.SolarKWH, 1)
+	gridExport := flows.GridExportKWH
+	// solar we can't export is curtailed
+	if s.solarMode == types.SolarModeNoExport {
+		gridExport = flows.BatteryExportKWH
+	}
+
+	s.energyKWH = math.Min(s.battery.CapacityKWH, math.Max(0, flows.EndKWH))
+	s.lastBatKW = flows.BatteryUseKWH + flows.BatteryExportKWH - flows.SolarChargeKWH - flows.GridChargeKWH
+
+	return hourOutcome{
+		gridImportKWH:  flows.GridImportKWH,
+		gridExportKWH:  gridExport,
+		gridChargeKWH:  flows.GridChargeKWH,
+		batteryUsedKWH: flows.BatteryUseKWH + flows.BatteryExportKWH,
+	}
+}
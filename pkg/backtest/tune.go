@@ -0,0 +1,166 @@
+package backtest
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jameshartig/autoenergy/pkg/controller"
+	"github.com/jameshartig/autoenergy/pkg/types"
+)
+
+// TuneRange is the values of a setting to try from Min to Max in steps of Step.
+type TuneRange struct {
+	Min  float64 `json:"min"`
+	Max  float64 `json:"max"`
+	Step float64 `json:"step"`
+}
+
+// ParseTuneRange parses a range formatted as min:max:step. A single value is
+// a range of just that value.
+func ParseTuneRange(s string) (TuneRange, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 1 && len(parts) != 3 {
+		return TuneRange{}, fmt.Errorf("invalid range (%s): expected min:max:step", s)
+	}
+	var values [3]float64
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return TuneRange{}, fmt.Errorf("invalid range (%s): %w", s, err)
+		}
+		values[i] = v
+	}
+	if len(parts) == 1 {
+		return TuneRange{Min: values[0], Max: values[0]}, nil
+	}
+	r := TuneRange{Min: values[0], Max: values[1], Step: values[2]}
+	if r.Max < r.Min || r.Step <= 0 {
+		return TuneRange{}, fmt.Errorf("invalid range (%s): max must be at least min and step must be positive", s)
+	}
+	return r, nil
+}
+
+// values returns every value in the range.
+func (r TuneRange) values() []float64 {
+	if r.Step <= 0 || r.Max <= r.Min {
+		return []float64{r.Min}
+	}
+	var values []float64
+	// round so floating point steps don't skip Max
+	for i := 0; r.Min+float64(i)*r.Step <= r.Max+r.Step/1e6; i++ {
+		values = append(values, math.Round((r.Min+float64(i)*r.Step)*1e6)/1e6)
+	}
+	return values
+}
+
+// random returns a random value in the range.
+func (r TuneRange) random(rng *rand.Rand) float64 {
+	return math.Round((r.Min+rng.Float64()*(r.Max-r.Min))*1e6) / 1e6
+}
+
+// TuneSpace is the settings to search over while tuning.
+type TuneSpace struct {
+	AlwaysChargeUnderDollarsPerKWH      TuneRange `json:"alwaysChargeUnderDollarsPerKWH"`
+	MinArbitrageDifferenceDollarsPerKWH TuneRange `json:"minArbitrageDifferenceDollarsPerKWH"`
+	LoadOutlierStdDevs                  TuneRange `json:"loadOutlierStdDevs"`
+}
+
+// GridCandidates returns base with every combination of values in space.
+func GridCandidates(base types.Settings, space TuneSpace) []types.Settings {
+	var candidates []types.Settings
+	for _, alwaysCharge := range space.AlwaysChargeUnderDollarsPerKWH.values() {
+		for _, minArbitrage := range space.MinArbitrageDifferenceDollarsPerKWH.values() {
+			for _, outlier := range space.LoadOutlierStdDevs.values() {
+				s := base
+				s.AlwaysChargeUnderDollarsPerKWH = alwaysCharge
+				s.MinArbitrageDifferenceDollarsPerKWH = minArbitrage
+				s.LoadOutlierStdDevs = outlier
+				candidates = append(candidates, s)
+			}
+		}
+	}
+	return candidates
+}
+
+// RandomCandidates returns n copies of base with random values from space.
+func RandomCandidates(base types.Settings, space TuneSpace, n int, rng *rand.Rand) []types.Settings {
+	candidates := make([]types.Settings, n)
+	for i := range candidates {
+		s := base
+		s.AlwaysChargeUnderDollarsPerKWH = space.AlwaysChargeUnderDollarsPerKWH.random(rng)
+		s.MinArbitrageDifferenceDollarsPerKWH = space.MinArbitrageDifferenceDollarsPerKWH.random(rng)
+		s.LoadOutlierStdDevs = space.LoadOutlierStdDevs.random(rng)
+		candidates[i] = s
+	}
+	return candidates
+}
+
+// Candidate is a set of settings tried while tuning and how it did.
+type Candidate struct {
+	Settings types.Settings `json:"settings"`
+	// NetCost is the simulated cost plus battery degradation
+	NetCost float64 `json:"netCost"`
+	Total   Day     `json:"total"`
+}
+
+// Tune backtests each candidate with a new strategy from newStrategy and
+// returns them ranked by net cost, cheapest first. cfg.Settings is ignored in
+// favor of each candidate.
+func Tune(
+	ctx context.Context,
+	newStrategy func() (controller.Strategy, error),
+	prices []types.Price,
+	history []types.EnergyStats,
+	cfg Config,
+	candidates []types.Settings,
+) ([]Candidate, error) {
+	results := make([]Candidate, len(candidates))
+	errs := make([]error, len(candidates))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+	for i, settings := range candidates {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			strategy, err := newStrategy()
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			c := cfg
+			c.Settings = settings
+			res, err := Run(ctx, strategy, prices, history, c)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			results[i] = Candidate{
+				Settings: settings,
+				NetCost:  res.Total.SimulatedCost + res.Total.BatteryUsedKWH*settings.BatteryDegradationDollarsPerKWH,
+				Total:    res.Total,
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].NetCost < results[j].NetCost
+	})
+	return results, nil
+}
@@ -0,0 +1,83 @@
+package backtest
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jameshartig/autoenergy/pkg/controller"
+	"github.com/jameshartig/autoenergy/pkg/types"
+)
+
+func TestParseTuneRange(t *testing.T) {
+	r, err := ParseTuneRange("0:0.1:0.05")
+	require.NoError(t, err)
+	assert.Equal(t, TuneRange{Min: 0, Max: 0.1, Step: 0.05}, r)
+	assert.Equal(t, []float64{0, 0.05, 0.1}, r.values())
+
+	r, err = ParseTuneRange("0.02")
+	require.NoError(t, err)
+	assert.Equal(t, []float64{0.02}, r.values())
+
+	for _, s := range []string{"", "a", "0:1", "1:0:0.1", "0:1:0"} {
+		_, err := ParseTuneRange(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestCandidates(t *testing.T) {
+	base := types.Settings{MinBatterySOC: 20}
+	space := TuneSpace{
+		AlwaysChargeUnderDollarsPerKWH:      TuneRange{Min: 0, Max: 0.02, Step: 0.01},
+		MinArbitrageDifferenceDollarsPerKWH: TuneRange{Min: 0, Max: 0.05, Step: 0.05},
+		LoadOutlierStdDevs:                  TuneRange{Min: 2, Max: 4, Step: 2},
+	}
+
+	grid := GridCandidates(base, space)
+	require.Len(t, grid, 12)
+	assert.Equal(t, 0.02, grid[11].AlwaysChargeUnderDollarsPerKWH)
+	assert.Equal(t, 0.05, grid[11].MinArbitrageDifferenceDollarsPerKWH)
+	assert.Equal(t, 4.0, grid[11].LoadOutlierStdDevs)
+	assert.Equal(t, 2.0, grid[10].LoadOutlierStdDevs)
+	assert.Equal(t, 20.0, grid[11].MinBatterySOC)
+
+	random := RandomCandidates(base, space, 10, rand.New(rand.NewSource(1)))
+	require.Len(t, random, 10)
+	for _, s := range random {
+		assert.GreaterOrEqual(t, s.AlwaysChargeUnderDollarsPerKWH, 0.0)
+		assert.LessOrEqual(t, s.AlwaysChargeUnderDollarsPerKWH, 0.02)
+		assert.LessOrEqual(t, s.MinArbitrageDifferenceDollarsPerKWH, 0.05)
+		assert.GreaterOrEqual(t, s.LoadOutlierStdDevs, 2.0)
+		assert.LessOrEqual(t, s.LoadOutlierStdDevs, 4.0)
+	}
+}
+
+func TestTune(t *testing.T) {
+	start := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 1)
+	prices, history := fixture(end, 8)
+	base := types.Settings{MinBatterySOC: 20, GridChargeBatteries: true}
+
+	// an arbitrage difference bigger than the price spread never charges
+	candidates := GridCandidates(base, TuneSpace{
+		MinArbitrageDifferenceDollarsPerKWH: TuneRange{Min: 0, Max: 1, Step: 1},
+	})
+	ranked, err := Tune(context.Background(), func() (controller.Strategy, error) {
+		return controller.NewStrategy("")
+	}, prices, history, Config{
+		Start:                 start,
+		End:                   end,
+		Battery:               Battery{CapacityKWH: 10, MaxChargeKW: 5, StartSOC: 20},
+		LoadHistoryLookback:   7 * 24 * time.Hour,
+		PriceForecastLookback: 7 * 24 * time.Hour,
+	}, candidates)
+	require.NoError(t, err)
+	require.Len(t, ranked, 2)
+	assert.Equal(t, 0.0, ranked[0].Settings.MinArbitrageDifferenceDollarsPerKWH)
+	assert.Less(t, ranked[0].NetCost, ranked[1].NetCost)
+	assert.Equal(t, 24, ranked[0].Total.Hours)
+}
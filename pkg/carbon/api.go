@@ -0,0 +1,130 @@
+package carbon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+	"github.com/levenlabs/go-lflag"
+)
+
+// API implements the Provider interface using a simple JSON API that can be
+// backed by any carbon intensity source or a local stub. Relative to the base
+// URL it expects:
+//
+//	GET /current                       a single intensity
+//	GET /forecast                      a list of intensities
+//	GET /history?start=...&end=...     a list of intensities (RFC3339 times)
+//
+// Intensities are objects with tsStart, tsEnd and gCO2PerKWH.
+type API struct {
+	apiURL string
+	apiKey string
+	region string
+	client *http.Client
+}
+
+// configuredAPI sets up flags for the carbon API and returns the instance.
+func configuredAPI() *API {
+	a := &API{
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+	apiURL := lflag.String("carbon-api-url", "", "Base URL for the carbon intensity API")
+	apiKey := lflag.String("carbon-api-key", "", "Bearer token for the carbon intensity API (optional)")
+	region := lflag.String("carbon-region", "", "Grid region passed to the carbon intensity API (optional)")
+
+	lflag.Do(func() {
+		a.apiURL = *apiURL
+		a.apiKey = *apiKey
+		a.region = *region
+	})
+
+	return a
+}
+
+// Validate ensures the configuration is valid.
+func (a *API) Validate() error {
+	if a.apiURL == "" {
+		return fmt.Errorf("carbon-api-url is required")
+	}
+	if _, err := url.Parse(a.apiURL); err != nil {
+		return fmt.Errorf("failed to parse carbon api url (%s): %w", a.apiURL, err)
+	}
+	return nil
+}
+
+// get fetches path relative to the base URL and decodes the JSON into v.
+func (a *API) get(ctx context.Context, path string, params url.Values, v interface{}) error {
+	u, err := url.Parse(a.apiURL)
+	if err != nil {
+		return fmt.Errorf("failed to parse url: %w", err)
+	}
+	u = u.JoinPath(path)
+	if params == nil {
+		params = url.Values{}
+	}
+	if a.region != "" {
+		params.Set("region", a.region)
+	}
+	u.RawQuery = params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if a.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+a.apiKey)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code fetching %s: %d", path, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return nil
+}
+
+// GetCurrentIntensity returns the current carbon intensity.
+func (a *API) GetCurrentIntensity(ctx context.Context) (types.CarbonIntensity, error) {
+	var ci types.CarbonIntensity
+	if err := a.get(ctx, "current", nil, &ci); err != nil {
+		return types.CarbonIntensity{}, err
+	}
+	slog.DebugContext(ctx, "got current carbon intensity", slog.Float64("gCO2PerKWH", ci.GCO2PerKWH), slog.Time("ts", ci.TSStart))
+	return ci, nil
+}
+
+// GetForecastIntensity returns the forecasted carbon intensities.
+func (a *API) GetForecastIntensity(ctx context.Context) ([]types.CarbonIntensity, error) {
+	var forecast []types.CarbonIntensity
+	if err := a.get(ctx, "forecast", nil, &forecast); err != nil {
+		return nil, err
+	}
+	slog.DebugContext(ctx, "got carbon intensity forecast", slog.Int("intervals", len(forecast)))
+	return forecast, nil
+}
+
+// GetHistoricalIntensity returns the carbon intensities between start and end.
+func (a *API) GetHistoricalIntensity(ctx context.Context, start, end time.Time) ([]types.CarbonIntensity, error) {
+	params := url.Values{}
+	params.Set("start", start.UTC().Format(time.RFC3339))
+	params.Set("end", end.UTC().Format(time.RFC3339))
+	var history []types.CarbonIntensity
+	if err := a.get(ctx, "history", params, &history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
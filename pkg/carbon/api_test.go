@@ -0,0 +1,84 @@
+package carbon
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+)
+
+func TestAPI(t *testing.T) {
+	now := time.Now().Truncate(time.Hour)
+	intensities := []types.CarbonIntensity{
+		{TSStart: now, TSEnd: now.Add(time.Hour), GCO2PerKWH: 400},
+		{TSStart: now.Add(time.Hour), TSEnd: now.Add(2 * time.Hour), GCO2PerKWH: 250},
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer key", r.Header.Get("Authorization"))
+		assert.Equal(t, "PJM", r.URL.Query().Get("region"))
+		switch r.URL.Path {
+		case "/v1/current":
+			json.NewEncoder(w).Encode(intensities[0])
+		case "/v1/forecast":
+			json.NewEncoder(w).Encode(intensities)
+		case "/v1/history":
+			assert.Equal(t, now.UTC().Format(time.RFC3339), r.URL.Query().Get("start"))
+			json.NewEncoder(w).Encode(intensities[:1])
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	a := &API{
+		apiURL: ts.URL + "/v1",
+		apiKey: "key",
+		region: "PJM",
+		client: ts.Client(),
+	}
+	require.NoError(t, a.Validate())
+
+	current, err := a.GetCurrentIntensity(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 400.0, current.GCO2PerKWH)
+	assert.True(t, current.TSStart.Equal(now))
+
+	forecast, err := a.GetForecastIntensity(context.Background())
+	require.NoError(t, err)
+	require.Len(t, forecast, 2)
+	assert.Equal(t, 250.0, forecast[1].GCO2PerKWH)
+
+	history, err := a.GetHistoricalIntensity(context.Background(), now, now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Len(t, history, 1)
+
+	assert.Error(t, (&API{}).Validate())
+}
+
+func TestAnnotate(t *testing.T) {
+	now := time.Now().Truncate(time.Hour)
+	prices := []types.Price{
+		{TSStart: now, TSEnd: now.Add(5 * time.Minute)},
+		{TSStart: now.Add(70 * time.Minute)},
+		{TSStart: now.Add(3 * time.Hour)},
+	}
+	Annotate(prices, []types.CarbonIntensity{
+		{TSStart: now, TSEnd: now.Add(time.Hour), GCO2PerKWH: 400},
+		// no end so it's assumed to be hourly
+		{TSStart: now.Add(time.Hour), GCO2PerKWH: 250},
+	})
+
+	require.NotNil(t, prices[0].GCO2PerKWH)
+	assert.Equal(t, 400.0, *prices[0].GCO2PerKWH)
+	require.NotNil(t, prices[1].GCO2PerKWH)
+	assert.Equal(t, 250.0, *prices[1].GCO2PerKWH)
+	assert.Nil(t, prices[2].GCO2PerKWH)
+}
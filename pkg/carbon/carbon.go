@@ -0,0 +1,31 @@
+package carbon
+
+import (
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+)
+
+// Annotate sets the carbon intensity of each price to the intensity whose
+// interval contains the price's start. Intensities without an end are assumed
+// to be hourly. Prices without a matching intensity are left unchanged.
+func Annotate(prices []types.Price, intensities []types.CarbonIntensity) {
+	if len(intensities) == 0 {
+		return
+	}
+	for i := range prices {
+		ts := prices[i].TSStart
+		for _, ci := range intensities {
+			end := ci.TSEnd
+			if end.IsZero() {
+				end = ci.TSStart.Add(time.Hour)
+			}
+			if ts.Before(ci.TSStart) || !ts.Before(end) {
+				continue
+			}
+			g := ci.GCO2PerKWH
+			prices[i].GCO2PerKWH = &g
+			break
+		}
+	}
+}
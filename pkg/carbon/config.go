@@ -0,0 +1,54 @@
+package carbon
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+	"github.com/levenlabs/go-lflag"
+)
+
+// Configured sets up the carbon intensity provider based on flags.
+func Configured() Provider {
+	provider := lflag.String("carbon-provider", "none", "Carbon intensity provider to use (available: none, api)")
+
+	var p struct{ Provider }
+
+	// Configure implementations
+	api := configuredAPI()
+
+	lflag.Do(func() {
+		switch *provider {
+		case "none", "":
+			p.Provider = none{}
+		case "api":
+			if err := api.Validate(); err != nil {
+				panic(fmt.Sprintf("carbon api validation failed: %v", err))
+			}
+			p.Provider = api
+		default:
+			panic(fmt.Sprintf("unknown carbon provider: %s", *provider))
+		}
+	})
+
+	return &p
+}
+
+// none is used when no carbon intensity provider is configured.
+type none struct{}
+
+// GetCurrentIntensity always returns an empty intensity.
+func (none) GetCurrentIntensity(ctx context.Context) (types.CarbonIntensity, error) {
+	return types.CarbonIntensity{}, nil
+}
+
+// GetForecastIntensity always returns an empty forecast.
+func (none) GetForecastIntensity(ctx context.Context) ([]types.CarbonIntensity, error) {
+	return nil, nil
+}
+
+// GetHistoricalIntensity always returns an empty history.
+func (none) GetHistoricalIntensity(ctx context.Context, start, end time.Time) ([]types.CarbonIntensity, error) {
+	return nil, nil
+}
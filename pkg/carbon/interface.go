@@ -0,0 +1,23 @@
+package carbon
+
+import (
+	"context"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+)
+
+// Provider defines the interface for fetching the marginal carbon intensity
+// of grid electricity.
+type Provider interface {
+	// GetCurrentIntensity returns the current carbon intensity. It returns an
+	// empty intensity if none is available.
+	GetCurrentIntensity(ctx context.Context) (types.CarbonIntensity, error)
+
+	// GetForecastIntensity returns a list of forecasted carbon intensities.
+	GetForecastIntensity(ctx context.Context) ([]types.CarbonIntensity, error)
+
+	// GetHistoricalIntensity returns the carbon intensity for a specific time
+	// range. This should be used for syncing historical data.
+	GetHistoricalIntensity(ctx context.Context, start, end time.Time) ([]types.CarbonIntensity, error)
+}
@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"math"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+)
+
+// BatteryLimits describes how a battery can be charged and discharged.
+type BatteryLimits struct {
+	CapacityKWH float64
+	// MinKWH is the energy the battery won't discharge below.
+	MinKWH   float64
+	ChargeKW float64
+	// DischargeKW is the maximum discharge rate. 0 means it's unknown and the
+	// battery can cover any load.
+	DischargeKW float64
+	GridCharge  bool
+	GridExport  bool
+	// RoundTripEfficiency is the fraction of energy charged that can later be
+	// discharged. 0 is treated as lossless.
+	RoundTripEfficiency float64
+	// MaxImportKW caps grid charging so the grid import stays under it. 0
+	// means there is no limit.
+	MaxImportKW float64
+}
+
+// efficiencies returns the one-way charge and discharge efficiencies, split
+// evenly from the round trip efficiency.
+func (b BatteryLimits) efficiencies() (float64, float64) {
+	if b.RoundTripEfficiency <= 0 || b.RoundTripEfficiency >= 1 {
+		return 1, 1
+	}
+	oneWay := math.Sqrt(b.RoundTripEfficiency)
+	return oneWay, oneWay
+}
+
+// BatteryFlows is the energy moved by running the battery in a mode.
+type BatteryFlows struct {
+	EndKWH        float64
+	GridImportKWH float64
+	// GridExportKWH includes surplus solar that didn't fit in the battery.
+	GridExportKWH float64
+	// SolarChargeKWH is the surplus solar that charged the battery.
+	SolarChargeKWH float64
+	GridChargeKWH  float64
+	// BatteryUseKWH is the energy delivered from the battery to the home.
+	BatteryUseKWH float64
+	// BatteryExportKWH is the energy delivered from the battery to the grid.
+	BatteryExportKWH float64
+}
+
+// StepBattery runs the battery in mode for hours starting with startKWH
+// stored in it. netLoadKWH is the home load minus solar over the step where
+// negative means there is surplus solar. Export without GridExport and
+// ChargeAny without GridCharge behave like Standby.
+func StepBattery(b BatteryLimits, mode types.BatteryMode, startKWH, netLoadKWH, hours float64) BatteryFlows {
+	maxCharge := b.ChargeKW * hours
+	maxDischarge := math.Inf(1)
+	if b.DischargeKW > 0 {
+		maxDischarge = b.DischargeKW * hours
+	}
+
+	chargeEff, dischargeEff := b.efficiencies()
+
+	homeNeed := math.Max(0, netLoadKWH)
+	surplus := math.Max(0, -netLoadKWH)
+	// headroom is how much we can put into the battery before losses
+	headroom := math.Max(0, b.CapacityKWH-startKWH) / chargeEff
+
+	var out BatteryFlows
+
+	// surplus solar always flows into the battery first since we cannot stop
+	// the battery from charging from solar
+	out.SolarChargeKWH = math.Min(surplus, math.Min(maxCharge, headroom))
+
+	switch mode {
+	case types.BatteryModeLoad:
+		usable := math.Max(0, startKWH-b.MinKWH) * dischargeEff
+		out.BatteryUseKWH = math.Min(homeNeed, math.Min(maxDischarge, usable))
+	case types.BatteryModeChargeAny:
+		if b.GridCharge {
+			out.GridChargeKWH = math.Max(0, math.Min(maxCharge, headroom)-out.SolarChargeKWH)
+			// only charge with whatever is left under the grid limit
+			if b.MaxImportKW > 0 {
+				out.GridChargeKWH = math.Min(out.GridChargeKWH, math.Max(0, b.MaxImportKW*hours-homeNeed))
+			}
+		}
+	case types.BatteryModeExport:
+		if b.GridExport {
+			// the battery discharges as fast as it can, covering the home first
+			// and exporting the rest, so surplus solar goes to the grid instead
+			out.SolarChargeKWH = 0
+			// if we don't know the discharge rate assume it matches the charge
+			// rate
+			rate := maxDischarge
+			if b.DischargeKW <= 0 {
+				rate = maxCharge
+			}
+			usable := math.Min(rate, math.Max(0, startKWH-b.MinKWH)*dischargeEff)
+			out.BatteryUseKWH = math.Min(homeNeed, usable)
+			out.BatteryExportKWH = usable - out.BatteryUseKWH
+		}
+	}
+
+	out.GridImportKWH = homeNeed - out.BatteryUseKWH + out.GridChargeKWH
+	out.GridExportKWH = surplus - out.SolarChargeKWH + out.BatteryExportKWH
+	out.EndKWH = startKWH + (out.SolarChargeKWH+out.GridChargeKWH)*chargeEff - (out.BatteryUseKWH+out.BatteryExportKWH)/dischargeEff
+	return out
+}
@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStepBattery(t *testing.T) {
+	b := BatteryLimits{
+		CapacityKWH: 10,
+		MinKWH:      2,
+		ChargeKW:    5,
+		GridCharge:  true,
+	}
+
+	t.Run("Load", func(t *testing.T) {
+		out := StepBattery(b, types.BatteryModeLoad, 5, 4, 1)
+		assert.InDelta(t, 3.0, out.BatteryUseKWH, 0.001)
+		assert.InDelta(t, 1.0, out.GridImportKWH, 0.001)
+		assert.InDelta(t, 2.0, out.EndKWH, 0.001)
+	})
+
+	t.Run("Solar Charges First", func(t *testing.T) {
+		out := StepBattery(b, types.BatteryModeChargeAny, 5, -2, 1)
+		assert.InDelta(t, 2.0, out.SolarChargeKWH, 0.001)
+		assert.InDelta(t, 3.0, out.GridChargeKWH, 0.001)
+		assert.InDelta(t, 10.0, out.EndKWH, 0.001)
+		assert.InDelta(t, 0.0, out.GridExportKWH, 0.001)
+	})
+
+	t.Run("Grid Charge Capped", func(t *testing.T) {
+		capped := b
+		capped.MaxImportKW = 4
+		out := StepBattery(capped, types.BatteryModeChargeAny, 5, 2, 1)
+		assert.InDelta(t, 2.0, out.GridChargeKWH, 0.001)
+		assert.InDelta(t, 4.0, out.GridImportKWH, 0.001)
+	})
+
+	t.Run("Export Disabled", func(t *testing.T) {
+		out := StepBattery(b, types.BatteryModeExport, 8, 1, 1)
+		assert.Equal(t, StepBattery(b, types.BatteryModeStandby, 8, 1, 1), out)
+		assert.InDelta(t, 0.0, out.BatteryExportKWH, 0.001)
+	})
+
+	t.Run("Export", func(t *testing.T) {
+		exporting := b
+		exporting.GridExport = true
+		out := StepBattery(exporting, types.BatteryModeExport, 8, 1, 1)
+		assert.InDelta(t, 1.0, out.BatteryUseKWH, 0.001)
+		assert.InDelta(t, 4.0, out.BatteryExportKWH, 0.001)
+		assert.InDelta(t, 3.0, out.EndKWH, 0.001)
+	})
+}
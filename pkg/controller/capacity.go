@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+)
+
+const (
+	// capacityPeaksPerYear is how many coincident peak hours PJM averages to
+	// set the peak load contribution (PLC).
+	capacityPeaksPerYear = 5
+	// capacityPeakPenaltyPerKWH is the smallest cost added to each kWh
+	// imported during a predicted capacity peak so the optimizer cuts grid
+	// import as much as it can.
+	capacityPeakPenaltyPerKWH = 1.0
+	// capacityPeakStartHour and capacityPeakEndHour are the afternoon hours
+	// in capacityPeakLocation that PJM's summer peaks fall in.
+	capacityPeakStartHour = 13
+	capacityPeakEndHour   = 19
+)
+
+// capacityPeakLocation is the timezone of the ComEd zone that the peak hours,
+// alert days and holidays are in. The server usually runs in UTC.
+var capacityPeakLocation = func() *time.Location {
+	loc, err := time.LoadLocation("America/Chicago")
+	if err != nil {
+		panic(fmt.Errorf("failed to load central time location: %w", err))
+	}
+	return loc
+}()
+
+// capacityPeakReason returns why the hour starting at ts is predicted to be
+// one of PJM's coincident peaks or an empty string if it isn't. Peaks are the
+// afternoon hours of peak alert days or, if there's a capacity charge, summer
+// weekday afternoons (not holidays) where PJM's forecasted load or the
+// day-ahead price is at or above the settings' thresholds. Prices forecasted
+// from history are ignored.
+func capacityPeakReason(ts time.Time, price types.Price, settings types.Settings) string {
+	ts = ts.In(capacityPeakLocation)
+	if ts.Hour() < capacityPeakStartHour || ts.Hour() >= capacityPeakEndHour {
+		return ""
+	}
+	date := ts.Format(time.DateOnly)
+	for _, alert := range settings.CapacityPeakAlerts {
+		if alert == date {
+			return "peak alert"
+		}
+	}
+	if settings.CapacityChargeDollarsPerKW <= 0 {
+		return ""
+	}
+	if ts.Month() < time.June || ts.Month() > time.September {
+		return ""
+	}
+	if ts.Weekday() == time.Saturday || ts.Weekday() == time.Sunday {
+		return ""
+	}
+	for _, holiday := range settings.Holidays {
+		if holiday == date {
+			return ""
+		}
+	}
+	if settings.CapacityPeakLoadMW > 0 && price.GridLoadMW != nil && *price.GridLoadMW >= settings.CapacityPeakLoadMW {
+		return fmt.Sprintf("PJM load %.0fMW >= %.0fMW", *price.GridLoadMW, settings.CapacityPeakLoadMW)
+	}
+	if settings.CapacityPeakPriceDollarsPerKWH > 0 && price.Source != types.PriceSourceHistorical && price.DollarsPerKWH >= settings.CapacityPeakPriceDollarsPerKWH {
+		return fmt.Sprintf("price %.3f >= %.3f", price.DollarsPerKWH, settings.CapacityPeakPriceDollarsPerKWH)
+	}
+	return ""
+}
+
+// capacityPeakPenalty returns the cost added to each kWh imported during a
+// predicted capacity peak. Each kW during a peak adds 1/capacityPeaksPerYear
+// kW to the PLC.
+func capacityPeakPenalty(settings types.Settings) float64 {
+	return max(capacityPeakPenaltyPerKWH, settings.CapacityChargeDollarsPerKW/capacityPeaksPerYear)
+}
+
+// capacityPeakTargets returns a full battery SOC target at the start of each
+// run of capacity peak slots so the battery is full when the peak starts.
+func capacityPeakTargets(slots []simSlot) []types.SOCTarget {
+	var targets []types.SOCTarget
+	for i, slot := range slots {
+		if slot.capacityPeak == "" || (i > 0 && slots[i-1].capacityPeak != "") {
+			continue
+		}
+		targets = append(targets, types.SOCTarget{
+			Name:     "Capacity Peak",
+			SOC:      100,
+			Deadline: slot.ts,
+		})
+	}
+	return targets
+}
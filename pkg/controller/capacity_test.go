@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+)
+
+func TestCapacityPeakReason(t *testing.T) {
+	// Wednesday afternoon in July
+	ts := time.Date(2026, 7, 15, 15, 0, 0, 0, capacityPeakLocation)
+	load := 148000.0
+	price := types.Price{TSStart: ts, DollarsPerKWH: 0.12, Source: types.PriceSourceDayAhead, GridLoadMW: &load}
+
+	settings := types.Settings{CapacityPeakLoadMW: 145000, CapacityPeakPriceDollarsPerKWH: 0.10}
+	assert.Empty(t, capacityPeakReason(ts, price, settings), "disabled without a capacity charge")
+
+	settings.CapacityChargeDollarsPerKW = 100
+	assert.Equal(t, "PJM load 148000MW >= 145000MW", capacityPeakReason(ts, price, settings))
+	assert.Empty(t, capacityPeakReason(ts.Add(-3*time.Hour), price, settings), "morning")
+	assert.Empty(t, capacityPeakReason(ts.AddDate(0, 0, 3), price, settings), "weekend")
+	assert.Empty(t, capacityPeakReason(ts.AddDate(0, 3, 0), price, settings), "october")
+
+	holiday := settings
+	holiday.Holidays = []string{"2026-07-15"}
+	assert.Empty(t, capacityPeakReason(ts, price, holiday))
+
+	// a summer weekday afternoon alone isn't a peak
+	assert.Empty(t, capacityPeakReason(ts, price, types.Settings{CapacityChargeDollarsPerKW: 100}))
+
+	lowLoad := 120000.0
+	price.GridLoadMW = &lowLoad
+	assert.Equal(t, "price 0.120 >= 0.100", capacityPeakReason(ts, price, settings))
+	price.DollarsPerKWH = 0.08
+	assert.Empty(t, capacityPeakReason(ts, price, settings))
+	price.GridLoadMW = nil
+	assert.Empty(t, capacityPeakReason(ts, price, settings), "unknown load")
+	price.DollarsPerKWH = 0.12
+	price.Source = types.PriceSourceHistorical
+	assert.Empty(t, capacityPeakReason(ts, price, settings), "forecasted from history")
+
+	// alerts apply on any day, even without a capacity charge
+	alert := types.Settings{CapacityPeakAlerts: []string{"2026-10-17"}}
+	assert.Equal(t, "peak alert", capacityPeakReason(time.Date(2026, 10, 17, 14, 0, 0, 0, capacityPeakLocation), types.Price{}, alert))
+	assert.Empty(t, capacityPeakReason(time.Date(2026, 10, 17, 20, 0, 0, 0, capacityPeakLocation), types.Price{}, alert))
+
+	t.Run("UTC", func(t *testing.T) {
+		// 3PM UTC is 10AM in Chicago and 8PM UTC is 3PM
+		summer := types.Settings{CapacityChargeDollarsPerKW: 100, CapacityPeakLoadMW: 145000}
+		peak := types.Price{GridLoadMW: &load}
+		assert.Empty(t, capacityPeakReason(time.Date(2026, 7, 15, 15, 0, 0, 0, time.UTC), peak, summer))
+		assert.NotEmpty(t, capacityPeakReason(time.Date(2026, 7, 15, 20, 0, 0, 0, time.UTC), peak, summer))
+		assert.Empty(t, capacityPeakReason(time.Date(2026, 10, 17, 14, 0, 0, 0, time.UTC), types.Price{}, alert))
+		assert.Equal(t, "peak alert", capacityPeakReason(time.Date(2026, 10, 17, 18, 0, 0, 0, time.UTC), types.Price{}, alert))
+		// 11PM UTC on Friday is still a Friday afternoon in Chicago
+		assert.NotEmpty(t, capacityPeakReason(time.Date(2026, 7, 17, 23, 0, 0, 0, time.UTC), peak, summer))
+	})
+}
+
+func TestCapacityPeakTargets(t *testing.T) {
+	start := time.Date(2026, 7, 15, 12, 0, 0, 0, time.UTC)
+	var slots []simSlot
+	for i := range 6 {
+		slot := simSlot{ts: start.Add(time.Duration(i) * time.Hour), duration: time.Hour}
+		if i == 0 || i == 2 || i == 3 || i == 5 {
+			slot.capacityPeak = "peak alert"
+		}
+		slots = append(slots, slot)
+	}
+
+	targets := capacityPeakTargets(slots)
+	require.Len(t, targets, 3)
+	assert.True(t, targets[0].Deadline.Equal(start))
+	assert.True(t, targets[1].Deadline.Equal(start.Add(2*time.Hour)))
+	assert.True(t, targets[2].Deadline.Equal(start.Add(5*time.Hour)))
+	assert.Equal(t, 100.0, targets[1].SOC)
+}
@@ -5,34 +5,56 @@ import (
 	"fmt"
 	"log/slog"
 	"math"
-	"sort"
 	"time"
 
 	"github.com/jameshartig/autoenergy/pkg/types"
 )
 
+// maxGridUsePenaltyPerKW is the smallest cost for each kW over MaxGridUseKW
+// so the optimizer treats the limit as a hard limit.
+const maxGridUsePenaltyPerKW = 10.0
+
 // Decision represents the result of the decision logic.
 type Decision struct {
 	Action      types.Action
 	Explanation string
+	// Plan is the simulated schedule the action was chosen from. It has no
+	// steps if the controller didn't simulate.
+	Plan types.Plan
 }
 
 // Controller handles the decision-making logic for the ESS.
 type Controller struct {
+	now func() time.Time
 }
 
 // NewController creates a new Controller.
 func NewController() *Controller {
-	return &Controller{}
+	return &Controller{now: time.Now}
+}
+
+// SetClock changes what the controller considers the current time, such as
+// when replaying history.
+func (c *Controller) SetClock(now func() time.Time) {
+	c.now = now
 }
 
 // Decide determines the best action to take based on current state and history.
+// It finds the minimum cost charge/discharge/standby plan over the planning
+// horizon, in intervals as short as the prices allow, and returns the mode for the
+// current interval from that plan. Solar production comes from solarForecast
+// when it covers an hour, otherwise from the historical average. Home load
+// comes from the LoadModel built from history. recentActions are used to stay
+// in the current mode for MinModeDwellMinutes and to only switch modes when it
+// beats staying by ModeHysteresisDollarsPerKWH.
 func (c *Controller) Decide(
 	ctx context.Context,
 	currentStatus types.SystemStatus,
 	currentPrice types.Price,
 	futurePrices []types.Price,
 	history []types.EnergyStats,
+	solarForecast []types.SolarForecast,
+	recentActions []types.Action,
 	settings types.Settings,
 ) (Decision, error) {
 	slog.DebugContext(ctx, "controller decide started",
@@ -44,23 +66,58 @@ func (c *Controller) Decide(
 	)
 
 	now := time.Now()
+	if c.now != nil {
+		now = c.now()
+	}
 	// Build Energy Model
-	model := c.buildHourlyEnergyModel(ctx, history, settings.IgnoreHourUsageOverMultiple)
+	model := c.buildHourlyEnergyModel(ctx, history, now)
+	prior := clearSkySolarPrior(ctx, history, settings)
+	loadModel := BuildLoadModel(history, now, settings)
+	lastMode, lastModeSince := activeMode(recentActions)
 
 	solarMode := types.SolarModeAny
 	if !settings.GridExportSolar {
 		solarMode = types.SolarModeNoExport
 	}
 
-	// Rule 1: If the price is negative, then don't export anything to the grid.
-	if currentPrice.DollarsPerKWH < 0 {
+	// Rule 1: If the export price is negative, then don't export anything to the
+	// grid.
+	if exportPrice := settings.ExportPrice(currentPrice); exportPrice < 0 {
 		solarMode = types.SolarModeNoExport
-		slog.DebugContext(ctx, "price is negative, disabling solar export", slog.Float64("price", currentPrice.DollarsPerKWH))
+		slog.DebugContext(ctx, "export price is negative, disabling solar export", slog.Float64("price", exportPrice))
 		// We do NOT return here. We fall through to allow charging logic to trigger.
 	}
 
-	// Helper to determine final action with "No Change" optimizations
-	finalizeAction := func(batteryMode types.BatteryMode, modeReason string, explanation string) Decision {
+	// filled in once the plan is optimized
+	var planSteps []types.PlanStep
+	var planCost float64
+
+	// Helper to determine final action with "No Change" optimizations. Unless
+	// the mode is needed for safety, switching modes is suppressed until we've
+	// been in the current mode for MinModeDwellMinutes.
+	finalizeAction := func(batteryMode types.BatteryMode, modeReason string, explanation string, safety bool) Decision {
+		dwell := time.Duration(settings.MinModeDwellMinutes) * time.Minute
+		if !safety && dwell > 0 && lastMode != types.BatteryModeNoChange && batteryMode != lastMode {
+			if inMode := now.Sub(lastModeSince); inMode < dwell {
+				slog.DebugContext(
+					ctx,
+					"suppressing mode switch during dwell time",
+					slog.String("mode", lastMode.String()),
+					slog.String("wanted", batteryMode.String()),
+					slog.Duration("inMode", inMode),
+				)
+				modeReason = fmt.Sprintf(
+					"Switch to %s suppressed, staying in %s for %s more: %s",
+					batteryMode,
+					lastMode,
+					(dwell - inMode).Round(time.Minute),
+					modeReason,
+				)
+				explanation = "Minimum Dwell Time"
+				batteryMode = lastMode
+			}
+		}
+
 		finalBatMode := batteryMode
 		switch batteryMode {
 		case types.BatteryModeChargeAny:
@@ -134,7 +191,15 @@ func (c *Controller) Decide(
 			)
 			// if the minimum SOC is not elevated then we're already using the battery
 			// as much as possible
-			if !currentStatus.ElevatedMinBatterySOC && (!settings.GridChargeBatteries || currentStatus.CanImportBattery) {
+			// also make sure we aren't still exporting the battery from a previous
+			// export
+			if !currentStatus.ElevatedMinBatterySOC && (!settings.GridChargeBatteries || currentStatus.CanImportBattery) && (!settings.GridExportBatteries || !currentStatus.CanExportBattery) {
+				finalBatMode = types.BatteryModeNoChange
+			}
+		case types.BatteryModeExport:
+			// if the minimum SOC is not elevated and the battery can already feed the
+			// grid then we're already exporting as much as possible
+			if !currentStatus.ElevatedMinBatterySOC && currentStatus.CanExportBattery && !currentStatus.CanImportBattery {
 				finalBatMode = types.BatteryModeNoChange
 			}
 		default:
@@ -156,40 +221,28 @@ func (c *Controller) Decide(
 			// nothing to do
 		}
 
+		action := types.Action{
+			Timestamp:    now,
+			BatteryMode:  finalBatMode,
+			SolarMode:    finalSolarMode,
+			Description:  modeReason,
+			CurrentPrice: currentPrice,
+		}
 		return Decision{
-			Action: types.Action{
-				Timestamp:    now,
-				BatteryMode:  finalBatMode,
-				SolarMode:    finalSolarMode,
-				Description:  modeReason,
-				CurrentPrice: currentPrice,
-			},
+			Action:      action,
 			Explanation: explanation,
+			Plan: types.Plan{
+				Timestamp: now,
+				Action:    action,
+				Steps:     planSteps,
+				Cost:      planCost,
+			},
 		}
 	}
 
-	// Rule 2: If the price is below the Always Charge Threshold, then charge the
-	// battery.
-	if currentPrice.DollarsPerKWH < settings.AlwaysChargeUnderDollarsPerKWH {
-		desc := fmt.Sprintf(
-			"Price Low (%.3f < %.3f). Charging.",
-			currentPrice.DollarsPerKWH,
-			settings.AlwaysChargeUnderDollarsPerKWH,
-		)
-		if solarMode == types.SolarModeNoExport {
-			desc += " (Export Disabled due to Negative Price)"
-		}
-		// If negative, we charge.
-		slog.DebugContext(ctx, "price below always charge threshold", slog.Float64("price", currentPrice.DollarsPerKWH), slog.Float64("threshold", settings.AlwaysChargeUnderDollarsPerKWH))
-		return finalizeAction(types.BatteryModeChargeAny, desc, "Always Charge Threshold"), nil
-	}
-
-	// Rule 3: Charge now if its cheaper than later, if we will run out of energy
-	// or if we can make more money buying now and selling later (arbitrage)
-
 	capacityKWH := currentStatus.BatteryCapacityKWH
 	if capacityKWH <= 0 {
-		return finalizeAction(types.BatteryModeStandby, "Battery Config Missing or Capacity 0. Standby.", "Zero Battery Capacity"), nil
+		return finalizeAction(types.BatteryModeStandby, "Battery Config Missing or Capacity 0. Standby.", "Zero Battery Capacity", true), nil
 	}
 
 	currentSOC := currentStatus.BatterySOC
@@ -201,264 +254,414 @@ func (c *Controller) Decide(
 		chargeKW = capacityKWH / 3.0
 	}
 
-	type simHour struct {
-		ts             time.Time
-		hour           int
-		netLoadSolar   float64
-		gridChargeCost float64
-		solarOppCost   float64
-	}
-
-	// simulate our energy state and prices for the next 24 hours
-	simData := make([]simHour, 0, 24)
+	// simulate our energy state and prices over the planning horizon using the
+	// shortest interval the prices are given in
+	horizon := settings.PlanningHorizon()
+	interval := priceInterval(futurePrices)
+	simData := make([]simSlot, 0, int(horizon/interval)+1)
 
-	// We simulate starting from the *next* hour usually, but we need to cover "Now".
-	// Let's create a timeline of prices per hour for the next 24 hours.
-	// TODO: support non-hourly prices
+	// We simulate starting from *now* through the end of the current interval
+	// and then interval by interval until the end of the horizon.
 
 	// helper to find price at time t
-	getPriceAt := func(t time.Time) float64 {
-		for _, fp := range futurePrices {
-			if fp.TSStart.Truncate(time.Hour).Equal(t.Truncate(time.Hour)) {
-				return fp.DollarsPerKWH
-			}
+	getPriceAt := func(t time.Time) types.Price {
+		if price, ok := priceAt(futurePrices, t); ok {
+			return price
 		}
-		// default to current price if no future price found
-		// TODO: use historical price from last 72 hours
-		return currentPrice.DollarsPerKWH
+		// default to current price if no future or forecasted price found
+		return currentPrice
 	}
 
 	// build our simulation timeline
-	todaySolarTrend := c.calculateSolarTrend(ctx, history, model)
-	slog.DebugContext(ctx, "solar trend calculated", slog.Float64("trend", todaySolarTrend))
+	todaySolarTrend := c.calculateSolarTrend(ctx, history, model, prior, now)
+	slog.DebugContext(
+		ctx,
+		"solar trend calculated",
+		slog.Float64("trend", todaySolarTrend),
+		slog.Duration("interval", interval),
+	)
 
 	maxFuturePrice := currentPrice.DollarsPerKWH
 
 	simTime := now
-	for i := 0; i < 24; i++ {
-		h := simTime.Hour()
-		price := getPriceAt(simTime)
+	end := now.Add(horizon)
+	// the recent solar trend only says something about the next day of weather
+	trendEnd := now.Add(24 * time.Hour)
+	for simTime.Before(end) {
+		slotEnd := simTime.Truncate(interval).Add(interval)
+		if slotEnd.After(end) {
+			slotEnd = end
+		}
+
+		slotPrice := currentPrice
+		if simTime != now {
+			slotPrice = getPriceAt(simTime)
+		}
+		price := slotPrice.DollarsPerKWH
 		if price > maxFuturePrice {
 			maxFuturePrice = price
 		}
-		solarOppCost := price
+		// grid energy is charged for its emissions and exports are credited for
+		// the emissions they displace
+		carbonCost := settings.CarbonCost(slotPrice)
+		// we can't export when the export price is negative and there's no
+		// value in exporting if we're not allowed to
+		exportValue := math.Max(0, settings.ExportPrice(slotPrice)) + carbonCost
+		batteryExportValue := exportValue
 		if !settings.GridExportSolar {
-			solarOppCost = 0
+			exportValue = 0
 		}
 
-		profile := model[h]
-		predictedAvgSolar := profile.AvgSolar * todaySolarTrend
+		predictedAvgSolar := solarAt(model, prior, simTime)
+		if simTime.Before(trendEnd) {
+			predictedAvgSolar *= todaySolarTrend
+		}
+		if kwh, ok := solarForecastAt(solarForecast, simTime); ok {
+			predictedAvgSolar = kwh
+		}
+		duration := slotEnd.Sub(simTime)
 
-		netLoadSolar := profile.AvgHomeLoad - predictedAvgSolar
+		peakPrice := slotPrice
+		if simTime == now && peakPrice.GridLoadMW == nil {
+			// the current price doesn't come with a load forecast
+			if p, ok := priceAt(futurePrices, now); ok {
+				peakPrice.GridLoadMW = p.GridLoadMW
+			}
+		}
 
-		// if we're in the "now" hour, scale the load by the current minute
-		if i == 0 {
-			netLoadSolar *= (float64(now.Minute()) / 60.0)
+		slot := simSlot{
+			ts:                 simTime,
+			duration:           duration,
+			netLoadKWH:         (loadModel.At(simTime) - predictedAvgSolar) * duration.Hours(),
+			importCost:         settings.ImportPrice(slotPrice) + carbonCost,
+			exportValue:        exportValue,
+			batteryExportValue: batteryExportValue,
+			forceCharge:        price < settings.AlwaysChargeUnderDollarsPerKWH,
+			capacityPeak:       capacityPeakReason(simTime, peakPrice, settings),
+		}
+		if slot.capacityPeak != "" {
+			// importing during a peak raises the capacity charge and charging
+			// now would only make it worse
+			slot.importCost += capacityPeakPenalty(settings)
+			slot.forceCharge = false
+		}
+		if simTime == now {
+			// keep charging until the price is clearly over the threshold, unless
+			// it's a capacity peak
+			if lastMode == types.BatteryModeChargeAny && settings.AlwaysChargeUnderDollarsPerKWH > 0 && slot.capacityPeak == "" {
+				slot.forceCharge = price < settings.AlwaysChargeUnderDollarsPerKWH+settings.ModeHysteresisDollarsPerKWH
+			}
+			slot.currentMode = optimizerMode(lastMode)
+			slot.switchPenalty = settings.ModeHysteresisDollarsPerKWH
 		}
+		simData = append(simData, slot)
+		simTime = slotEnd
+	}
+
+	// the battery should be full when a capacity peak starts
+	targets := append(append([]types.SOCTarget(nil), settings.SOCTargets...), capacityPeakTargets(simData)...)
+	socDeadlines := applySOCTargets(simData, targets, capacityKWH, settings.Location())
 
-		simData = append(simData, simHour{
-			ts:             simTime,
-			hour:           h,
-			netLoadSolar:   netLoadSolar,
-			gridChargeCost: price + settings.AdditionalFeesDollarsPerKWH,
-			solarOppCost:   solarOppCost,
-		})
-		simTime = simTime.Add(1 * time.Hour)
+	// leftover energy at the end of the timeline is worth what it would cost to
+	// charge it again at the cheapest time
+	terminalPerKWH := math.Inf(1)
+	for _, slot := range simData {
+		terminalPerKWH = math.Min(terminalPerKWH, slot.importCost)
 	}
 
-	chargeNowCost := currentPrice.DollarsPerKWH + settings.AdditionalFeesDollarsPerKWH
-	shouldCharge := false
-	chargeReason := ""
+	battery := batteryModel{
+		capacityKWH: capacityKWH,
+		minKWH:      minKWH,
+		chargeKW:    chargeKW,
+		dischargeKW: currentStatus.MaxBatteryDischargeKW,
+		gridCharge:  settings.GridChargeBatteries,
+		// only charge from the grid if it's worth at least the minimum
+		// arbitrage difference
+		chargeHurdle: settings.MinArbitrageDifferenceDollarsPerKWH,
+		// only export the battery if we can and it's worth at least the minimum
+		// arbitrage difference over keeping the energy
+		gridExport:          settings.GridExportBatteries,
+		exportHurdle:        settings.MinArbitrageDifferenceDollarsPerKWH,
+		roundTripEfficiency: settings.BatteryRoundTripEfficiency / 100,
+		degradationPerKWH:   settings.BatteryDegradationDollarsPerKWH,
+		maxImportKW:         settings.MaxGridUseKW,
+		// going over the limit should cost more than any price difference
+		peakPenaltyPerKW: math.Max(settings.DemandChargeDollarsPerKW, maxGridUsePenaltyPerKW),
+	}
+	if settings.MaxBatteryCyclesPerDay > 0 && len(simData) > 0 {
+		last := simData[len(simData)-1]
+		horizon := last.ts.Add(last.duration).Sub(simData[0].ts)
+		battery.maxDischargeKWH = settings.MaxBatteryCyclesPerDay * capacityKWH * horizon.Hours() / 24
+	}
+	// stored energy is only worth what it delivers after losses and wear
+	_, dischargeEff := battery.efficiencies()
+	battery.terminalPerKWH = math.Max(0, terminalPerKWH*dischargeEff-battery.degradationPerKWH)
 
-	// track simulated energy
-	simEnergy := availableKWH
-	hitCapacity := simEnergy >= capacityKWH
+	// simulate only using the battery to see if we would run out of energy
 	hitDeficit := false
+	var deficitAmount float64
+	deficitIndex := -1
 	minEnergy := availableKWH
 	maxEnergy := availableKWH
-
-	// track the costs to charge until/including the simulated hour
-	chargeCosts := make([]float64, 0, len(simData))
-
-	for _, slot := range simData {
-		chargeCosts = append(chargeCosts, slot.gridChargeCost)
-
-		netLoadSolar := slot.netLoadSolar
-
-		// update simulated energy state
-		if slot.netLoadSolar > 0 {
-			// make sure we don't simulate discharging more than we can
-			if currentStatus.MaxBatteryDischargeKW > 0 && netLoadSolar > currentStatus.MaxBatteryDischargeKW {
-				netLoadSolar = currentStatus.MaxBatteryDischargeKW
-			}
-			// Load > Solar: We consume battery
-			simEnergy -= netLoadSolar
-		} else {
-			// Solar > Load: We charge battery
-			// make sure we don't simulate charging more than we can
-			if currentStatus.MaxBatteryChargeKW > 0 && -netLoadSolar > currentStatus.MaxBatteryChargeKW {
-				netLoadSolar = -currentStatus.MaxBatteryChargeKW
-			}
-			simEnergy += (-netLoadSolar)
-			if simEnergy > capacityKWH {
-				simEnergy = capacityKWH
-			}
-			// if we ever hit the capacity of the battery, we can't store any more power
-			// so we set hitCapacity to true so we never try to charge since that power
-			// would be meaningless to pull from the grid since we end up filling up
-			// the batteries without the grid in the simulation anyways
-			if simEnergy >= capacityKWH {
-				if !hitCapacity {
+	// the first SOC target we would miss by only using the battery
+	targetIndex := -1
+	var targetShortfall float64
+	{
+		simEnergy := availableKWH
+		for i, slot := range simData {
+			out := battery.simulate(slot, types.BatteryModeLoad, simEnergy)
+			simEnergy = out.endKWH
+			minEnergy = math.Min(minEnergy, simEnergy)
+			maxEnergy = math.Max(maxEnergy, simEnergy)
+			shortfall := math.Max(0, slot.netLoadKWH) - out.batteryUseKWH
+			if shortfall > 0.001 && simEnergy <= minKWH+0.001 {
+				if !hitDeficit {
 					slog.DebugContext(
 						ctx,
-						"simulated energy hit capacity",
+						"simulated energy below minimum SOC",
 						slog.Float64("simEnergy", simEnergy),
-						slog.Float64("capacityKWH", capacityKWH),
-						slog.Int("simHour", slot.hour),
+						slog.Float64("minKWH", minKWH),
+						slog.Time("simTime", slot.ts),
 					)
+					deficitIndex = i
 				}
-				hitCapacity = true
+				hitDeficit = true
+				deficitAmount += shortfall
+			}
+			if targetIndex < 0 && slot.minEndKWH-simEnergy > 0.001 {
+				targetIndex = i
+				targetShortfall = slot.minEndKWH - simEnergy
 			}
 		}
+	}
+
+	// find the minimum cost plan for the whole timeline
+	// the optimizer that produced the plan values its stored energy since a
+	// discharge limit penalizes discharging
+	plan, opt := newOptimizer(battery, simData).limitDischarge(availableKWH)
+	for _, p := range plan {
+		planCost += p.cost
+	}
+	planSteps = opt.planSteps(plan)
+	current := plan[0]
+	slog.DebugContext(
+		ctx,
+		"optimized plan",
+		slog.Int("slots", len(plan)),
+		slog.Float64("planCost", planCost),
+		slog.Int("currentMode", int(current.mode)),
+		slog.Bool("hitDeficit", hitDeficit),
+		slog.Float64("deficit", deficitAmount),
+	)
+
+	chargeNowCost := current.importCost
 
-		if simEnergy < minEnergy {
-			minEnergy = simEnergy
+	// Rule 2: If the price is below the Always Charge Threshold, then charge the
+	// battery.
+	if current.forceCharge {
+		desc := fmt.Sprintf(
+			"Price Low (%.3f < %.3f). Charging.",
+			currentPrice.DollarsPerKWH,
+			settings.AlwaysChargeUnderDollarsPerKWH,
+		)
+		if currentPrice.DollarsPerKWH >= settings.AlwaysChargeUnderDollarsPerKWH {
+			desc = fmt.Sprintf(
+				"Price Near Threshold (%.3f < %.3f + %.3f hysteresis). Still Charging.",
+				currentPrice.DollarsPerKWH,
+				settings.AlwaysChargeUnderDollarsPerKWH,
+				settings.ModeHysteresisDollarsPerKWH,
+			)
 		}
-		if simEnergy > maxEnergy {
-			maxEnergy = simEnergy
+		if solarMode == types.SolarModeNoExport {
+			desc += " (Export Disabled due to Negative Price)"
 		}
+		slog.DebugContext(ctx, "price below always charge threshold", slog.Float64("price", currentPrice.DollarsPerKWH), slog.Float64("threshold", settings.AlwaysChargeUnderDollarsPerKWH))
+		return finalizeAction(types.BatteryModeChargeAny, desc, "Always Charge Threshold", false), nil
+	}
 
-		// check if we are below the minimum SOC and when we need to charge
-		if simEnergy < minKWH {
-			if !hitDeficit {
-				slog.DebugContext(
-					ctx,
-					"simulated energy below minimum SOC",
-					slog.Float64("simEnergy", simEnergy),
-					slog.Float64("minKWH", minKWH),
-					slog.Int("simHour", slot.hour),
-				)
+	// Rule 3: Export the battery if the plan says the price now beats what the
+	// stored energy is worth later plus the minimum arbitrage difference. The
+	// optimizer never plans below the minimum SOC or leaves us short later.
+	if current.mode == types.BatteryModeExport {
+		storedValue := opt.storedValue(1, current.endKWH)
+		desc := fmt.Sprintf(
+			"Exporting Battery: Price %.3f beats stored energy value %.3f + margin %.3f.",
+			current.batteryExportValue,
+			storedValue,
+			settings.MinArbitrageDifferenceDollarsPerKWH,
+		)
+		slog.DebugContext(
+			ctx,
+			"exporting battery to grid",
+			slog.Float64("exportPrice", current.batteryExportValue),
+			slog.Float64("storedValue", storedValue),
+			slog.Float64("exportKWH", current.batteryExportKWH),
+		)
+		return finalizeAction(types.BatteryModeExport, desc, "Battery Export", false), nil
+	}
+
+	// Rule 4: Charge now if the plan says it's cheaper than later, either because
+	// we will run out of energy or because we can make more money buying now and
+	// using or selling later (arbitrage)
+	if current.mode == types.BatteryModeChargeAny {
+		var chargeReason string
+		if targetIndex >= 0 && (!hitDeficit || targetIndex <= deficitIndex) {
+			// the best alternative is the cheapest time to charge before the
+			// deadline
+			target := socDeadlines[targetIndex]
+			bestAlt := math.Inf(1)
+			for _, slot := range simData[1 : targetIndex+1] {
+				bestAlt = math.Min(bestAlt, slot.importCost)
+			}
+			if math.IsInf(bestAlt, 1) {
+				bestAlt = chargeNowCost
 			}
-			hitDeficit = true
-			deficitAmount := minKWH - simEnergy
-
-			// only consider charging if GridCharging is enabled
-			if settings.GridChargeBatteries {
-				sort.Float64s(chargeCosts)
-				var cheapestChargeCost float64
-
-				// factor in the cost of charging for the duration of the charge which
-				// means we need to look at the nth cheapest charge cost
-				// round up the hours we need to charge except for a little buffer
-				chargeDurationHours := max(1, int((float64(deficitAmount)/chargeKW + 0.84)))
-				if chargeDurationHours > len(chargeCosts) {
-					cheapestChargeCost = chargeCosts[len(chargeCosts)-1]
-				} else {
-					cheapestChargeCost = chargeCosts[chargeDurationHours-1]
+			name := target.target.Name
+			if name == "" {
+				name = "SOC Target"
+			}
+			desc := fmt.Sprintf(
+				"Charging for %s: %.0f%% by %s needs %.2fkWh more. ChargeNow (%.3f) <= BestAlt (%.3f).",
+				name,
+				target.target.SOC,
+				target.deadline.Format(time.Kitchen),
+				targetShortfall,
+				chargeNowCost,
+				bestAlt,
+			)
+			slog.DebugContext(
+				ctx,
+				"charging to meet soc target",
+				slog.String("target", name),
+				slog.Time("deadline", target.deadline),
+				slog.Float64("shortfall", targetShortfall),
+				slog.Float64("chargeCost", chargeNowCost),
+				slog.Float64("cheapestFutureCost", bestAlt),
+			)
+			return finalizeAction(types.BatteryModeChargeAny, desc, "SOC Target", false), nil
+		}
+		if hitDeficit {
+			// the best alternative is the cheapest time to charge between now and
+			// when we run out
+			bestAlt := math.Inf(1)
+			for _, slot := range simData[1 : deficitIndex+1] {
+				bestAlt = math.Min(bestAlt, slot.importCost)
+			}
+			if math.IsInf(bestAlt, 1) {
+				bestAlt = chargeNowCost
+			}
+			chargeReason = fmt.Sprintf("Projected Deficit of %.2fkWh at %s. ChargeNow (%.3f) <= BestAlt (%.3f).", deficitAmount, simData[deficitIndex].ts.Format(time.Kitchen), chargeNowCost, bestAlt)
+			slog.DebugContext(
+				ctx,
+				"deficit predicted, charging now",
+				slog.Float64("deficit", deficitAmount),
+				slog.Float64("chargeCost", chargeNowCost),
+				slog.Float64("cheapestFutureCost", bestAlt),
+			)
+		} else {
+			// find the most valuable time the plan uses the stored energy
+			sellAt := plan[len(plan)-1]
+			var value float64
+			for _, p := range plan[1:] {
+				if p.batteryUseKWH > 0 && p.importCost > value {
+					value = p.importCost
+					sellAt = p
 				}
-
-				// if we have determined we'll run out of energy and it's cheaper to
-				// charge now than later, charge now
-				if chargeNowCost <= cheapestChargeCost {
-					shouldCharge = true
-					chargeReason = fmt.Sprintf("Projected Deficit of %.2fkWh at %s. ChargeNow (%.3f) <= BestAlt (%.3f).", deficitAmount, slot.ts.Format(time.Kitchen), chargeNowCost, cheapestChargeCost)
-					slog.DebugContext(
-						ctx,
-						"deficit predicted, charging now",
-						slog.Float64("deficit", deficitAmount),
-						slog.Float64("chargeCost", chargeNowCost),
-						slog.Float64("cheapestFutureCost", cheapestChargeCost),
-					)
-					break
-				} else {
-					slog.DebugContext(
-						ctx,
-						"deficit predicted, charging later",
-						slog.Float64("deficit", deficitAmount),
-						slog.Float64("chargeCost", chargeNowCost),
-						slog.Float64("cheapestFutureCost", cheapestChargeCost),
-						slog.Int("chargeDurationHours", chargeDurationHours),
-					)
+				if p.gridExportKWH > 0 && p.exportValue > value {
+					value = p.exportValue
+					sellAt = p
 				}
 			}
+			chargeReason = fmt.Sprintf("Arbitrage Opportunity at %s. Buy@%.3f -> Sell/Save@%.3f.", sellAt.ts.Format(time.Kitchen), chargeNowCost, value)
+			slog.DebugContext(
+				ctx,
+				"arbitrage opportunity found",
+				slog.Float64("buyAt", chargeNowCost),
+				slog.Float64("sellAt", value),
+				slog.Float64("diff", value-chargeNowCost),
+			)
 		}
+		desc := fmt.Sprintf("Charging Optimized: %s", chargeReason)
+		return finalizeAction(types.BatteryModeChargeAny, desc, "Simulation Optimized Charge", false), nil
+	}
 
-		// at this point it's opportunity cost because we either have enough energy
-		// or it'll be cheaper later to charge
-
-		// assume we need to charge for at least 10 minutes for it to be worth it
-		chargeDurationHours := 10.0 / 60.0
-		simEnergyAfterCharge := simEnergy + chargeKW*chargeDurationHours
-
-		// make sure we can charge the batteries, we can export solar, and we have
-		// enough headroom to charge
-		if settings.GridChargeBatteries && settings.GridExportSolar && simEnergyAfterCharge < capacityKWH && !hitCapacity {
-			var value float64
-			// if we are importing, we avoid the import cost
-			// if we are exporting, we get the export value
-			if slot.netLoadSolar > 0 {
-				value = slot.gridChargeCost
-			} else {
-				value = slot.solarOppCost
-			}
+	// Rule 4b: Cut grid import as much as we can during a predicted capacity
+	// peak since it sets the capacity charge for the next year.
+	if current.capacityPeak != "" && current.mode == types.BatteryModeLoad && availableKWH > minKWH {
+		standby := battery.simulate(current.simSlot, types.BatteryModeStandby, current.startKWH)
+		avoidedKW := math.Max(0, standby.gridImportKWH-current.gridImportKWH) / current.hours()
+		savings := avoidedKW * settings.CapacityChargeDollarsPerKW / capacityPeaksPerYear
+		desc := fmt.Sprintf(
+			"Capacity Peak Predicted (%s): Using battery to cut grid import by %.1fkW, saving $%.2f/yr if this is a peak hour.",
+			current.capacityPeak,
+			avoidedKW,
+			savings,
+		)
+		slog.InfoContext(
+			ctx,
+			"capacity peak predicted",
+			slog.String("reason", current.capacityPeak),
+			slog.Float64("avoidedKW", avoidedKW),
+			slog.Float64("plcSavings", savings),
+		)
+		return finalizeAction(types.BatteryModeLoad, desc, "Capacity Peak", true), nil
+	}
 
-			// if the value we get later minus our cost to charge now is greater than
-			// the minimum arbitrage difference, we should charge now
-			if value-chargeNowCost > settings.MinArbitrageDifferenceDollarsPerKWH {
-				shouldCharge = true
-				chargeReason = fmt.Sprintf("Arbitrage Opportunity at %s. Buy@%.3f -> Sell/Save@%.3f.", slot.ts.Format(time.Kitchen), chargeNowCost, value)
-				slog.DebugContext(
-					ctx,
-					"arbitrage opportunity found",
-					slog.Float64("buyAt", chargeNowCost),
-					slog.Float64("sellAt", value),
-					slog.Float64("diff", value-chargeNowCost),
-				)
-				break
-			} else {
-				slog.DebugContext(
-					ctx,
-					"arbitrage opportunity too small",
-					slog.Float64("buyAt", chargeNowCost),
-					slog.Float64("sellAt", value),
-					slog.Float64("minDiff", settings.MinArbitrageDifferenceDollarsPerKWH),
-				)
-			}
+	// Rule 5: Shave the peak if the home is pulling more than the grid limit
+	// right now or is expected to in this interval. Charging is already capped
+	// to stay under the limit.
+	if battery.maxImportKW > 0 && current.mode != types.BatteryModeChargeAny && availableKWH > minKWH {
+		standby := battery.simulate(current.simSlot, types.BatteryModeStandby, current.startKWH)
+		importKW := math.Max(currentStatus.HomeKW-currentStatus.SolarKW, standby.gridImportKWH/current.hours())
+		if importKW > battery.maxImportKW {
+			desc := fmt.Sprintf("Shaving Peak: Grid use %.1fkW above limit %.1fkW.", importKW, battery.maxImportKW)
+			slog.DebugContext(
+				ctx,
+				"shaving peak",
+				slog.Float64("importKW", importKW),
+				slog.Float64("maxGridUseKW", battery.maxImportKW),
+			)
+			return finalizeAction(types.BatteryModeLoad, desc, "Peak Shaving", true), nil
 		}
 	}
 
-	// if we should charge, return now.
-	if shouldCharge {
-		desc := fmt.Sprintf("Charging Optimized: %s", chargeReason)
-		return finalizeAction(types.BatteryModeChargeAny, desc, "Simulation Optimized Charge"), nil
-	}
+	// Rule 6: Logic for Battery Usage vs Standby
+	// If the plan holds the battery now, it's saving it for a more expensive time.
+	// Otherwise, use it (Load).
 
-	// Rule 4: Logic for Battery Usage vs Standby
-	// If we have plenty of battery (no deficit), Use it (Load).
-	// If we have a deficit, but we are at the Highest Price, Use it (Load).
-	// If we have a deficit, and cheaper now than later, Standby (Save for later).
+	if current.mode == types.BatteryModeStandby {
+		slog.DebugContext(
+			ctx,
+			"saving battery for peak",
+			slog.Float64("currentPrice", currentPrice.DollarsPerKWH),
+			slog.Float64("maxFuturePrice", maxFuturePrice),
+			slog.Bool("hitDeficit", hitDeficit),
+		)
+		if hitDeficit {
+			standbyReason := fmt.Sprintf("Deficit predicted and higher prices later (%.3f < %.3f).", currentPrice.DollarsPerKWH, maxFuturePrice)
+			return finalizeAction(types.BatteryModeStandby, standbyReason, "Deficit + Save for Peak", false), nil
+		}
+		standbyReason := fmt.Sprintf("Saving battery for higher prices later (%.3f < %.3f).", currentPrice.DollarsPerKWH, maxFuturePrice)
+		return finalizeAction(types.BatteryModeStandby, standbyReason, "Save for Peak", false), nil
+	}
 
 	if hitDeficit {
-		// We are going to run out. Should we save it?
-		// Check if there is a significantly more expensive time later.
-		// If current price is lower than maxFuturePrice, we should probably save it.
-		if currentPrice.DollarsPerKWH < maxFuturePrice {
-			standbyReason := fmt.Sprintf("Deficit predicted and higher prices later (%.3f < %.3f).", currentPrice.DollarsPerKWH, maxFuturePrice)
+		if currentPrice.DollarsPerKWH >= maxFuturePrice {
+			// If we are at the peak (or flat), use it until empty.
 			slog.DebugContext(
 				ctx,
-				"deficit predicted, saving for peak",
+				"deficit predicted but at peak price",
 				slog.Float64("currentPrice", currentPrice.DollarsPerKWH),
-				slog.Float64("maxFuturePrice", maxFuturePrice),
 			)
-			return finalizeAction(types.BatteryModeStandby, standbyReason, "Deficit + Save for Peak"), nil
+			return finalizeAction(types.BatteryModeLoad, "Deficit predicted but Current Price is Peak.", "Use Battery at Peak", false), nil
 		}
-		// If we are at the peak (or flat), use it until empty.
 		slog.DebugContext(
 			ctx,
-			"deficit predicted but at peak price",
+			"deficit predicted but enough battery for peak",
 			slog.Float64("currentPrice", currentPrice.DollarsPerKWH),
+			slog.Float64("maxFuturePrice", maxFuturePrice),
 		)
-		return finalizeAction(types.BatteryModeLoad, "Deficit predicted but Current Price is Peak.", "Use Battery at Peak"), nil
+		return finalizeAction(types.BatteryModeLoad, "Deficit predicted but Battery covers Peak.", "Use Battery", false), nil
 	}
 
 	// No deficit predicted, use battery.
@@ -468,34 +671,32 @@ func (c *Controller) Decide(
 		slog.Float64("minEnergy", minEnergy),
 		slog.Float64("maxEnergy", maxEnergy),
 	)
-	return finalizeAction(types.BatteryModeLoad, "Sufficient Battery.", "Sufficient Battery"), nil
+	return finalizeAction(types.BatteryModeLoad, "Sufficient Battery.", "Sufficient Battery", false), nil
 }
 
 type timeProfile struct {
-	Hour        int
-	AvgSolar    float64
-	AvgHomeLoad float64
+	Hour     int
+	AvgSolar float64
+	// Samples is the number of days of history averaged
+	Samples int
 }
 
-// buildHourlyEnergyModel averages usage and solar by hour of day from history.
-// It filters out outliers if ignoreHourUsageOverMultiple is set and > 0.
-func (c *Controller) buildHourlyEnergyModel(_ context.Context, history []types.EnergyStats, ignoreHourUsageOverMultiple float64) map[int]timeProfile {
-	type dataPoint struct {
-		solar float64
-		load  float64
-	}
-	hourlyData := make(map[int][]dataPoint)
+// solarHistoryWindow is how far back history is used to average solar since
+// production changes with the seasons and the weather.
+const solarHistoryWindow = 72 * time.Hour
+
+// buildHourlyEnergyModel averages solar by hour of day from the history within
+// solarHistoryWindow of now.
+func (c *Controller) buildHourlyEnergyModel(_ context.Context, history []types.EnergyStats, now time.Time) map[int]timeProfile {
+	hourlyData := make(map[int][]float64)
 
 	// Regroup history by hour
 	for _, h := range history {
-		if h.TSHourStart.IsZero() {
+		if h.TSHourStart.IsZero() || now.Sub(h.TSHourStart) > solarHistoryWindow {
 			continue
 		}
 		hour := h.TSHourStart.Hour()
-		hourlyData[hour] = append(hourlyData[hour], dataPoint{
-			solar: h.SolarKWH,
-			load:  h.HomeKWH,
-		})
+		hourlyData[hour] = append(hourlyData[hour], h.SolarKWH)
 	}
 
 	result := make(map[int]timeProfile)
@@ -504,77 +705,26 @@ func (c *Controller) buildHourlyEnergyModel(_ context.Context, history []types.E
 			continue
 		}
 
-		validPoints := points
-		if len(points) >= 3 && ignoreHourUsageOverMultiple > 0 {
-			// Find outliers by calculating average of ALL OTHER points and if
-			// point > avg(others) * multiple, it's an outlier but only exclude if there
-			// is EXACTLY ONE such point.
-
-			var outliers []int // indices
-			for i, p := range points {
-				// Calculate average of others
-				var sumOtherLoad float64
-				for j, other := range points {
-					if i == j {
-						continue
-					}
-					sumOtherLoad += other.load
-				}
-
-				if len(points) > 1 {
-					avgOtherLoad := sumOtherLoad / float64(len(points)-1)
-					if p.load > avgOtherLoad*ignoreHourUsageOverMultiple {
-						outliers = append(outliers, i)
-					}
-				}
-			}
-
-			if len(outliers) == 1 {
-				// We found exactly one outlier, ignore it
-				slog.Debug("ignoring outlier data point",
-					slog.Int("hour", h),
-					slog.Float64("outlier_load", points[outliers[0]].load),
-					slog.Float64("solar", points[outliers[0]].solar),
-				)
-				// Rebuild valid points excluding this one
-				validPoints = make([]dataPoint, 0, len(points)-1)
-				for i, p := range points {
-					if i != outliers[0] {
-						validPoints = append(validPoints, p)
-					}
-				}
-			} else if len(outliers) > 1 {
-				slog.Debug("ignoring multiple outlier data points",
-					slog.Int("hour", h),
-					slog.Int("outliers", len(outliers)),
-					slog.Int("points", len(points)),
-				)
-			}
-		}
-
-		// Now calculate averages from valid points
-		var totalSolar, totalLoad float64
-		for _, p := range validPoints {
-			totalSolar += p.solar
-			totalLoad += p.load
+		var totalSolar float64
+		for _, p := range points {
+			totalSolar += p
 		}
-		count := float64(len(validPoints))
 
 		result[h] = timeProfile{
-			Hour:        h,
-			AvgSolar:    totalSolar / count,
-			AvgHomeLoad: totalLoad / count,
+			Hour:     h,
+			AvgSolar: totalSolar / float64(len(points)),
+			Samples:  len(points),
 		}
 	}
 	return result
 }
 
-func (c *Controller) calculateSolarTrend(ctx context.Context, history []types.EnergyStats, model map[int]timeProfile) float64 {
+func (c *Controller) calculateSolarTrend(ctx context.Context, history []types.EnergyStats, model map[int]timeProfile, prior solarPrior, now time.Time) float64 {
 	if len(history) < 2 {
 		return 1.0
 	}
 
-	now := time.Now().UTC()
+	now = now.UTC()
 
 	// Index history by time for easy lookups
 	statsByTime := make(map[time.Time]types.EnergyStats)
@@ -620,10 +770,7 @@ func (c *Controller) calculateSolarTrend(ctx context.Context, history []types.En
 	recentSolar := s1.SolarKWH + s2.SolarKWH
 
 	// Calculate model expected solar for these hours
-	m1 := model[t1.Hour()]
-	m2 := model[t2.Hour()]
-
-	modelSolar := m1.AvgSolar + m2.AvgSolar
+	modelSolar := solarAt(model, prior, t1) + solarAt(model, prior, t2)
 
 	// If model expects no solar (e.g. night), we can't calculate a meaningful trend ratio.
 	// TODO: figure out a better way to handle this because it could be that
@@ -2,6 +2,7 @@ package controller
 
 import (
 	"context"
+	"strings"
 	"testing"
 	"time"
 
@@ -63,16 +64,38 @@ func TestDecide(t *testing.T) {
 
 	t.Run("Negative Price -> Charge/Hold, No Export", func(t *testing.T) {
 		currentPrice := types.Price{TSStart: now, DollarsPerKWH: -0.01}
-		decision, err := c.Decide(ctx, baseStatus, currentPrice, nil, history, baseSettings)
+		decision, err := c.Decide(ctx, baseStatus, currentPrice, nil, history, nil, nil, baseSettings)
 		require.NoError(t, err)
 
 		assert.Equal(t, types.BatteryModeChargeAny, decision.Action.BatteryMode)
 		assert.Equal(t, types.SolarModeNoExport, decision.Action.SolarMode)
 	})
 
+	t.Run("Negative Export Price -> No Export", func(t *testing.T) {
+		exportPrice := -0.02
+		currentPrice := types.Price{TSStart: now, DollarsPerKWH: 0.10, ExportDollarsPerKWH: &exportPrice}
+		decision, err := c.Decide(ctx, baseStatus, currentPrice, nil, history, nil, nil, baseSettings)
+		require.NoError(t, err)
+
+		assert.Equal(t, types.SolarModeNoExport, decision.Action.SolarMode)
+	})
+
+	t.Run("Fixed Export Credit -> Export Despite Negative Price", func(t *testing.T) {
+		settings := baseSettings
+		settings.ExportCreditType = types.ExportCreditTypeFixed
+		settings.ExportCreditDollarsPerKWH = 0.03
+
+		currentPrice := types.Price{TSStart: now, DollarsPerKWH: -0.01}
+		decision, err := c.Decide(ctx, baseStatus, currentPrice, nil, history, nil, nil, settings)
+		require.NoError(t, err)
+
+		// we're already allowed to export so nothing changes
+		assert.Equal(t, types.SolarModeNoChange, decision.Action.SolarMode)
+	})
+
 	t.Run("Low Price -> Charge", func(t *testing.T) {
 		currentPrice := types.Price{TSStart: now, DollarsPerKWH: 0.04}
-		decision, err := c.Decide(ctx, baseStatus, currentPrice, nil, history, baseSettings)
+		decision, err := c.Decide(ctx, baseStatus, currentPrice, nil, history, nil, nil, baseSettings)
 		require.NoError(t, err)
 
 		assert.Equal(t, types.BatteryModeChargeAny, decision.Action.BatteryMode)
@@ -93,7 +116,7 @@ func TestDecide(t *testing.T) {
 		status := baseStatus
 		status.ElevatedMinBatterySOC = true
 
-		decision, err := c.Decide(ctx, status, currentPrice, futurePrices, history, baseSettings)
+		decision, err := c.Decide(ctx, status, currentPrice, futurePrices, history, nil, nil, baseSettings)
 		require.NoError(t, err)
 
 		// Should Load (Use battery now because current price is high vs future low)
@@ -117,7 +140,7 @@ func TestDecide(t *testing.T) {
 		lowBattStatus.BatterySOC = 30.0
 		lowBattStatus.ElevatedMinBatterySOC = true
 
-		decision, err := c.Decide(ctx, lowBattStatus, currentPrice, futurePrices, history, baseSettings)
+		decision, err := c.Decide(ctx, lowBattStatus, currentPrice, futurePrices, history, nil, nil, baseSettings)
 		require.NoError(t, err)
 
 		assert.Equal(t, types.BatteryModeLoad, decision.Action.BatteryMode)
@@ -137,7 +160,7 @@ func TestDecide(t *testing.T) {
 		lowBattStatus := baseStatus
 		lowBattStatus.BatterySOC = 20.0
 
-		decision, err := c.Decide(ctx, lowBattStatus, currentPrice, futurePrices, history, baseSettings)
+		decision, err := c.Decide(ctx, lowBattStatus, currentPrice, futurePrices, history, nil, nil, baseSettings)
 		require.NoError(t, err)
 
 		assert.Equal(t, types.BatteryModeChargeAny, decision.Action.BatteryMode)
@@ -146,12 +169,17 @@ func TestDecide(t *testing.T) {
 
 	t.Run("Arbitrage Opportunity -> Charge", func(t *testing.T) {
 		currentPrice := types.Price{TSStart: now, DollarsPerKWH: 0.10}
-		futurePrices := []types.Price{
-			{TSStart: now.Add(2 * time.Hour), DollarsPerKWH: 0.50}, // Huge spike
+		// Huge spike for the next 5 hours which is more than the battery can cover
+		futurePrices := []types.Price{}
+		for i := 1; i <= 5; i++ {
+			futurePrices = append(futurePrices, types.Price{
+				TSStart:       now.Add(time.Duration(i) * time.Hour),
+				DollarsPerKWH: 0.50,
+			})
 		}
 
-		// Use Default Status (50%). No immediate deficit.
-		decision, err := c.Decide(ctx, baseStatus, currentPrice, futurePrices, history, baseSettings)
+		// Use Default Status (50%). Only 3kWh usable for the 5kWh spike.
+		decision, err := c.Decide(ctx, baseStatus, currentPrice, futurePrices, history, nil, nil, baseSettings)
 		require.NoError(t, err)
 
 		assert.Equal(t, types.BatteryModeChargeAny, decision.Action.BatteryMode)
@@ -178,10 +206,12 @@ func TestDecide(t *testing.T) {
 		// Arbitrage: 0.50 - 0.20 = 0.30 < 0.40. No Charge.
 		// Deficit: ChargeNow(0.20) > Future(0.05). No Charge.
 
+		// Battery 30% only has enough to cover the spike
 		status := baseStatus
+		status.BatterySOC = 30.0
 		status.BatteryKW = 1.0 // Force discharge
 
-		decision, err := c.Decide(ctx, status, currentPrice, futurePrices, history, settings)
+		decision, err := c.Decide(ctx, status, currentPrice, futurePrices, history, nil, nil, settings)
 		require.NoError(t, err)
 
 		// Deficit (History) + High Future Price -> Standby (Save)
@@ -197,17 +227,518 @@ func TestDecide(t *testing.T) {
 		noGridChargeSettings := baseSettings
 		noGridChargeSettings.GridChargeBatteries = false
 
+		// Battery 30% only has enough to cover the spike
 		status := baseStatus
+		status.BatterySOC = 30.0
 		status.BatteryKW = 1.0 // Force discharge
 
 		// Use History (Load) to trigger deficit logic
-		decision, err := c.Decide(ctx, status, currentPrice, futurePrices, history, noGridChargeSettings)
+		decision, err := c.Decide(ctx, status, currentPrice, futurePrices, history, nil, nil, noGridChargeSettings)
 		require.NoError(t, err)
 
 		// Deficit + High Future Price -> Standby
 		assert.Equal(t, types.BatteryModeStandby, decision.Action.BatteryMode)
 	})
 
+	t.Run("Max Grid Use -> Shave Peak", func(t *testing.T) {
+		currentPrice := types.Price{TSStart: now, DollarsPerKWH: 0.10}
+		futurePrices := []types.Price{
+			{TSStart: now.Add(2 * time.Hour), DollarsPerKWH: 0.50}, // Huge spike
+		}
+
+		settings := baseSettings
+		settings.GridChargeBatteries = false
+		settings.MaxGridUseKW = 5
+
+		// the plan would hold the battery for the spike but the home is pulling
+		// more than the limit right now
+		status := baseStatus
+		status.BatterySOC = 30.0
+		status.BatteryKW = 1.0
+		status.ElevatedMinBatterySOC = true
+		status.HomeKW = 8.0
+
+		decision, err := c.Decide(ctx, status, currentPrice, futurePrices, history, nil, nil, settings)
+		require.NoError(t, err)
+
+		assert.Equal(t, types.BatteryModeLoad, decision.Action.BatteryMode)
+		assert.Contains(t, decision.Action.Description, "Shaving Peak")
+
+		// under the limit we still hold
+		status.HomeKW = 1.0
+		decision, err = c.Decide(ctx, status, currentPrice, futurePrices, history, nil, nil, settings)
+		require.NoError(t, err)
+		assert.Equal(t, types.BatteryModeStandby, decision.Action.BatteryMode)
+	})
+
+	t.Run("Dwell Time -> Suppress Switch", func(t *testing.T) {
+		currentPrice := types.Price{TSStart: now, DollarsPerKWH: 0.20}
+		futurePrices := []types.Price{}
+		for i := 1; i <= 24; i++ {
+			futurePrices = append(futurePrices, types.Price{
+				TSStart:       now.Add(time.Duration(i) * time.Hour),
+				DollarsPerKWH: 0.04,
+			})
+		}
+		status := baseStatus
+		status.ElevatedMinBatterySOC = true
+		settings := baseSettings
+		settings.MinModeDwellMinutes = 30
+
+		// we started charging 10 minutes ago so we keep charging
+		recent := []types.Action{
+			{Timestamp: now.Add(-time.Hour), BatteryMode: types.BatteryModeLoad},
+			{Timestamp: now.Add(-10 * time.Minute), BatteryMode: types.BatteryModeChargeAny},
+			{Timestamp: now.Add(-5 * time.Minute), BatteryMode: types.BatteryModeNoChange},
+		}
+		decision, err := c.Decide(ctx, status, currentPrice, futurePrices, history, nil, recent, settings)
+		require.NoError(t, err)
+		assert.Equal(t, types.BatteryModeChargeAny, decision.Action.BatteryMode)
+		assert.Contains(t, decision.Action.Description, "Switch to Use Battery suppressed")
+		assert.Contains(t, decision.Action.Description, "20m0s more")
+		assert.Equal(t, "Minimum Dwell Time", decision.Explanation)
+
+		// after the dwell time we switch
+		recent[1].Timestamp = now.Add(-40 * time.Minute)
+		decision, err = c.Decide(ctx, status, currentPrice, futurePrices, history, nil, recent, settings)
+		require.NoError(t, err)
+		assert.Equal(t, types.BatteryModeLoad, decision.Action.BatteryMode)
+		assert.NotContains(t, decision.Action.Description, "suppressed")
+	})
+
+	t.Run("Dwell Time -> Safety Switch", func(t *testing.T) {
+		currentPrice := types.Price{TSStart: now, DollarsPerKWH: 0.10}
+		futurePrices := []types.Price{
+			{TSStart: now.Add(2 * time.Hour), DollarsPerKWH: 0.50},
+		}
+		settings := baseSettings
+		settings.GridChargeBatteries = false
+		settings.MaxGridUseKW = 5
+		settings.MinModeDwellMinutes = 30
+		status := baseStatus
+		status.BatterySOC = 30.0
+		status.BatteryKW = 1.0
+		status.ElevatedMinBatterySOC = true
+		status.HomeKW = 8.0
+
+		// the grid limit beats the dwell time
+		recent := []types.Action{{Timestamp: now.Add(-5 * time.Minute), BatteryMode: types.BatteryModeStandby}}
+		decision, err := c.Decide(ctx, status, currentPrice, futurePrices, history, nil, recent, settings)
+		require.NoError(t, err)
+		assert.Equal(t, types.BatteryModeLoad, decision.Action.BatteryMode)
+		assert.Contains(t, decision.Action.Description, "Shaving Peak")
+	})
+
+	t.Run("Hysteresis -> Keep Charging Near Threshold", func(t *testing.T) {
+		currentPrice := types.Price{TSStart: now, DollarsPerKWH: 0.055}
+		futurePrices := []types.Price{}
+		for i := 1; i <= 24; i++ {
+			futurePrices = append(futurePrices, types.Price{
+				TSStart:       now.Add(time.Duration(i) * time.Hour),
+				DollarsPerKWH: 0.055,
+			})
+		}
+		status := baseStatus
+		status.ElevatedMinBatterySOC = true
+		settings := baseSettings
+		settings.ModeHysteresisDollarsPerKWH = 0.01
+
+		decision, err := c.Decide(ctx, status, currentPrice, futurePrices, history, nil, nil, settings)
+		require.NoError(t, err)
+		assert.NotEqual(t, types.BatteryModeChargeAny, decision.Action.BatteryMode)
+
+		recent := []types.Action{{Timestamp: now.Add(-time.Hour), BatteryMode: types.BatteryModeChargeAny}}
+		decision, err = c.Decide(ctx, status, currentPrice, futurePrices, history, nil, recent, settings)
+		require.NoError(t, err)
+		assert.Equal(t, types.BatteryModeChargeAny, decision.Action.BatteryMode)
+		assert.Contains(t, decision.Action.Description, "Price Near Threshold")
+	})
+
+	t.Run("Hysteresis -> Small Improvement Ignored", func(t *testing.T) {
+		currentPrice := types.Price{TSStart: now, DollarsPerKWH: 0.20}
+		futurePrices := []types.Price{}
+		for i := 1; i <= 24; i++ {
+			futurePrices = append(futurePrices, types.Price{
+				TSStart:       now.Add(time.Duration(i) * time.Hour),
+				DollarsPerKWH: 0.21,
+			})
+		}
+		status := baseStatus
+		status.BatteryKW = 1.0
+		status.ElevatedMinBatterySOC = true
+		settings := baseSettings
+		settings.GridChargeBatteries = false
+
+		// holding for 0.21 is only a little better than using it at 0.20
+		decision, err := c.Decide(ctx, status, currentPrice, futurePrices, history, nil, nil, settings)
+		require.NoError(t, err)
+		assert.Equal(t, types.BatteryModeStandby, decision.Action.BatteryMode)
+
+		settings.ModeHysteresisDollarsPerKWH = 0.02
+		recent := []types.Action{{Timestamp: now.Add(-time.Hour), BatteryMode: types.BatteryModeLoad}}
+		decision, err = c.Decide(ctx, status, currentPrice, futurePrices, history, nil, recent, settings)
+		require.NoError(t, err)
+		assert.Equal(t, types.BatteryModeLoad, decision.Action.BatteryMode)
+	})
+
+	t.Run("SOC Target -> Charge Cheapest Before Deadline", func(t *testing.T) {
+		futurePrices := []types.Price{}
+		for i := 1; i <= 24; i++ {
+			futurePrices = append(futurePrices, types.Price{
+				TSStart:       now.Add(time.Duration(i) * time.Hour),
+				DollarsPerKWH: 0.10,
+			})
+		}
+		status := baseStatus
+		status.ElevatedMinBatterySOC = true
+		settings := baseSettings
+		settings.SOCTargets = []types.SOCTarget{
+			{Name: "Evening Peak", SOC: 90, Deadline: now.Add(3 * time.Hour)},
+		}
+
+		// without a target there's no reason to charge at flat prices
+		decision, err := c.Decide(ctx, status, types.Price{TSStart: now, DollarsPerKWH: 0.095}, futurePrices, history, nil, nil, baseSettings)
+		require.NoError(t, err)
+		assert.NotEqual(t, types.BatteryModeChargeAny, decision.Action.BatteryMode)
+
+		// now is the cheapest hour before the deadline
+		decision, err = c.Decide(ctx, status, types.Price{TSStart: now, DollarsPerKWH: 0.095}, futurePrices, history, nil, nil, settings)
+		require.NoError(t, err)
+		assert.Equal(t, types.BatteryModeChargeAny, decision.Action.BatteryMode)
+		assert.Equal(t, "SOC Target", decision.Explanation)
+		assert.Contains(t, decision.Action.Description, "Charging for Evening Peak: 90% by")
+		require.NotEmpty(t, decision.Plan.Steps)
+		var met bool
+		for _, step := range decision.Plan.Steps {
+			if strings.Contains(step.Reason, "Meets 90% SOC target") {
+				met = true
+				assert.GreaterOrEqual(t, step.EndSOC, 89.9)
+			}
+		}
+		assert.True(t, met)
+
+		// wait for the cheaper hours before the deadline
+		futurePrices[0].DollarsPerKWH = 0.06
+		futurePrices[1].DollarsPerKWH = 0.06
+		decision, err = c.Decide(ctx, status, types.Price{TSStart: now, DollarsPerKWH: 0.15}, futurePrices, history, nil, nil, settings)
+		require.NoError(t, err)
+		assert.NotEqual(t, types.BatteryModeChargeAny, decision.Action.BatteryMode)
+		assert.Equal(t, types.BatteryModeChargeAny, decision.Plan.Steps[1].BatteryMode)
+	})
+
+	t.Run("Carbon Weight -> Charge When Grid Is Clean", func(t *testing.T) {
+		clean, dirty := 200.0, 900.0
+		// start at the top of the hour so the first slot is a full hour and make
+		// it the only clean hour before the dirty ones
+		hour := now.Truncate(time.Hour)
+		cc := NewController()
+		cc.SetClock(func() time.Time { return hour })
+		futurePrices := []types.Price{}
+		for i := 1; i <= 24; i++ {
+			intensity := clean
+			if i <= 5 {
+				intensity = dirty
+			}
+			futurePrices = append(futurePrices, types.Price{
+				TSStart:       hour.Add(time.Duration(i) * time.Hour),
+				DollarsPerKWH: 0.10,
+				GCO2PerKWH:    &intensity,
+			})
+		}
+		currentPrice := types.Price{TSStart: hour, DollarsPerKWH: 0.10, GCO2PerKWH: &clean}
+		status := baseStatus
+		status.ElevatedMinBatterySOC = true
+
+		// flat prices give no reason to charge
+		decision, err := cc.Decide(ctx, status, currentPrice, futurePrices, history, nil, nil, baseSettings)
+		require.NoError(t, err)
+		assert.NotEqual(t, types.BatteryModeChargeAny, decision.Action.BatteryMode)
+
+		// but the emissions do
+		settings := baseSettings
+		settings.CarbonDollarsPerKG = 0.2
+		decision, err = cc.Decide(ctx, status, currentPrice, futurePrices, history, nil, nil, settings)
+		require.NoError(t, err)
+		assert.Equal(t, types.BatteryModeChargeAny, decision.Action.BatteryMode)
+	})
+
+	t.Run("Capacity Peak", func(t *testing.T) {
+		// Wednesday in July
+		day := time.Date(2026, 7, 15, 0, 0, 0, 0, capacityPeakLocation)
+		var peakHistory []types.EnergyStats
+		for i := 0; i < 48; i++ {
+			peakHistory = append(peakHistory, types.EnergyStats{
+				TSHourStart:   day.Add(time.Duration(i-48) * time.Hour),
+				GridImportKWH: 1.0,
+				HomeKWH:       1.0,
+			})
+		}
+		// PJM's load is forecasted to be high every afternoon
+		futurePricesAt := func(start time.Time) []types.Price {
+			var prices []types.Price
+			for i := 0; i <= 24; i++ {
+				ts := start.Truncate(time.Hour).Add(time.Duration(i) * time.Hour)
+				load := 120000.0
+				if h := ts.In(capacityPeakLocation).Hour(); h >= 13 && h < 19 {
+					load = 150000
+				}
+				prices = append(prices, types.Price{
+					TSStart:       ts,
+					TSEnd:         ts.Add(time.Hour),
+					DollarsPerKWH: 0.10,
+					Source:        types.PriceSourceDayAhead,
+					GridLoadMW:    &load,
+				})
+			}
+			return prices
+		}
+		status := baseStatus
+		status.ElevatedMinBatterySOC = true
+		settings := baseSettings
+		settings.CapacityChargeDollarsPerKW = 100
+		settings.CapacityPeakLoadMW = 145000
+
+		t.Run("Before -> Charge Full", func(t *testing.T) {
+			morning := day.Add(10 * time.Hour)
+			cc := NewController()
+			cc.SetClock(func() time.Time { return morning })
+
+			decision, err := cc.Decide(ctx, status, types.Price{TSStart: morning, DollarsPerKWH: 0.095}, futurePricesAt(morning), peakHistory, nil, nil, settings)
+			require.NoError(t, err)
+			assert.Equal(t, types.BatteryModeChargeAny, decision.Action.BatteryMode)
+			assert.Contains(t, decision.Action.Description, "Charging for Capacity Peak: 100% by 1:00PM")
+		})
+
+		t.Run("During -> Use Battery", func(t *testing.T) {
+			afternoon := day.Add(14 * time.Hour)
+			cc := NewController()
+			cc.SetClock(func() time.Time { return afternoon })
+			status := status
+			status.BatterySOC = 100
+
+			decision, err := cc.Decide(ctx, status, types.Price{TSStart: afternoon, DollarsPerKWH: 0.10}, futurePricesAt(afternoon), peakHistory, nil, nil, settings)
+			require.NoError(t, err)
+			assert.Equal(t, types.BatteryModeLoad, decision.Action.BatteryMode)
+			assert.Equal(t, "Capacity Peak", decision.Explanation)
+			assert.Equal(t, "Capacity Peak Predicted (PJM load 150000MW >= 145000MW): Using battery to cut grid import by 1.0kW, saving $20.00/yr if this is a peak hour.", decision.Action.Description)
+			require.NotEmpty(t, decision.Plan.Steps)
+			assert.Contains(t, decision.Plan.Steps[0].Reason, "Capacity peak (PJM load 150000MW >= 145000MW).")
+		})
+
+		t.Run("Charging -> Stops For Peak", func(t *testing.T) {
+			afternoon := day.Add(14 * time.Hour)
+			cc := NewController()
+			cc.SetClock(func() time.Time { return afternoon })
+			status := status
+			status.BatterySOC = 80
+			settings := settings
+			settings.AlwaysChargeUnderDollarsPerKWH = 0.04
+			settings.ModeHysteresisDollarsPerKWH = 0.02
+			recent := []types.Action{{Timestamp: afternoon.Add(-time.Hour), BatteryMode: types.BatteryModeChargeAny}}
+
+			// 0.05 is within the hysteresis of always charging but it's a peak
+			decision, err := cc.Decide(ctx, status, types.Price{TSStart: afternoon, DollarsPerKWH: 0.05}, futurePricesAt(afternoon), peakHistory, nil, recent, settings)
+			require.NoError(t, err)
+			assert.NotEqual(t, types.BatteryModeChargeAny, decision.Action.BatteryMode)
+		})
+	})
+
+	t.Run("Planning Horizon -> Sees Tomorrow", func(t *testing.T) {
+		currentPrice := types.Price{TSStart: now, DollarsPerKWH: 0.10}
+		futurePrices := []types.Price{}
+		for i := 1; i <= 36; i++ {
+			price := 0.10
+			if i == 30 {
+				price = 0.50 // Spike tomorrow
+			}
+			futurePrices = append(futurePrices, types.Price{
+				TSStart:       now.Add(time.Duration(i) * time.Hour),
+				DollarsPerKWH: price,
+			})
+		}
+
+		settings := baseSettings
+		settings.GridChargeBatteries = false
+
+		status := baseStatus
+		status.BatterySOC = 30.0
+		status.BatteryKW = 1.0
+		status.ElevatedMinBatterySOC = true
+
+		// 24 hours of flat prices so use the battery
+		decision, err := c.Decide(ctx, status, currentPrice, futurePrices, history, nil, nil, settings)
+		require.NoError(t, err)
+		assert.Equal(t, types.BatteryModeLoad, decision.Action.BatteryMode)
+
+		// 36 hours sees the spike so save the battery for it
+		settings.PlanningHorizonHours = 36
+		decision, err = c.Decide(ctx, status, currentPrice, futurePrices, history, nil, nil, settings)
+		require.NoError(t, err)
+		assert.Equal(t, types.BatteryModeStandby, decision.Action.BatteryMode)
+	})
+
+	t.Run("Sub-Hourly Spike -> Standby", func(t *testing.T) {
+		// 5-minute prices with a short spike in 30 minutes that would be
+		// flattened if we only looked at hourly prices
+		intervalStart := now.Truncate(5 * time.Minute)
+		currentPrice := types.Price{TSStart: intervalStart, TSEnd: intervalStart.Add(5 * time.Minute), DollarsPerKWH: 0.10}
+		futurePrices := []types.Price{}
+		for i := 1; i <= 24*12; i++ {
+			ts := intervalStart.Add(time.Duration(i) * 5 * time.Minute)
+			price := 0.10
+			if i >= 6 && i < 12 {
+				price = 1.00
+			}
+			futurePrices = append(futurePrices, types.Price{
+				TSStart:       ts,
+				TSEnd:         ts.Add(5 * time.Minute),
+				DollarsPerKWH: price,
+			})
+		}
+
+		noGridChargeSettings := baseSettings
+		noGridChargeSettings.GridChargeBatteries = false
+
+		// Battery 23% has 0.3kWh usable which is less than the 0.5kWh spike
+		status := baseStatus
+		status.BatterySOC = 23.0
+		status.BatteryKW = 1.0 // Force discharge
+
+		decision, err := c.Decide(ctx, status, currentPrice, futurePrices, history, nil, nil, noGridChargeSettings)
+		require.NoError(t, err)
+
+		assert.Equal(t, types.BatteryModeStandby, decision.Action.BatteryMode)
+	})
+
+	t.Run("Price Spike -> Export Battery", func(t *testing.T) {
+		settings := baseSettings
+		settings.GridExportBatteries = true
+
+		status := baseStatus
+		status.BatterySOC = 100
+		status.CanExportBattery = false
+
+		currentPrice := types.Price{TSStart: now, DollarsPerKWH: 1.00}
+		futurePrices := []types.Price{}
+		for i := 1; i < 24; i++ {
+			futurePrices = append(futurePrices, types.Price{
+				TSStart:       now.Add(time.Duration(i) * time.Hour),
+				DollarsPerKWH: 0.10,
+			})
+		}
+
+		decision, err := c.Decide(ctx, status, currentPrice, futurePrices, history, nil, nil, settings)
+		require.NoError(t, err)
+
+		assert.Equal(t, types.BatteryModeExport, decision.Action.BatteryMode)
+		assert.Contains(t, decision.Action.Description, "Exporting Battery")
+
+		// without battery export enabled we just use the battery
+		decision, err = c.Decide(ctx, status, currentPrice, futurePrices, history, nil, nil, baseSettings)
+		require.NoError(t, err)
+		assert.NotEqual(t, types.BatteryModeExport, decision.Action.BatteryMode)
+	})
+
+	t.Run("Solar Forecast -> No Charge", func(t *testing.T) {
+		status := baseStatus
+		status.BatterySOC = 30
+
+		currentPrice := types.Price{TSStart: now, DollarsPerKWH: 0.06}
+		futurePrices := []types.Price{}
+		for i := 1; i < 24; i++ {
+			price := 0.10
+			if i > 3 {
+				price = 0.30
+			}
+			futurePrices = append(futurePrices, types.Price{
+				TSStart:       now.Add(time.Duration(i) * time.Hour),
+				DollarsPerKWH: price,
+			})
+		}
+
+		// disable export so charging now can't be used to export more solar later
+		settings := baseSettings
+		settings.GridExportSolar = false
+
+		// history has no solar so we'd need to charge while it's cheap
+		decision, err := c.Decide(ctx, status, currentPrice, futurePrices, history, nil, nil, settings)
+		require.NoError(t, err)
+		assert.Equal(t, types.BatteryModeChargeAny, decision.Action.BatteryMode)
+
+		// but the forecast says solar will cover the home and fill the battery
+		var solarForecast []types.SolarForecast
+		for i := 0; i < 48; i++ {
+			solarForecast = append(solarForecast, types.SolarForecast{
+				TSHourStart: now.Truncate(time.Hour).Add(time.Duration(i) * time.Hour),
+				KWH:         2.0,
+			})
+		}
+		decision, err = c.Decide(ctx, status, currentPrice, futurePrices, history, solarForecast, nil, settings)
+		require.NoError(t, err)
+		assert.NotEqual(t, types.BatteryModeChargeAny, decision.Action.BatteryMode)
+	})
+
+	t.Run("Plan", func(t *testing.T) {
+		currentPrice := types.Price{TSStart: now, DollarsPerKWH: 0.10}
+		futurePrices := []types.Price{
+			{TSStart: now.Add(2 * time.Hour), DollarsPerKWH: 0.50}, // Huge spike
+		}
+
+		settings := baseSettings
+		settings.GridChargeBatteries = false
+
+		status := baseStatus
+		status.BatterySOC = 30.0
+		status.BatteryKW = 1.0
+
+		decision, err := c.Decide(ctx, status, currentPrice, futurePrices, history, nil, nil, settings)
+		require.NoError(t, err)
+		require.Equal(t, types.BatteryModeStandby, decision.Action.BatteryMode)
+
+		plan := decision.Plan
+		assert.Equal(t, decision.Action, plan.Action)
+		require.GreaterOrEqual(t, len(plan.Steps), 24)
+		assert.Equal(t, types.BatteryModeStandby, plan.Steps[0].BatteryMode)
+		assert.InDelta(t, 30.0, plan.Steps[0].StartSOC, 0.001)
+		assert.Contains(t, plan.Steps[0].Reason, "Holding battery")
+		for i := 1; i < len(plan.Steps); i++ {
+			assert.True(t, plan.Steps[i-1].TSEnd.Equal(plan.Steps[i].TSStart))
+			assert.InDelta(t, plan.Steps[i-1].EndSOC, plan.Steps[i].StartSOC, 0.001)
+		}
+
+		// the battery is used during the spike
+		var spike types.PlanStep
+		for _, step := range plan.Steps {
+			if step.TSStart.Equal(now.Add(2 * time.Hour).Truncate(time.Hour)) {
+				spike = step
+				break
+			}
+		}
+		assert.Equal(t, types.BatteryModeLoad, spike.BatteryMode)
+		assert.Greater(t, spike.BatteryUsedKWH, 0.0)
+	})
+
+	t.Run("Partial Current Hour Stays Hourly", func(t *testing.T) {
+		// the in-progress hour only has 20 minutes of prices so far
+		hourStart := now.Truncate(time.Hour)
+		currentPrice := types.Price{TSStart: hourStart, TSEnd: hourStart.Add(20 * time.Minute), DollarsPerKWH: 0.10}
+		futurePrices := []types.Price{}
+		for i := 1; i <= 24; i++ {
+			ts := hourStart.Add(time.Duration(i) * time.Hour)
+			futurePrices = append(futurePrices, types.Price{TSStart: ts, TSEnd: ts.Add(time.Hour), DollarsPerKWH: 0.10})
+		}
+
+		decision, err := c.Decide(ctx, baseStatus, currentPrice, futurePrices, history, nil, nil, baseSettings)
+		require.NoError(t, err)
+
+		// the first and last steps are cut short by now and the horizon
+		steps := decision.Plan.Steps
+		require.Greater(t, len(steps), 2)
+		for _, step := range steps[1 : len(steps)-1] {
+			assert.Equal(t, time.Hour, step.TSEnd.Sub(step.TSStart), step.TSStart)
+		}
+	})
+
 	t.Run("Zero Capacity -> Standby", func(t *testing.T) {
 		currentPrice := types.Price{TSStart: now, DollarsPerKWH: 0.10}
 
@@ -215,11 +746,13 @@ func TestDecide(t *testing.T) {
 		zeroCapStatus.BatteryCapacityKWH = 0
 		zeroCapStatus.BatteryKW = 1.0 // Force discharge
 
-		decision, err := c.Decide(ctx, zeroCapStatus, currentPrice, nil, noLoadHistory, baseSettings)
+		decision, err := c.Decide(ctx, zeroCapStatus, currentPrice, nil, noLoadHistory, nil, nil, baseSettings)
 		require.NoError(t, err)
 
 		assert.Equal(t, types.BatteryModeStandby, decision.Action.BatteryMode)
 		assert.Contains(t, decision.Action.Description, "Capacity 0")
+		// nothing was simulated
+		assert.Empty(t, decision.Plan.Steps)
 	})
 
 	t.Run("Default to Standby", func(t *testing.T) {
@@ -230,7 +763,7 @@ func TestDecide(t *testing.T) {
 		status.BatteryKW = 1.0 // Force discharge
 
 		// Use No Load History to avoid Deficit
-		decision, err := c.Decide(ctx, status, currentPrice, nil, noLoadHistory, baseSettings)
+		decision, err := c.Decide(ctx, status, currentPrice, nil, noLoadHistory, nil, nil, baseSettings)
 		require.NoError(t, err)
 
 		// No deficit, default to Load -> NoChange (discharging)
@@ -265,7 +798,7 @@ func TestDecide(t *testing.T) {
 		// pretend we're charging
 		elevatedSOCStatus := baseStatus
 		elevatedSOCStatus.ElevatedMinBatterySOC = true
-		decision, err := c.Decide(ctx, elevatedSOCStatus, currentPrice, futurePrices, lowLoadHistory, baseSettings)
+		decision, err := c.Decide(ctx, elevatedSOCStatus, currentPrice, futurePrices, lowLoadHistory, nil, nil, baseSettings)
 		require.NoError(t, err)
 
 		assert.Equal(t, types.BatteryModeLoad, decision.Action.BatteryMode)
@@ -284,7 +817,7 @@ func TestDecide(t *testing.T) {
 		noGridSettings.GridChargeBatteries = false
 
 		// Available 5kWh. Deficit!
-		decision, err := c.Decide(ctx, baseStatus, currentPrice, futurePrices, history, noGridSettings)
+		decision, err := c.Decide(ctx, baseStatus, currentPrice, futurePrices, history, nil, nil, noGridSettings)
 		require.NoError(t, err)
 
 		assert.Equal(t, types.BatteryModeNoChange, decision.Action.BatteryMode)
@@ -305,7 +838,7 @@ func TestDecide(t *testing.T) {
 		// pretend we're charging
 		elevatedSOCStatus := baseStatus
 		elevatedSOCStatus.ElevatedMinBatterySOC = true
-		decision, err := c.Decide(ctx, elevatedSOCStatus, currentPrice, futurePrices, history, noGridSettings)
+		decision, err := c.Decide(ctx, elevatedSOCStatus, currentPrice, futurePrices, history, nil, nil, noGridSettings)
 		require.NoError(t, err)
 
 		assert.Equal(t, types.BatteryModeLoad, decision.Action.BatteryMode)
@@ -340,7 +873,7 @@ func TestDecide(t *testing.T) {
 			status.BatteryKW = -5.0             // Already Charging
 			status.ElevatedMinBatterySOC = true // Needs to be elevated which implies we successfully set the change last time
 
-			decision, err := c.Decide(ctx, status, cheapPrice, nil, history, baseSettings)
+			decision, err := c.Decide(ctx, status, cheapPrice, nil, history, nil, nil, baseSettings)
 			require.NoError(t, err)
 			assert.Equal(t, types.BatteryModeNoChange, decision.Action.BatteryMode)
 		})
@@ -353,7 +886,7 @@ func TestDecide(t *testing.T) {
 			status.BatteryKW = -5.0              // Already Charging
 			status.ElevatedMinBatterySOC = false // Not elevated means we need to reissue command
 
-			decision, err := c.Decide(ctx, status, cheapPrice, nil, history, baseSettings)
+			decision, err := c.Decide(ctx, status, cheapPrice, nil, history, nil, nil, baseSettings)
 			require.NoError(t, err)
 			assert.Equal(t, types.BatteryModeChargeAny, decision.Action.BatteryMode)
 		})
@@ -365,7 +898,7 @@ func TestDecide(t *testing.T) {
 			status.BatterySOC = 100.0
 			status.ElevatedMinBatterySOC = true
 
-			decision, err := c.Decide(ctx, status, cheapPrice, nil, history, baseSettings)
+			decision, err := c.Decide(ctx, status, cheapPrice, nil, history, nil, nil, baseSettings)
 			require.NoError(t, err)
 			assert.Equal(t, types.BatteryModeNoChange, decision.Action.BatteryMode)
 		})
@@ -377,7 +910,7 @@ func TestDecide(t *testing.T) {
 			status.BatterySOC = 100.0
 			status.ElevatedMinBatterySOC = false
 
-			decision, err := c.Decide(ctx, status, cheapPrice, nil, history, baseSettings)
+			decision, err := c.Decide(ctx, status, cheapPrice, nil, history, nil, nil, baseSettings)
 			require.NoError(t, err)
 			assert.Equal(t, types.BatteryModeChargeAny, decision.Action.BatteryMode)
 		})
@@ -386,7 +919,7 @@ func TestDecide(t *testing.T) {
 			status := baseStatus
 			status.BatteryKW = 2.0 // Discharging
 
-			decision, err := c.Decide(ctx, status, currentPrice, nil, history, baseSettings)
+			decision, err := c.Decide(ctx, status, currentPrice, nil, history, nil, nil, baseSettings)
 			require.NoError(t, err)
 			// Discharging (-2.0) -> Load (Allow Discharge) -> NoChange (Optimization)
 			assert.Equal(t, types.BatteryModeNoChange, decision.Action.BatteryMode)
@@ -405,7 +938,7 @@ func TestDecide(t *testing.T) {
 			// Logic: BatteryKW (3) > SolarSurplus (0) AND GridKW > 0  => ChargingFromGrid = true
 			// Should switch to Standby to stop grid charging
 
-			decision, err := c.Decide(ctx, status, currentPrice, nil, history, baseSettings)
+			decision, err := c.Decide(ctx, status, currentPrice, nil, history, nil, nil, baseSettings)
 			require.NoError(t, err)
 			assert.Equal(t, types.BatteryModeNoChange, decision.Action.BatteryMode)
 		})
@@ -423,7 +956,7 @@ func TestDecide(t *testing.T) {
 			// Logic: BatteryKW (1) <= SolarSurplus (1.5). IsChargingFromGrid = false.
 			// Since BatteryKW > 0 and Not Grid Charging -> NoChange.
 
-			decision, err := c.Decide(ctx, status, currentPrice, nil, history, baseSettings)
+			decision, err := c.Decide(ctx, status, currentPrice, nil, history, nil, nil, baseSettings)
 			require.NoError(t, err)
 			// Charging from Solar -> Load (Allow Discharge/Solar) -> Load (Ensure not Standby)
 			assert.Equal(t, types.BatteryModeNoChange, decision.Action.BatteryMode)
@@ -433,7 +966,7 @@ func TestDecide(t *testing.T) {
 			status := baseStatus
 			status.BatteryKW = 0.0
 
-			decision, err := c.Decide(ctx, status, currentPrice, nil, history, baseSettings)
+			decision, err := c.Decide(ctx, status, currentPrice, nil, history, nil, nil, baseSettings)
 			require.NoError(t, err)
 			// Idle -> Load
 			assert.Equal(t, types.BatteryModeNoChange, decision.Action.BatteryMode)
@@ -447,7 +980,7 @@ func TestDecide(t *testing.T) {
 
 			// Decide usually sets SolarModeAny unless price is negative
 
-			decision, err := c.Decide(ctx, status, currentPrice, nil, history, baseSettings)
+			decision, err := c.Decide(ctx, status, currentPrice, nil, history, nil, nil, baseSettings)
 			require.NoError(t, err)
 			assert.Equal(t, types.SolarModeNoChange, decision.Action.SolarMode)
 		})
@@ -457,7 +990,7 @@ func TestDecide(t *testing.T) {
 			status.CanExportSolar = true
 			status.BatteryKW = 0.0 // Idle
 
-			decision, err := c.Decide(ctx, status, currentPrice, nil, history, baseSettings)
+			decision, err := c.Decide(ctx, status, currentPrice, nil, history, nil, nil, baseSettings)
 			require.NoError(t, err)
 			assert.Equal(t, types.BatteryModeNoChange, decision.Action.BatteryMode)
 			assert.Equal(t, types.SolarModeNoChange, decision.Action.SolarMode)
@@ -469,7 +1002,7 @@ func TestDecide(t *testing.T) {
 
 			baseSettings.GridExportSolar = false
 
-			decision, err := c.Decide(ctx, status, currentPrice, nil, history, baseSettings)
+			decision, err := c.Decide(ctx, status, currentPrice, nil, history, nil, nil, baseSettings)
 			require.NoError(t, err)
 			assert.Equal(t, types.SolarModeNoExport, decision.Action.SolarMode)
 		})
@@ -497,13 +1030,14 @@ func TestDecide(t *testing.T) {
 		}
 
 		realNow := time.Now()
-		// Create price to avoid cheap charge triggers
+		// Create price to avoid cheap charge triggers but make later more
+		// expensive so a deficit is worth charging for now
 		currentPrice := types.Price{TSStart: realNow, DollarsPerKWH: 0.20}
 		futurePrices := []types.Price{}
 		for i := 1; i <= 24; i++ {
 			futurePrices = append(futurePrices, types.Price{
 				TSStart:       realNow.Add(time.Duration(i) * time.Hour),
-				DollarsPerKWH: 0.20,
+				DollarsPerKWH: 0.30,
 			})
 		}
 
@@ -541,7 +1075,7 @@ func TestDecide(t *testing.T) {
 
 		t.Run("High Solar Trend -> Load (Sufficient Solar)", func(t *testing.T) {
 			history := createHistory(true)
-			decision, err := c.Decide(ctx, baseStatus, currentPrice, futurePrices, history, baseSettings)
+			decision, err := c.Decide(ctx, baseStatus, currentPrice, futurePrices, history, nil, nil, baseSettings)
 			require.NoError(t, err)
 			// Should be Standby, but since BatteryKW is 0, it returns NoChange
 			// Should be Load (Sufficient Battery)
@@ -551,7 +1085,7 @@ func TestDecide(t *testing.T) {
 
 		t.Run("No Solar Trend -> Charge", func(t *testing.T) {
 			history := createHistory(false)
-			decision, err := c.Decide(ctx, baseStatus, currentPrice, futurePrices, history, baseSettings)
+			decision, err := c.Decide(ctx, baseStatus, currentPrice, futurePrices, history, nil, nil, baseSettings)
 			require.NoError(t, err)
 			assert.Equal(t, types.BatteryModeChargeAny, decision.Action.BatteryMode, "Should predict deficit due to low solar")
 			assert.Contains(t, decision.Action.Description, "Projected Deficit")
@@ -562,9 +1096,10 @@ func TestDecide(t *testing.T) {
 func TestBuildHourlyEnergyModel(t *testing.T) {
 	c := NewController()
 	ctx := context.Background()
+	now := time.Now()
 
 	t.Run("Basic Average", func(t *testing.T) {
-		h1 := time.Now().Truncate(time.Hour)
+		h1 := now.Truncate(time.Hour)
 		h2 := h1.Add(-24 * time.Hour)
 
 		history := []types.EnergyStats{
@@ -572,58 +1107,21 @@ func TestBuildHourlyEnergyModel(t *testing.T) {
 			{TSHourStart: h2, HomeKWH: 3.0, SolarKWH: 4.0},
 		}
 
-		// Avg Load: (1+3)/2 = 2.0. Avg Solar: (2+4)/2 = 3.0
-		model := c.buildHourlyEnergyModel(ctx, history, 0.0)
-		assert.InDelta(t, 2.0, model[h1.Hour()].AvgHomeLoad, 0.001)
+		// Avg Solar: (2+4)/2 = 3.0
+		model := c.buildHourlyEnergyModel(ctx, history, now)
 		assert.InDelta(t, 3.0, model[h1.Hour()].AvgSolar, 0.001)
 	})
 
-	t.Run("Outlier", func(t *testing.T) {
-		// Create history with 3 normal points and 1 outlier
-		now := time.Now()
+	t.Run("Old History Ignored", func(t *testing.T) {
 		h1 := now.Truncate(time.Hour)
-		h2 := h1.Add(-24 * time.Hour)
-		h3 := h1.Add(-48 * time.Hour)
-		h4 := h1.Add(-72 * time.Hour)
-
-		history := []types.EnergyStats{
-			{TSHourStart: h1, HomeKWH: 1.0, SolarKWH: 0.0},
-			{TSHourStart: h2, HomeKWH: 1.1, SolarKWH: 0.0},
-			{TSHourStart: h3, HomeKWH: 0.9, SolarKWH: 0.0},
-			{TSHourStart: h4, HomeKWH: 10.0, SolarKWH: 0.0}, // The outlier (10x normal)
-		}
-
-		// Case 1: Multiple = 0 (Disabled) -> Average should include 10.0
-		// Avg = (1.0 + 1.1 + 0.9 + 10.0) / 4 = 13.0 / 4 = 3.25
-		modelDisabled := c.buildHourlyEnergyModel(ctx, history, 0.0)
-		assert.InDelta(t, 3.25, modelDisabled[h1.Hour()].AvgHomeLoad, 0.001)
-
-		// Case 2: Multiple = 5 -> Should ignore 10.0
-		// Avg other for 10.0 is (1.0+1.1+0.9)/3 = 1.0.
-		// 10.0 > 1.0 * 5. So it is an outlier.
-		// Result Avg = 1.0
-		modelEnabled := c.buildHourlyEnergyModel(ctx, history, 5.0)
-		assert.InDelta(t, 1.0, modelEnabled[h1.Hour()].AvgHomeLoad, 0.001)
-
-		// Case 3: Multiple = 15 -> 10.0 is NOT > 1.0 * 15. avg should be 3.25
-		modelStrict := c.buildHourlyEnergyModel(ctx, history, 15.0)
-		assert.InDelta(t, 3.25, modelStrict[h1.Hour()].AvgHomeLoad, 0.001)
-	})
-
-	t.Run("Not Enough Points for Outlier", func(t *testing.T) {
-		now := time.Now()
-		h1 := now.Truncate(time.Hour)
-		h2 := h1.Add(-24 * time.Hour)
+		h2 := h1.Add(-7 * 24 * time.Hour)
 
 		history := []types.EnergyStats{
-			{TSHourStart: h1, HomeKWH: 1.0, SolarKWH: 0.0},
-			{TSHourStart: h2, HomeKWH: 10.0, SolarKWH: 0.0},
+			{TSHourStart: h1, SolarKWH: 2.0},
+			{TSHourStart: h2, SolarKWH: 4.0},
 		}
 
-		// Even with outlier protection enabled, we only have 2 points.
-		// It should NOT filter anything.
-		// Avg = (1+10)/2 = 5.5
-		model := c.buildHourlyEnergyModel(ctx, history, 2.0)
-		assert.InDelta(t, 5.5, model[h1.Hour()].AvgHomeLoad, 0.001)
+		model := c.buildHourlyEnergyModel(ctx, history, now)
+		assert.InDelta(t, 2.0, model[h1.Hour()].AvgSolar, 0.001)
 	})
 }
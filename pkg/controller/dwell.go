@@ -0,0 +1,38 @@
+package controller
+
+import (
+	"sort"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+)
+
+// activeMode returns the battery mode the recent actions left the battery in
+// and when it switched to that mode. It returns NoChange if no action set a
+// mode.
+func activeMode(actions []types.Action) (types.BatteryMode, time.Time) {
+	sorted := append([]types.Action(nil), actions...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp.Before(sorted[j].Timestamp)
+	})
+
+	mode := types.BatteryModeNoChange
+	var since time.Time
+	for _, a := range sorted {
+		if a.BatteryMode == types.BatteryModeNoChange || a.BatteryMode == mode {
+			continue
+		}
+		mode = a.BatteryMode
+		since = a.Timestamp
+	}
+	return mode, since
+}
+
+// optimizerMode returns the optimizer mode that behaves like mode.
+func optimizerMode(mode types.BatteryMode) types.BatteryMode {
+	// only solar charges the battery in standby
+	if mode == types.BatteryModeChargeSolar {
+		return types.BatteryModeStandby
+	}
+	return mode
+}
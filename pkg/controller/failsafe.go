@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+)
+
+// StaleInputs returns the inputs that are older than the settings allow at
+// now. Inputs without a timestamp are assumed to be fresh.
+func StaleInputs(status types.SystemStatus, price types.Price, settings types.Settings, now time.Time) []types.DegradedInput {
+	maxAge := settings.StaleData()
+	var stale []types.DegradedInput
+	if !status.Timestamp.IsZero() && now.Sub(status.Timestamp) > maxAge {
+		stale = append(stale, types.DegradedInputStatus)
+	}
+	if !price.TSStart.IsZero() {
+		// a price is current until its interval ends, assume it's hourly if we
+		// don't know when it ends
+		priceEnd := price.TSEnd
+		if priceEnd.IsZero() {
+			priceEnd = price.TSStart.Add(time.Hour)
+		}
+		if now.Sub(priceEnd) > maxAge {
+			stale = append(stale, types.DegradedInputCurrentPrice)
+		}
+	}
+	return stale
+}
+
+// FailSafe returns the decision to make instead of asking the strategy when
+// the degraded inputs can't be trusted. It uses the battery for the home down
+// to the reserve SOC or holds it, depending on the settings' fail-safe mode.
+func FailSafe(status types.SystemStatus, price types.Price, degraded []types.DegradedInput, settings types.Settings, now time.Time) Decision {
+	names := make([]string, 0, len(degraded))
+	for _, d := range degraded {
+		names = append(names, string(d))
+	}
+	desc := fmt.Sprintf("Fail-Safe (degraded %s): ", strings.Join(names, ", "))
+
+	mode := types.BatteryModeStandby
+	switch settings.FailSafeMode {
+	case types.FailSafeModeStandby:
+		desc += "Holding battery."
+	default:
+		reserve := settings.FailSafeReserve()
+		if status.BatterySOC > reserve {
+			mode = types.BatteryModeLoad
+			desc += fmt.Sprintf("Using battery down to %.0f%% reserve.", reserve)
+		} else {
+			desc += fmt.Sprintf("Holding battery at %.0f%% reserve.", reserve)
+		}
+	}
+
+	action := types.Action{
+		Timestamp:      now,
+		BatteryMode:    mode,
+		Description:    desc,
+		CurrentPrice:   price,
+		SystemStatus:   status,
+		DegradedInputs: degraded,
+	}
+	return Decision{
+		Action:      action,
+		Explanation: "Fail-Safe",
+		Plan: types.Plan{
+			Timestamp: now,
+			Action:    action,
+		},
+	}
+}
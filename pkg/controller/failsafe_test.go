@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+)
+
+func TestStaleInputs(t *testing.T) {
+	now := time.Now()
+	settings := types.Settings{}
+
+	fresh := StaleInputs(
+		types.SystemStatus{Timestamp: now.Add(-time.Minute)},
+		types.Price{TSStart: now.Add(-5 * time.Minute), TSEnd: now},
+		settings,
+		now,
+	)
+	assert.Empty(t, fresh)
+
+	// without timestamps we can't tell
+	assert.Empty(t, StaleInputs(types.SystemStatus{}, types.Price{}, settings, now))
+
+	// an hourly price without an end is current for the hour
+	assert.Empty(t, StaleInputs(types.SystemStatus{}, types.Price{TSStart: now.Add(-70 * time.Minute)}, settings, now))
+
+	stale := StaleInputs(
+		types.SystemStatus{Timestamp: now.Add(-20 * time.Minute)},
+		types.Price{TSStart: now.Add(-30 * time.Minute), TSEnd: now.Add(-25 * time.Minute)},
+		settings,
+		now,
+	)
+	assert.Equal(t, []types.DegradedInput{types.DegradedInputStatus, types.DegradedInputCurrentPrice}, stale)
+
+	settings.StaleDataMinutes = 60
+	assert.Empty(t, StaleInputs(types.SystemStatus{Timestamp: now.Add(-20 * time.Minute)}, types.Price{}, settings, now))
+}
+
+func TestFailSafe(t *testing.T) {
+	now := time.Now()
+	degraded := []types.DegradedInput{types.DegradedInputFuturePrices, types.DegradedInputEnergyHistory}
+	settings := types.Settings{MinBatterySOC: 20}
+
+	t.Run("Reserve", func(t *testing.T) {
+		decision := FailSafe(types.SystemStatus{BatterySOC: 50}, types.Price{}, degraded, settings, now)
+		assert.Equal(t, types.BatteryModeLoad, decision.Action.BatteryMode)
+		assert.Equal(t, "Fail-Safe (degraded futurePrices, energyHistory): Using battery down to 20% reserve.", decision.Action.Description)
+		assert.Equal(t, "Fail-Safe", decision.Explanation)
+		assert.Equal(t, degraded, decision.Action.DegradedInputs)
+
+		settings := settings
+		settings.FailSafeReserveSOC = 60
+		decision = FailSafe(types.SystemStatus{BatterySOC: 50}, types.Price{}, degraded, settings, now)
+		assert.Equal(t, types.BatteryModeStandby, decision.Action.BatteryMode)
+		assert.Contains(t, decision.Action.Description, "Holding battery at 60% reserve.")
+	})
+
+	t.Run("Standby", func(t *testing.T) {
+		settings := settings
+		settings.FailSafeMode = types.FailSafeModeStandby
+		decision := FailSafe(types.SystemStatus{BatterySOC: 90}, types.Price{}, degraded, settings, now)
+		assert.Equal(t, types.BatteryModeStandby, decision.Action.BatteryMode)
+		assert.Contains(t, decision.Action.Description, "Holding battery.")
+	})
+}
@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+)
+
+// HindsightHour is what the battery should have done over an hour knowing the
+// actual prices, home load and solar.
+type HindsightHour struct {
+	TSHourStart time.Time         `json:"tsHourStart"`
+	BatteryMode types.BatteryMode `json:"batteryMode"`
+	StartSOC    float64           `json:"startSOC"`
+	EndSOC      float64           `json:"endSOC"`
+	// DollarsPerKWH is the average import price over the hour including fees
+	DollarsPerKWH float64 `json:"dollarsPerKWH"`
+	// ExportDollarsPerKWH is the average export credit over the hour
+	ExportDollarsPerKWH float64 `json:"exportDollarsPerKWH"`
+	GridImportKWH       float64 `json:"gridImportKWH"`
+	GridExportKWH       float64 `json:"gridExportKWH"`
+	// Cost is the grid import cost minus export credits
+	Cost float64 `json:"cost"`
+}
+
+// Hindsight returns the minimum cost battery schedule over the hours in
+// history using the actual prices, home load and solar as if they were known
+// ahead of time. The battery starts at status.BatterySOC and is limited by the
+// same settings as Decide, except the minimum arbitrage difference since it
+// only guards against forecasts being wrong. Hours without a price are skipped.
+func Hindsight(history []types.EnergyStats, prices []types.Price, status types.SystemStatus, settings types.Settings) []HindsightHour {
+	capacityKWH := status.BatteryCapacityKWH
+	if capacityKWH <= 0 {
+		return nil
+	}
+
+	importSums := make(map[time.Time]float64)
+	exportSums := make(map[time.Time]float64)
+	counts := make(map[time.Time]int)
+	for _, p := range prices {
+		ts := p.TSStart.Truncate(time.Hour)
+		importSums[ts] += settings.ImportPrice(p)
+		exportSums[ts] += settings.ExportPrice(p)
+		counts[ts]++
+	}
+
+	history = append([]types.EnergyStats(nil), history...)
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].TSHourStart.Before(history[j].TSHourStart)
+	})
+
+	var slots []simSlot
+	for _, h := range history {
+		ts := h.TSHourStart.Truncate(time.Hour)
+		n := counts[ts]
+		if n == 0 {
+			continue
+		}
+		exportValue := math.Max(0, exportSums[ts]/float64(n))
+		solarExportValue := exportValue
+		if !settings.GridExportSolar {
+			solarExportValue = 0
+		}
+		slots = append(slots, simSlot{
+			ts:                 ts,
+			duration:           time.Hour,
+			netLoadKWH:         h.HomeKWH - h.SolarKWH,
+			importCost:         importSums[ts] / float64(n),
+			exportValue:        solarExportValue,
+			batteryExportValue: exportValue,
+		})
+	}
+	if len(slots) == 0 {
+		return nil
+	}
+
+	chargeKW := status.MaxBatteryChargeKW
+	if chargeKW <= 0 {
+		// conservatively assume it takes 3 hours to charge the battery from 0->100
+		chargeKW = capacityKWH / 3.0
+	}
+	battery := batteryModel{
+		capacityKWH:         capacityKWH,
+		minKWH:              capacityKWH * (settings.MinBatterySOC / 100.0),
+		chargeKW:            chargeKW,
+		dischargeKW:         status.MaxBatteryDischargeKW,
+		gridCharge:          settings.GridChargeBatteries,
+		gridExport:          settings.GridExportBatteries,
+		roundTripEfficiency: settings.BatteryRoundTripEfficiency / 100,
+		degradationPerKWH:   settings.BatteryDegradationDollarsPerKWH,
+		maxImportKW:         settings.MaxGridUseKW,
+		peakPenaltyPerKW:    math.Max(settings.DemandChargeDollarsPerKW, maxGridUsePenaltyPerKW),
+	}
+	if settings.MaxBatteryCyclesPerDay > 0 {
+		battery.maxDischargeKWH = settings.MaxBatteryCyclesPerDay * capacityKWH * float64(len(slots)) / 24
+	}
+	// energy left at the end is worth what it would cost to charge it again
+	terminalPerKWH := math.Inf(1)
+	for _, slot := range slots {
+		terminalPerKWH = math.Min(terminalPerKWH, slot.importCost)
+	}
+	_, dischargeEff := battery.efficiencies()
+	battery.terminalPerKWH = math.Max(0, terminalPerKWH*dischargeEff-battery.degradationPerKWH)
+
+	plan, _ := newOptimizer(battery, slots).limitDischarge(capacityKWH * status.BatterySOC / 100)
+
+	hours := make([]HindsightHour, 0, len(plan))
+	for _, p := range plan {
+		// modes that don't move any energy are the same as standby
+		mode := p.mode
+		if p.batteryUseKWH+p.batteryExportKWH+p.gridChargeKWH < 0.001 {
+			mode = types.BatteryModeStandby
+		}
+		solarExportKWH := p.gridExportKWH - p.batteryExportKWH
+		hours = append(hours, HindsightHour{
+			TSHourStart:         p.ts,
+			BatteryMode:         mode,
+			StartSOC:            p.startKWH / capacityKWH * 100,
+			EndSOC:              p.endKWH / capacityKWH * 100,
+			DollarsPerKWH:       p.importCost,
+			ExportDollarsPerKWH: p.batteryExportValue,
+			GridImportKWH:       p.gridImportKWH,
+			GridExportKWH:       p.gridExportKWH,
+			Cost:                p.gridImportKWH*p.importCost - solarExportKWH*p.exportValue - p.batteryExportKWH*p.batteryExportValue,
+		})
+	}
+	return hours
+}
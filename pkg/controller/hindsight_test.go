@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+)
+
+func TestHindsight(t *testing.T) {
+	start := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	var history []types.EnergyStats
+	var prices []types.Price
+	for i := range 24 {
+		ts := start.Add(time.Duration(i) * time.Hour)
+		price := 0.05
+		if i >= 17 && i < 21 {
+			price = 0.40
+		}
+		history = append(history, types.EnergyStats{TSHourStart: ts, HomeKWH: 2})
+		prices = append(prices, types.Price{TSStart: ts, TSEnd: ts.Add(time.Hour), DollarsPerKWH: price})
+	}
+	status := types.SystemStatus{
+		BatterySOC:         20,
+		BatteryCapacityKWH: 10,
+		MaxBatteryChargeKW: 5,
+	}
+	settings := types.Settings{
+		MinBatterySOC:       20,
+		GridChargeBatteries: true,
+	}
+
+	t.Run("Charges Before Peak", func(t *testing.T) {
+		hours := Hindsight(history, prices, status, settings)
+		require.Len(t, hours, 24)
+
+		var cost float64
+		for i, h := range hours {
+			cost += h.Cost
+			if i > 0 {
+				assert.InDelta(t, hours[i-1].EndSOC, h.StartSOC, 0.001)
+			}
+			if i >= 17 && i < 21 {
+				assert.Equal(t, types.BatteryModeLoad, h.BatteryMode, "hour %d", i)
+			}
+		}
+		// 8kWh of the 8kWh peak moves from 0.40 to 0.05
+		noBattery := 20*2*0.05 + 4*2*0.40
+		assert.InDelta(t, noBattery-8*0.35, cost, 0.01)
+		assert.InDelta(t, 20.0, hours[23].EndSOC, 0.5)
+	})
+
+	t.Run("No Grid Charging", func(t *testing.T) {
+		hours := Hindsight(history, prices, status, types.Settings{MinBatterySOC: 20})
+		for _, h := range hours {
+			assert.NotEqual(t, types.BatteryModeChargeAny, h.BatteryMode)
+			assert.InDelta(t, 20.0, h.EndSOC, 0.001)
+		}
+	})
+
+	t.Run("Missing Prices Skipped", func(t *testing.T) {
+		hours := Hindsight(history, prices[:12], status, settings)
+		assert.Len(t, hours, 12)
+	})
+
+	t.Run("Zero Capacity", func(t *testing.T) {
+		assert.Empty(t, Hindsight(history, prices, types.SystemStatus{}, settings))
+	})
+}
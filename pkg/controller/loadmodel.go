@@ -0,0 +1,184 @@
+package controller
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+)
+
+const (
+	// loadHalfLife is how long until a day of history counts half as much as
+	// today when modeling load.
+	loadHalfLife = 7 * 24 * time.Hour
+	// minLoadSamples is the number of days needed for an hour of a day type
+	// before it's used on its own instead of blended with every day. It's also
+	// the fewest days needed to look for outliers.
+	minLoadSamples = 3
+	// minLoadSpreadKWH is the smallest spread used to find outliers so hours
+	// with nearly identical usage don't reject small changes.
+	minLoadSpreadKWH = 0.05
+)
+
+// LoadProfile is the expected home load for an hour of the day.
+type LoadProfile struct {
+	Hour int `json:"hour"`
+	// KWH is the expected usage during the hour
+	KWH float64 `json:"kwh"`
+	// Samples is the number of hours of history used
+	Samples int `json:"samples"`
+	// Outliers is the number of hours of history ignored
+	Outliers int `json:"outliers"`
+	// Blended is true if there wasn't enough history for the day type so
+	// every day was used
+	Blended bool `json:"blended"`
+}
+
+// LoadModel is the expected home load by hour for weekdays and weekends.
+// Holidays are treated as weekends.
+type LoadModel struct {
+	Weekday  []LoadProfile `json:"weekday"`
+	Weekend  []LoadProfile `json:"weekend"`
+	Holidays []string      `json:"holidays"`
+
+	holidays map[string]bool
+	loc      *time.Location
+}
+
+// isWeekend returns whether t is on a weekend or holiday.
+func (m LoadModel) isWeekend(t time.Time) bool {
+	t = t.In(m.loc)
+	if t.Weekday() == time.Saturday || t.Weekday() == time.Sunday {
+		return true
+	}
+	return m.holidays[t.Format(time.DateOnly)]
+}
+
+// At returns the expected home load in kWh for the hour containing t.
+func (m LoadModel) At(t time.Time) float64 {
+	profiles := m.Weekday
+	if m.isWeekend(t) {
+		profiles = m.Weekend
+	}
+	hour := t.In(m.loc).Hour()
+	if hour >= len(profiles) {
+		return 0
+	}
+	return profiles[hour].KWH
+}
+
+// loadPoint is a single hour of history and how much it counts.
+type loadPoint struct {
+	kwh    float64
+	weight float64
+}
+
+// BuildLoadModel builds the expected home load from history as of now. Recent
+// days count more than older ones, weekdays and weekends (including the
+// settings' holidays) are modeled separately in the site's timezone, and
+// outliers like a party or a trip are ignored using the median absolute
+// deviation.
+func BuildLoadModel(history []types.EnergyStats, now time.Time, settings types.Settings) LoadModel {
+	m := LoadModel{
+		Holidays: settings.Holidays,
+		holidays: make(map[string]bool, len(settings.Holidays)),
+		loc:      settings.Location(),
+	}
+	for _, h := range settings.Holidays {
+		m.holidays[h] = true
+	}
+
+	var weekday, weekend [24][]loadPoint
+	for _, h := range history {
+		if h.TSHourStart.IsZero() {
+			continue
+		}
+		ts := h.TSHourStart.In(m.loc)
+		age := now.Sub(ts)
+		if age < 0 {
+			age = 0
+		}
+		p := loadPoint{
+			kwh:    h.HomeKWH,
+			weight: math.Pow(0.5, float64(age)/float64(loadHalfLife)),
+		}
+		if m.isWeekend(ts) {
+			weekend[ts.Hour()] = append(weekend[ts.Hour()], p)
+		} else {
+			weekday[ts.Hour()] = append(weekday[ts.Hour()], p)
+		}
+	}
+
+	m.Weekday = make([]LoadProfile, 24)
+	m.Weekend = make([]LoadProfile, 24)
+	for hour := range 24 {
+		all := append(append([]loadPoint{}, weekday[hour]...), weekend[hour]...)
+		m.Weekday[hour] = buildLoadProfile(hour, weekday[hour], all, settings.LoadOutlierDeviations())
+		m.Weekend[hour] = buildLoadProfile(hour, weekend[hour], all, settings.LoadOutlierDeviations())
+	}
+	return m
+}
+
+// buildLoadProfile returns the robust weighted average of points, falling back
+// to all if there aren't enough points. Points more than outlierScale robust
+// standard deviations from the median are ignored.
+func buildLoadProfile(hour int, points []loadPoint, all []loadPoint, outlierScale float64) LoadProfile {
+	profile := LoadProfile{Hour: hour}
+	if len(points) < minLoadSamples && len(all) > len(points) {
+		points = all
+		profile.Blended = true
+	}
+	if len(points) == 0 {
+		return profile
+	}
+	// with so few points we can't tell which one is unusual
+	median, spread := 0.0, math.Inf(1)
+	if len(points) >= minLoadSamples {
+		median = weightedMedian(points, func(p loadPoint) float64 { return p.kwh })
+		mad := weightedMedian(points, func(p loadPoint) float64 { return math.Abs(p.kwh - median) })
+		// 1.4826 scales the MAD to a standard deviation for normal data
+		spread = math.Max(1.4826*mad, math.Max(minLoadSpreadKWH, 0.1*median))
+	}
+
+	var total, weights float64
+	for _, p := range points {
+		if math.Abs(p.kwh-median) > outlierScale*spread {
+			profile.Outliers++
+			continue
+		}
+		total += p.kwh * p.weight
+		weights += p.weight
+		profile.Samples++
+	}
+	if weights > 0 {
+		profile.KWH = total / weights
+	}
+	return profile
+}
+
+// weightedMedian returns the weighted median of value over points.
+func weightedMedian(points []loadPoint, value func(loadPoint) float64) float64 {
+	sorted := make([]loadPoint, len(points))
+	var total float64
+	for i, p := range points {
+		sorted[i] = loadPoint{kwh: value(p), weight: p.weight}
+		total += p.weight
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].kwh < sorted[j].kwh
+	})
+
+	var cumulative float64
+	for i, p := range sorted {
+		cumulative += p.weight
+		if cumulative > total/2 {
+			return p.kwh
+		}
+		// exactly half, average with the next point
+		if cumulative == total/2 && i+1 < len(sorted) {
+			return (p.kwh + sorted[i+1].kwh) / 2
+		}
+	}
+	return sorted[len(sorted)-1].kwh
+}
@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+)
+
+func TestBuildLoadModel(t *testing.T) {
+	// a Friday
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	utc := types.Settings{Timezone: "UTC"}
+
+	// days returns history at hour for each of the previous weekdays with kwh
+	days := func(hour int, kwh ...float64) []types.EnergyStats {
+		var history []types.EnergyStats
+		ts := time.Date(2026, 10, 15, hour, 0, 0, 0, time.UTC)
+		for _, v := range kwh {
+			for ts.Weekday() == time.Saturday || ts.Weekday() == time.Sunday {
+				ts = ts.AddDate(0, 0, -1)
+			}
+			history = append(history, types.EnergyStats{TSHourStart: ts, HomeKWH: v})
+			ts = ts.AddDate(0, 0, -1)
+		}
+		return history
+	}
+
+	t.Run("Weekday And Weekend", func(t *testing.T) {
+		var history []types.EnergyStats
+		for d := 1; d <= 14; d++ {
+			ts := now.Truncate(24*time.Hour).AddDate(0, 0, -d).Add(18 * time.Hour)
+			kwh := 1.0
+			if ts.Weekday() == time.Saturday || ts.Weekday() == time.Sunday {
+				kwh = 3.0
+			}
+			history = append(history, types.EnergyStats{TSHourStart: ts, HomeKWH: kwh})
+		}
+
+		m := BuildLoadModel(history, now, utc)
+		assert.InDelta(t, 1.0, m.Weekday[18].KWH, 0.001)
+		assert.InDelta(t, 3.0, m.Weekend[18].KWH, 0.001)
+		assert.Equal(t, 10, m.Weekday[18].Samples)
+		assert.Equal(t, 4, m.Weekend[18].Samples)
+		assert.False(t, m.Weekend[18].Blended)
+
+		// Friday evening vs Saturday evening
+		assert.InDelta(t, 1.0, m.At(time.Date(2026, 10, 16, 18, 30, 0, 0, time.UTC)), 0.001)
+		assert.InDelta(t, 3.0, m.At(time.Date(2026, 10, 17, 18, 30, 0, 0, time.UTC)), 0.001)
+		// no history for this hour
+		assert.InDelta(t, 0.0, m.At(time.Date(2026, 10, 17, 3, 0, 0, 0, time.UTC)), 0.001)
+	})
+
+	t.Run("Holiday", func(t *testing.T) {
+		m := BuildLoadModel(nil, now, types.Settings{Timezone: "UTC", Holidays: []string{"2026-10-19"}})
+		// a Monday
+		assert.True(t, m.isWeekend(time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)))
+		assert.False(t, m.isWeekend(time.Date(2026, 10, 20, 8, 0, 0, 0, time.UTC)))
+
+		// a holiday's usage counts as a weekend
+		history := days(8, 1.0, 1.0, 1.0)
+		history = append(history, types.EnergyStats{
+			TSHourStart: time.Date(2026, 10, 12, 8, 0, 0, 0, time.UTC),
+			HomeKWH:     4.0,
+		})
+		m = BuildLoadModel(history, now, types.Settings{Timezone: "UTC", Holidays: []string{"2026-10-12"}})
+		assert.Equal(t, 3, m.Weekday[8].Samples)
+		assert.InDelta(t, 1.0, m.Weekday[8].KWH, 0.001)
+	})
+
+	t.Run("Recency", func(t *testing.T) {
+		// yesterday counts twice as much as a week earlier
+		history := []types.EnergyStats{
+			{TSHourStart: now.Add(-24 * time.Hour), HomeKWH: 2.0},
+			{TSHourStart: now.Add(-8 * 24 * time.Hour), HomeKWH: 1.0},
+		}
+		m := BuildLoadModel(history, now, utc)
+		assert.InDelta(t, (2.0*2+1.0)/3, m.Weekday[12].KWH, 0.001)
+	})
+
+	t.Run("Outlier", func(t *testing.T) {
+		m := BuildLoadModel(days(20, 1.0, 1.1, 0.9, 10.0), now, utc)
+		assert.InDelta(t, 1.0, m.Weekday[20].KWH, 0.05)
+		assert.Equal(t, 1, m.Weekday[20].Outliers)
+		assert.Equal(t, 3, m.Weekday[20].Samples)
+	})
+
+	t.Run("Multiple Outliers", func(t *testing.T) {
+		m := BuildLoadModel(days(20, 1.0, 1.1, 0.9, 1.0, 8.0, 12.0), now, utc)
+		assert.InDelta(t, 1.0, m.Weekday[20].KWH, 0.05)
+		assert.Equal(t, 2, m.Weekday[20].Outliers)
+	})
+
+	t.Run("Not Enough Points for Outlier", func(t *testing.T) {
+		m := BuildLoadModel(days(20, 1.0, 10.0), now, utc)
+		assert.Equal(t, 0, m.Weekday[20].Outliers)
+		assert.Greater(t, m.Weekday[20].KWH, 1.0)
+		assert.Less(t, m.Weekday[20].KWH, 10.0)
+	})
+
+	t.Run("Blended", func(t *testing.T) {
+		// only weekday history so the weekend uses every day
+		m := BuildLoadModel(days(20, 2.0, 2.0, 2.0), now, utc)
+		assert.True(t, m.Weekend[20].Blended)
+		assert.InDelta(t, 2.0, m.Weekend[20].KWH, 0.001)
+		assert.False(t, m.Weekday[20].Blended)
+	})
+
+	t.Run("Time Zone", func(t *testing.T) {
+		// the server runs in UTC but 23:00 UTC is 18:00 at the site
+		m := BuildLoadModel(days(23, 1.5, 1.5, 1.5), now, types.Settings{Timezone: "America/Chicago"})
+		assert.InDelta(t, 1.5, m.Weekday[18].KWH, 0.001)
+		assert.InDelta(t, 1.5, m.At(time.Date(2026, 10, 16, 23, 0, 0, 0, time.UTC)), 0.001)
+		// early Saturday in UTC is still Friday evening at the site
+		assert.False(t, m.isWeekend(time.Date(2026, 10, 17, 2, 0, 0, 0, time.UTC)))
+	})
+
+	t.Run("Outlier Setting", func(t *testing.T) {
+		// 2.0 is more than 3.5 deviations away but not 10
+		history := days(20, 1.0, 1.1, 0.9, 1.0, 2.0)
+		m := BuildLoadModel(history, now, utc)
+		assert.Equal(t, 1, m.Weekday[20].Outliers)
+		m = BuildLoadModel(history, now, types.Settings{Timezone: "UTC", LoadOutlierStdDevs: 10})
+		assert.Equal(t, 0, m.Weekday[20].Outliers)
+	})
+}
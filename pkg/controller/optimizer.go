@@ -0,0 +1,350 @@
+package controller
+
+import (
+	"math"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+)
+
+// optimizerLevels is the number of discrete battery energy levels the
+// optimizer considers between empty and full.
+const optimizerLevels = 200
+
+// optimizerTieBreak is a tiny cost added to each mode so that when two modes
+// have the same cost we prefer using the battery, then holding, then charging.
+const optimizerTieBreak = 1e-6
+
+// simSlot is a single interval of the simulation timeline.
+type simSlot struct {
+	ts       time.Time
+	duration time.Duration
+	// netLoadKWH is the expected home load minus solar over the slot. Positive
+	// means we need energy, negative means we have surplus solar.
+	netLoadKWH float64
+	// importCost is the cost to pull 1kWh from the grid including fees.
+	importCost float64
+	// exportValue is the value of exporting 1kWh of surplus solar to the grid.
+	exportValue float64
+	// batteryExportValue is the value of exporting 1kWh from the battery to the
+	// grid.
+	batteryExportValue float64
+	// forceCharge requires the optimizer to charge during this slot.
+	forceCharge bool
+	// minEndKWH is the energy the battery should hold at the end of the slot
+	// to meet a SOC target. Each kWh short costs socTargetPenaltyPerKWH.
+	minEndKWH float64
+	// capacityPeak is why the slot is predicted to be a capacity peak or empty
+	// if it isn't. Its importCost includes the capacity peak penalty.
+	capacityPeak string
+	// switchPenalty is the extra cost per kWh of grid energy moved by using a
+	// mode other than currentMode. It's only set on the first slot to avoid
+	// switching modes for a tiny improvement.
+	currentMode   types.BatteryMode
+	switchPenalty float64
+}
+
+// hours returns the duration of the slot in hours.
+func (s simSlot) hours() float64 {
+	return s.duration.Hours()
+}
+
+// batteryModel describes the battery limits the optimizer must respect.
+type batteryModel struct {
+	capacityKWH  float64
+	minKWH       float64
+	chargeKW     float64
+	dischargeKW  float64
+	gridCharge   bool
+	chargeHurdle float64
+	gridExport   bool
+	// exportHurdle is the minimum profit per kWh required to export the battery
+	exportHurdle   float64
+	terminalPerKWH float64
+	// roundTripEfficiency is the fraction of energy charged that can later be
+	// discharged. 0 is treated as lossless.
+	roundTripEfficiency float64
+	// degradationPerKWH is the wear cost of discharging 1kWh from the battery.
+	degradationPerKWH float64
+	// maxDischargeKWH limits the total energy discharged over the timeline.
+	// 0 means there is no limit.
+	maxDischargeKWH float64
+	// maxImportKW is the most power we want to pull from the grid. Grid
+	// charging is capped to stay under it and any import above it costs
+	// peakPenaltyPerKW. 0 means there is no limit.
+	maxImportKW      float64
+	peakPenaltyPerKW float64
+}
+
+// limits returns the limits StepBattery needs.
+func (b batteryModel) limits() BatteryLimits {
+	return BatteryLimits{
+		CapacityKWH:         b.capacityKWH,
+		MinKWH:              b.minKWH,
+		ChargeKW:            b.chargeKW,
+		DischargeKW:         b.dischargeKW,
+		GridCharge:          b.gridCharge,
+		GridExport:          b.gridExport,
+		RoundTripEfficiency: b.roundTripEfficiency,
+		MaxImportKW:         b.maxImportKW,
+	}
+}
+
+// efficiencies returns the one-way charge and discharge efficiencies, split
+// evenly from the round trip efficiency.
+func (b batteryModel) efficiencies() (float64, float64) {
+	return b.limits().efficiencies()
+}
+
+// slotOutcome is the result of operating the battery in a mode for a slot.
+type slotOutcome struct {
+	mode          types.BatteryMode
+	endKWH        float64
+	gridImportKWH float64
+	gridExportKWH float64
+	gridChargeKWH float64
+	// batteryUseKWH is the energy delivered from the battery to the home
+	batteryUseKWH float64
+	// batteryExportKWH is the energy delivered from the battery to the grid
+	batteryExportKWH float64
+	// overLimitKW is how far the average grid import is above maxImportKW
+	overLimitKW float64
+	cost        float64
+}
+
+// planSlot is a single step of the optimized plan.
+type planSlot struct {
+	simSlot
+	slotOutcome
+	startKWH float64
+}
+
+// optimizerModes are the battery modes the optimizer chooses between in order
+// of preference when their costs are equal.
+var optimizerModes = []types.BatteryMode{
+	types.BatteryModeLoad,
+	types.BatteryModeStandby,
+	types.BatteryModeChargeAny,
+	types.BatteryModeExport,
+}
+
+// allowed returns whether the mode may be used for the slot.
+func (b batteryModel) allowed(slot simSlot, mode types.BatteryMode) bool {
+	if slot.forceCharge {
+		return mode == types.BatteryModeChargeAny
+	}
+	// without grid charging, charging is the same as standby
+	if mode == types.BatteryModeChargeAny && !b.gridCharge {
+		return false
+	}
+	if mode == types.BatteryModeExport && !b.gridExport {
+		return false
+	}
+	return true
+}
+
+// simulate returns the outcome of running the battery in mode for the slot
+// starting with startKWH stored in the battery.
+func (b batteryModel) simulate(slot simSlot, mode types.BatteryMode, startKWH float64) slotOutcome {
+	hours := slot.hours()
+	flows := StepBattery(b.limits(), mode, startKWH, slot.netLoadKWH, hours)
+	surplusExport := flows.GridExportKWH - flows.BatteryExportKWH
+
+	out := slotOutcome{
+		mode:             mode,
+		endKWH:           flows.EndKWH,
+		gridImportKWH:    flows.GridImportKWH,
+		gridExportKWH:    flows.GridExportKWH,
+		gridChargeKWH:    flows.GridChargeKWH,
+		batteryUseKWH:    flows.BatteryUseKWH,
+		batteryExportKWH: flows.BatteryExportKWH,
+	}
+	out.cost = out.gridImportKWH*slot.importCost -
+		surplusExport*slot.exportValue -
+		out.batteryExportKWH*(slot.batteryExportValue-b.exportHurdle) +
+		out.gridChargeKWH*b.chargeHurdle +
+		(out.batteryUseKWH+out.batteryExportKWH)*b.degradationPerKWH
+	out.overLimitKW = b.overLimitKW(out.gridImportKWH, hours)
+	out.cost += out.overLimitKW * b.peakPenaltyPerKW
+	out.cost += math.Max(0, slot.minEndKWH-out.endKWH) * socTargetPenaltyPerKWH
+	if slot.switchPenalty > 0 && slot.currentMode != types.BatteryModeNoChange && mode != slot.currentMode {
+		stay := slot
+		stay.switchPenalty = 0
+		cur := b.simulate(stay, slot.currentMode, startKWH)
+		out.cost += slot.switchPenalty * (math.Abs(out.gridImportKWH-cur.gridImportKWH) + math.Abs(out.gridExportKWH-cur.gridExportKWH))
+	}
+	return out
+}
+
+// overLimitKW returns how far the average import over hours is above
+// maxImportKW.
+func (b batteryModel) overLimitKW(importKWH, hours float64) float64 {
+	if b.maxImportKW <= 0 || hours <= 0 {
+		return 0
+	}
+	return math.Max(0, importKWH/hours-b.maxImportKW)
+}
+
+// optimizer finds the minimum cost battery schedule over a timeline using
+// dynamic programming over discretized battery energy.
+type optimizer struct {
+	battery batteryModel
+	slots   []simSlot
+	// dischargePenalty is an extra cost per kWh discharged used to keep the
+	// plan under the battery's maxDischargeKWH.
+	dischargePenalty float64
+
+	step float64
+	// costToGo[i][k] is the minimum cost from slot i onwards starting with
+	// k*step kWh in the battery.
+	costToGo [][]float64
+}
+
+func newOptimizer(battery batteryModel, slots []simSlot) *optimizer {
+	o := &optimizer{
+		battery: battery,
+		slots:   slots,
+		step:    battery.capacityKWH / optimizerLevels,
+	}
+	o.solve()
+	return o
+}
+
+// discharged returns the total energy delivered from the battery in the plan.
+func discharged(plan []planSlot) float64 {
+	var total float64
+	for _, p := range plan {
+		total += p.batteryUseKWH + p.batteryExportKWH
+	}
+	return total
+}
+
+// limitDischarge re-solves the optimizer with an increasing penalty on
+// discharging until the plan starting at startKWH discharges no more than the
+// battery's maxDischargeKWH. It returns the resulting plan and the optimizer
+// that produced it, which should be used to value the plan's stored energy.
+func (o *optimizer) limitDischarge(startKWH float64) ([]planSlot, *optimizer) {
+	plan := o.plan(startKWH)
+	limit := o.battery.maxDischargeKWH
+	if limit <= 0 || discharged(plan) <= limit {
+		return plan, o
+	}
+
+	// find the smallest penalty that keeps us under the limit by bisection
+	var maxCost float64
+	for _, slot := range o.slots {
+		maxCost = math.Max(maxCost, math.Abs(slot.importCost)+slot.exportValue+slot.batteryExportValue+o.battery.peakPenaltyPerKW/slot.hours())
+	}
+	low, high := 0.0, maxCost+1
+	bestOpt := o.withPenalty(high)
+	best := bestOpt.plan(startKWH)
+	for range 20 {
+		mid := (low + high) / 2
+		candidateOpt := o.withPenalty(mid)
+		candidate := candidateOpt.plan(startKWH)
+		if discharged(candidate) <= limit {
+			high = mid
+			best, bestOpt = candidate, candidateOpt
+		} else {
+			low = mid
+		}
+	}
+	return best, bestOpt
+}
+
+// withPenalty returns a new optimizer solved with the given discharge penalty.
+func (o *optimizer) withPenalty(penalty float64) *optimizer {
+	p := &optimizer{
+		battery:          o.battery,
+		slots:            o.slots,
+		dischargePenalty: penalty,
+		step:             o.step,
+	}
+	p.solve()
+	return p
+}
+
+// storedValue returns how much 1kWh of extra stored energy at slot i saves
+// over the rest of the timeline when the battery holds kwh.
+func (o *optimizer) storedValue(i int, kwh float64) float64 {
+	low := math.Max(0, kwh-o.step)
+	high := math.Min(o.battery.capacityKWH, low+o.step)
+	if high <= low {
+		return 0
+	}
+	return (o.valueAt(i, low) - o.valueAt(i, high)) / (high - low)
+}
+
+// valueAt linearly interpolates the cost to go at slot i for energy kWh.
+func (o *optimizer) valueAt(i int, kwh float64) float64 {
+	values := o.costToGo[i]
+	pos := kwh / o.step
+	if pos <= 0 {
+		return values[0]
+	}
+	if pos >= optimizerLevels {
+		return values[optimizerLevels]
+	}
+	k := int(pos)
+	frac := pos - float64(k)
+	return values[k]*(1-frac) + values[k+1]*frac
+}
+
+// solve fills in the cost to go for every slot and energy level, working
+// backwards from the end of the timeline.
+func (o *optimizer) solve() {
+	n := len(o.slots)
+	o.costToGo = make([][]float64, n+1)
+
+	// any energy left at the end of the timeline is worth what it would cost
+	// to put it back into the battery
+	terminal := make([]float64, optimizerLevels+1)
+	for k := range terminal {
+		terminal[k] = -float64(k) * o.step * o.battery.terminalPerKWH
+	}
+	o.costToGo[n] = terminal
+
+	for i := n - 1; i >= 0; i-- {
+		values := make([]float64, optimizerLevels+1)
+		for k := range values {
+			_, values[k] = o.best(i, float64(k)*o.step)
+		}
+		o.costToGo[i] = values
+	}
+}
+
+// best returns the cheapest outcome for slot i starting at startKWH along with
+// the total cost to the end of the timeline.
+func (o *optimizer) best(i int, startKWH float64) (slotOutcome, float64) {
+	slot := o.slots[i]
+	var bestOut slotOutcome
+	bestTotal := math.Inf(1)
+	for j, mode := range optimizerModes {
+		if !o.battery.allowed(slot, mode) {
+			continue
+		}
+		out := o.battery.simulate(slot, mode, startKWH)
+		total := out.cost + (out.batteryUseKWH+out.batteryExportKWH)*o.dischargePenalty + o.valueAt(i+1, out.endKWH) + float64(j)*optimizerTieBreak
+		if total < bestTotal {
+			bestOut = out
+			bestTotal = total
+		}
+	}
+	return bestOut, bestTotal
+}
+
+// plan walks forward from startKWH choosing the optimal mode for each slot.
+func (o *optimizer) plan(startKWH float64) []planSlot {
+	plan := make([]planSlot, 0, len(o.slots))
+	kwh := startKWH
+	for i, slot := range o.slots {
+		out, _ := o.best(i, kwh)
+		plan = append(plan, planSlot{
+			simSlot:     slot,
+			slotOutcome: out,
+			startKWH:    kwh,
+		})
+		kwh = out.endKWH
+	}
+	return plan
+}
@@ -0,0 +1,241 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptimizer(t *testing.T) {
+	start := time.Now().Truncate(time.Hour)
+
+	// helper to build hourly slots with the given import costs and net loads
+	makeSlots := func(costs []float64, loads []float64) []simSlot {
+		slots := make([]simSlot, len(costs))
+		for i := range costs {
+			slots[i] = simSlot{
+				ts:         start.Add(time.Duration(i) * time.Hour),
+				duration:   time.Hour,
+				netLoadKWH: loads[i],
+				importCost: costs[i],
+			}
+		}
+		return slots
+	}
+
+	battery := batteryModel{
+		capacityKWH: 10,
+		minKWH:      2,
+		chargeKW:    5,
+		gridCharge:  true,
+	}
+
+	t.Run("Charges In Cheapest Window", func(t *testing.T) {
+		// the evening peak needs 8kWh and the cheapest two hours are later in the
+		// day, not the first cheap-looking hour
+		costs := []float64{0.10, 0.12, 0.04, 0.04, 0.50, 0.50}
+		loads := []float64{0, 0, 0, 0, 4, 4}
+
+		plan := newOptimizer(battery, makeSlots(costs, loads)).plan(2)
+		require.Len(t, plan, 6)
+
+		assert.NotEqual(t, types.BatteryModeChargeAny, plan[0].mode)
+		assert.NotEqual(t, types.BatteryModeChargeAny, plan[1].mode)
+		assert.Equal(t, types.BatteryModeChargeAny, plan[2].mode)
+		assert.Equal(t, types.BatteryModeChargeAny, plan[3].mode)
+		assert.Equal(t, types.BatteryModeLoad, plan[4].mode)
+		assert.Equal(t, types.BatteryModeLoad, plan[5].mode)
+		assert.InDelta(t, 10.0, plan[3].endKWH, 0.1)
+	})
+
+	t.Run("Never Below Minimum", func(t *testing.T) {
+		costs := []float64{0.50, 0.50, 0.50}
+		loads := []float64{3, 3, 3}
+
+		plan := newOptimizer(battery, makeSlots(costs, loads)).plan(5)
+		for _, p := range plan {
+			assert.GreaterOrEqual(t, p.endKWH, battery.minKWH-0.001)
+		}
+		// only 3kWh was usable so the rest came from the grid
+		var imported float64
+		for _, p := range plan {
+			imported += p.gridImportKWH
+		}
+		assert.InDelta(t, 6.0, imported, 0.01)
+	})
+
+	t.Run("Forced Charge", func(t *testing.T) {
+		slots := makeSlots([]float64{0.50, 0.50}, []float64{1, 1})
+		slots[0].forceCharge = true
+
+		plan := newOptimizer(battery, slots).plan(5)
+		assert.Equal(t, types.BatteryModeChargeAny, plan[0].mode)
+		assert.Equal(t, types.BatteryModeLoad, plan[1].mode)
+	})
+
+	t.Run("No Grid Charge", func(t *testing.T) {
+		noGrid := battery
+		noGrid.gridCharge = false
+
+		costs := []float64{0.01, 0.50}
+		loads := []float64{0, 4}
+
+		plan := newOptimizer(noGrid, makeSlots(costs, loads)).plan(2)
+		for _, p := range plan {
+			assert.NotEqual(t, types.BatteryModeChargeAny, p.mode)
+			assert.Zero(t, p.gridChargeKWH)
+		}
+	})
+
+	t.Run("Charge Hurdle", func(t *testing.T) {
+		hurdle := battery
+		hurdle.chargeHurdle = 0.10
+
+		// 0.05 difference isn't worth the 0.10 hurdle
+		costs := []float64{0.10, 0.15}
+		loads := []float64{0, 4}
+
+		plan := newOptimizer(hurdle, makeSlots(costs, loads)).plan(2)
+		assert.NotEqual(t, types.BatteryModeChargeAny, plan[0].mode)
+	})
+
+	t.Run("Solar Surplus Exported When Full", func(t *testing.T) {
+		slots := makeSlots([]float64{0.10}, []float64{-3})
+		slots[0].exportValue = 0.10
+
+		plan := newOptimizer(battery, slots).plan(9)
+		assert.InDelta(t, 10.0, plan[0].endKWH, 0.001)
+		assert.InDelta(t, 2.0, plan[0].gridExportKWH, 0.001)
+	})
+
+	t.Run("Round Trip Losses", func(t *testing.T) {
+		lossy := battery
+		lossy.roundTripEfficiency = 0.8
+
+		// 0.10 -> 0.12 looks profitable but loses money after 20% losses
+		costs := []float64{0.10, 0.12}
+		loads := []float64{0, 4}
+
+		plan := newOptimizer(lossy, makeSlots(costs, loads)).plan(2)
+		assert.NotEqual(t, types.BatteryModeChargeAny, plan[0].mode)
+
+		// 0.10 -> 0.20 is still worth it
+		plan = newOptimizer(lossy, makeSlots([]float64{0.10, 0.20}, loads)).plan(2)
+		assert.Equal(t, types.BatteryModeChargeAny, plan[0].mode)
+		// 5kWh from the grid only delivers 4kWh to the home
+		assert.InDelta(t, 5.0, plan[0].gridChargeKWH, 0.01)
+		assert.InDelta(t, 4.0, plan[1].batteryUseKWH, 0.01)
+		assert.InDelta(t, battery.minKWH, plan[1].endKWH, 0.01)
+	})
+
+	t.Run("Degradation Cost", func(t *testing.T) {
+		worn := battery
+		worn.degradationPerKWH = 0.05
+
+		// saving 0.03/kWh by discharging isn't worth 0.05/kWh of wear
+		costs := []float64{0.10, 0.13}
+		loads := []float64{0, 4}
+
+		plan := newOptimizer(worn, makeSlots(costs, loads)).plan(2)
+		assert.NotEqual(t, types.BatteryModeChargeAny, plan[0].mode)
+	})
+
+	t.Run("Max Discharge", func(t *testing.T) {
+		limited := battery
+		limited.maxDischargeKWH = 4
+
+		// two expensive hours but we are only allowed to discharge 4kWh so it
+		// should be used during the most expensive one
+		costs := []float64{0.30, 0.50}
+		loads := []float64{4, 4}
+
+		base := newOptimizer(limited, makeSlots(costs, loads))
+		plan, opt := base.limitDischarge(10)
+		assert.LessOrEqual(t, discharged(plan), 4.01)
+		assert.NotEqual(t, types.BatteryModeLoad, plan[0].mode)
+		assert.Equal(t, types.BatteryModeLoad, plan[1].mode)
+		// the stored energy is valued by the penalized optimizer that made the
+		// plan
+		require.NotSame(t, base, opt)
+		assert.Greater(t, opt.dischargePenalty, 0.0)
+		assert.Less(t, opt.storedValue(1, 4), base.storedValue(1, 4))
+
+		// without a limit the optimizer is returned as is
+		free := newOptimizer(battery, makeSlots(costs, loads))
+		_, opt = free.limitDischarge(10)
+		assert.Same(t, free, opt)
+	})
+
+	t.Run("Battery Export", func(t *testing.T) {
+		exporter := battery
+		exporter.gridExport = true
+		exporter.exportHurdle = 0.01
+
+		// a price spike now is worth more than anything the energy could save
+		// later, but we need to keep enough for the evening
+		slots := makeSlots([]float64{0.80, 0.10, 0.30}, []float64{0, 0, 3})
+		for i := range slots {
+			slots[i].batteryExportValue = slots[i].importCost
+		}
+
+		plan := newOptimizer(exporter, slots).plan(10)
+		assert.Equal(t, types.BatteryModeExport, plan[0].mode)
+		assert.InDelta(t, 5.0, plan[0].batteryExportKWH, 0.01)
+		for _, p := range plan {
+			assert.GreaterOrEqual(t, p.endKWH, battery.minKWH-0.001)
+		}
+
+		// without export enabled it can't be chosen
+		plan = newOptimizer(battery, slots).plan(10)
+		assert.NotEqual(t, types.BatteryModeExport, plan[0].mode)
+	})
+
+	t.Run("Battery Export Hurdle", func(t *testing.T) {
+		exporter := battery
+		exporter.gridExport = true
+		exporter.exportHurdle = 0.10
+
+		// exporting at 0.35 isn't worth it when the energy saves 0.30 later
+		slots := makeSlots([]float64{0.35, 0.30}, []float64{0, 4})
+		for i := range slots {
+			slots[i].batteryExportValue = slots[i].importCost
+		}
+
+		plan := newOptimizer(exporter, slots).plan(6)
+		assert.NotEqual(t, types.BatteryModeExport, plan[0].mode)
+	})
+
+	t.Run("Max Import Caps Grid Charge", func(t *testing.T) {
+		limited := battery
+		limited.maxImportKW = 4
+
+		slot := makeSlots([]float64{0.05}, []float64{1})[0]
+		out := limited.simulate(slot, types.BatteryModeChargeAny, 2)
+		assert.InDelta(t, 3.0, out.gridChargeKWH, 0.001)
+		assert.InDelta(t, 4.0, out.gridImportKWH, 0.001)
+		assert.InDelta(t, 0.0, out.overLimitKW, 0.001)
+	})
+
+	t.Run("Saves Energy For Peak", func(t *testing.T) {
+		limited := battery
+		limited.gridCharge = false
+		limited.maxImportKW = 4
+		limited.peakPenaltyPerKW = 10
+
+		// flat prices so the only reason to hold is the 6kW peak
+		slots := makeSlots([]float64{0.10, 0.10, 0.10}, []float64{1, 1, 6})
+
+		plan := newOptimizer(limited, slots).plan(4)
+		assert.Equal(t, types.BatteryModeStandby, plan[0].mode)
+		assert.Equal(t, types.BatteryModeStandby, plan[1].mode)
+		assert.Equal(t, types.BatteryModeLoad, plan[2].mode)
+		assert.InDelta(t, 4.0, plan[2].gridImportKWH, 0.05)
+
+		// without a limit the battery is used right away
+		plan = newOptimizer(battery, slots).plan(4)
+		assert.Equal(t, types.BatteryModeLoad, plan[0].mode)
+	})
+}
@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+)
+
+// planSteps converts the optimized plan into steps that explain what the
+// battery is expected to do in each interval and why.
+func (o *optimizer) planSteps(plan []planSlot) []types.PlanStep {
+	capacity := o.battery.capacityKWH
+	steps := make([]types.PlanStep, 0, len(plan))
+	for i, p := range plan {
+		stored := o.storedValue(i+1, p.endKWH)
+		steps = append(steps, types.PlanStep{
+			TSStart:             p.ts,
+			TSEnd:               p.ts.Add(p.duration),
+			BatteryMode:         p.mode,
+			Reason:              o.stepReason(p, stored),
+			DollarsPerKWH:       p.importCost,
+			ExportDollarsPerKWH: p.batteryExportValue,
+			StoredDollarsPerKWH: stored,
+			NetLoadKWH:          p.netLoadKWH,
+			StartSOC:            100 * p.startKWH / capacity,
+			EndSOC:              100 * p.endKWH / capacity,
+			GridImportKWH:       p.gridImportKWH,
+			GridExportKWH:       p.gridExportKWH,
+			GridChargeKWH:       p.gridChargeKWH,
+			BatteryUsedKWH:      p.batteryUseKWH,
+			BatteryExportKWH:    p.batteryExportKWH,
+			Cost:                p.cost,
+		})
+	}
+	return steps
+}
+
+// stepReason explains why the mode was chosen for the step given what 1kWh
+// left in the battery afterwards is worth.
+func (o *optimizer) stepReason(p planSlot, stored float64) string {
+	var reason string
+	switch p.mode {
+	case types.BatteryModeLoad:
+		switch {
+		case p.netLoadKWH <= 0:
+			reason = "Solar covers the home."
+		case p.batteryUseKWH <= 0.001 && p.startKWH <= o.battery.minKWH+0.001:
+			reason = "Battery at minimum."
+		default:
+			reason = fmt.Sprintf("Using battery instead of grid at %.3f (worth %.3f later).", p.importCost, stored)
+		}
+	case types.BatteryModeStandby:
+		switch {
+		case p.netLoadKWH <= 0:
+			reason = "Solar covers the home."
+		case p.startKWH <= o.battery.minKWH+0.001:
+			reason = "Battery at minimum."
+		default:
+			reason = fmt.Sprintf("Holding battery for later, worth %.3f vs grid at %.3f.", stored, p.importCost)
+		}
+	case types.BatteryModeChargeAny:
+		if p.forceCharge {
+			reason = "Price under always charge threshold."
+		} else {
+			reason = fmt.Sprintf("Charging at %.3f, worth %.3f later.", p.importCost, stored)
+		}
+	case types.BatteryModeExport:
+		reason = fmt.Sprintf("Exporting at %.3f, worth %.3f later.", p.batteryExportValue, stored)
+	}
+	if p.overLimitKW > 0 {
+		reason += fmt.Sprintf(" Over grid limit by %.1fkW.", math.Round(p.overLimitKW*10)/10)
+	}
+	if p.capacityPeak != "" {
+		reason += fmt.Sprintf(" Capacity peak (%s).", p.capacityPeak)
+	}
+	if p.minEndKWH > 0 {
+		targetSOC := 100 * p.minEndKWH / o.battery.capacityKWH
+		if p.endKWH < p.minEndKWH-0.001 {
+			reason += fmt.Sprintf(" Short of %.0f%% SOC target.", targetSOC)
+		} else {
+			reason += fmt.Sprintf(" Meets %.0f%% SOC target.", targetSOC)
+		}
+	}
+	return reason
+}
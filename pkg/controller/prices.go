@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+)
+
+// minPriceInterval is the shortest price interval the controller simulates.
+const minPriceInterval = 5 * time.Minute
+
+// priceSpan returns the start and end of the interval the price covers. Prices
+// without an end are assumed to cover the hour they start in.
+func priceSpan(p types.Price) (time.Time, time.Time) {
+	if p.TSEnd.After(p.TSStart) {
+		return p.TSStart, p.TSEnd
+	}
+	start := p.TSStart.Truncate(time.Hour)
+	return start, start.Add(time.Hour)
+}
+
+// priceInterval determines the simulation interval from the future prices. It
+// returns the shortest interval that evenly divides an hour, defaulting to an
+// hour if the prices don't specify anything shorter. The current price isn't
+// used since it can cover a partial interval that's still in progress.
+func priceInterval(futurePrices []types.Price) time.Duration {
+	interval := time.Hour
+	for _, fp := range futurePrices {
+		if !fp.TSEnd.After(fp.TSStart) {
+			continue
+		}
+		d := fp.TSEnd.Sub(fp.TSStart)
+		if d < minPriceInterval || d >= interval || time.Hour%d != 0 {
+			continue
+		}
+		interval = d
+	}
+	return interval
+}
+
+// priceAt returns the price covering t from prices and whether one was found.
+// If multiple prices cover t, the shortest one wins since it is more specific.
+func priceAt(prices []types.Price, t time.Time) (types.Price, bool) {
+	var found bool
+	var price types.Price
+	var shortest time.Duration
+	for _, p := range prices {
+		start, end := priceSpan(p)
+		if t.Before(start) || !t.Before(end) {
+			continue
+		}
+		if d := end.Sub(start); !found || d < shortest {
+			found = true
+			price = p
+			shortest = d
+		}
+	}
+	return price, found
+}
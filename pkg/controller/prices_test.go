@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPriceInterval(t *testing.T) {
+	now := time.Now().Truncate(time.Hour)
+
+	t.Run("Default Hourly", func(t *testing.T) {
+		futurePrices := []types.Price{
+			{TSStart: now.Add(time.Hour), DollarsPerKWH: 0.10},
+		}
+		assert.Equal(t, time.Hour, priceInterval(futurePrices))
+	})
+
+	t.Run("Five Minute", func(t *testing.T) {
+		futurePrices := []types.Price{
+			{TSStart: now.Add(time.Hour), TSEnd: now.Add(time.Hour + 5*time.Minute)},
+		}
+		assert.Equal(t, 5*time.Minute, priceInterval(futurePrices))
+	})
+
+	t.Run("Fifteen Minute Future", func(t *testing.T) {
+		futurePrices := []types.Price{
+			{TSStart: now, TSEnd: now.Add(time.Hour)},
+			{TSStart: now.Add(time.Hour), TSEnd: now.Add(75 * time.Minute)},
+		}
+		assert.Equal(t, 15*time.Minute, priceInterval(futurePrices))
+	})
+
+	t.Run("Ignores Odd Intervals", func(t *testing.T) {
+		futurePrices := []types.Price{
+			{TSStart: now, TSEnd: now.Add(7 * time.Minute)},
+			{TSStart: now, TSEnd: now.Add(time.Minute)},
+		}
+		assert.Equal(t, time.Hour, priceInterval(futurePrices))
+	})
+}
+
+func TestPriceAt(t *testing.T) {
+	now := time.Now().Truncate(time.Hour)
+	prices := []types.Price{
+		// legacy price with no end covers the whole hour
+		{TSStart: now.Add(10 * time.Minute), DollarsPerKWH: 0.10},
+		{TSStart: now.Add(time.Hour), TSEnd: now.Add(2 * time.Hour), DollarsPerKWH: 0.20},
+		{TSStart: now.Add(time.Hour + 5*time.Minute), TSEnd: now.Add(time.Hour + 10*time.Minute), DollarsPerKWH: 0.90},
+	}
+
+	price, ok := priceAt(prices, now.Add(30*time.Minute))
+	assert.True(t, ok)
+	assert.Equal(t, 0.10, price.DollarsPerKWH)
+
+	price, ok = priceAt(prices, now.Add(time.Hour))
+	assert.True(t, ok)
+	assert.Equal(t, 0.20, price.DollarsPerKWH)
+
+	// the shorter interval wins
+	price, ok = priceAt(prices, now.Add(time.Hour+5*time.Minute))
+	assert.True(t, ok)
+	assert.Equal(t, 0.90, price.DollarsPerKWH)
+
+	_, ok = priceAt(prices, now.Add(2*time.Hour))
+	assert.False(t, ok)
+}
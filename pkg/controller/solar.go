@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/forecast"
+	"github.com/jameshartig/autoenergy/pkg/types"
+)
+
+// minSolarSamples is the number of days of history for an hour before the
+// solar prior is ignored.
+const minSolarSamples = 3
+
+// solarPrior returns the expected solar kWh for the hour starting at
+// hourStart when there isn't enough history.
+type solarPrior func(hourStart time.Time) float64
+
+// clearSkySolarPrior returns the clear-sky model calibrated against history as
+// a prior. It returns nil if the solar array isn't configured in settings.
+func clearSkySolarPrior(ctx context.Context, history []types.EnergyStats, settings types.Settings) solarPrior {
+	site, ok := forecast.SiteFromSettings(settings)
+	if !ok {
+		return nil
+	}
+	model := forecast.NewClearSky(site)
+	model.Calibrate(history)
+	slog.DebugContext(ctx, "clear-sky solar prior", slog.Float64("derate", model.Derate()))
+	return model.HourlyKWH
+}
+
+// solarAt returns the expected solar kWh for the hour containing t from the
+// hour of day averages in model. Hours with fewer than minSolarSamples of
+// history blend in the prior for t's own date so each day of the horizon
+// sees that day's sun angle.
+func solarAt(model map[int]timeProfile, prior solarPrior, t time.Time) float64 {
+	profile := model[t.Hour()]
+	if prior == nil || profile.Samples >= minSolarSamples {
+		return profile.AvgSolar
+	}
+	total := profile.AvgSolar * float64(profile.Samples)
+	return (total + prior(t.Truncate(time.Hour))*float64(minSolarSamples-profile.Samples)) / minSolarSamples
+}
+
+// solarForecastAt returns the forecasted solar kWh for the hour containing t
+// and whether the forecast covers t. Hours missing inside the forecast's range
+// are assumed to have no solar since forecasts skip the night.
+func solarForecastAt(forecast []types.SolarForecast, t time.Time) (float64, bool) {
+	if len(forecast) == 0 {
+		return 0, false
+	}
+	first, last := forecast[0].TSHourStart, forecast[0].TSHourStart
+	for _, f := range forecast {
+		if !t.Before(f.TSHourStart) && t.Before(f.TSHourStart.Add(time.Hour)) {
+			return f.KWH, true
+		}
+		if f.TSHourStart.Before(first) {
+			first = f.TSHourStart
+		}
+		if f.TSHourStart.After(last) {
+			last = f.TSHourStart
+		}
+	}
+	if !t.Before(first) && t.Before(last.Add(time.Hour)) {
+		return 0, true
+	}
+	return 0, false
+}
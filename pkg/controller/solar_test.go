@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSolarForecastAt(t *testing.T) {
+	now := time.Now().Truncate(time.Hour)
+	forecast := []types.SolarForecast{
+		{TSHourStart: now, KWH: 1.5},
+		// no entry for now+1h
+		{TSHourStart: now.Add(2 * time.Hour), KWH: 3.0},
+	}
+
+	kwh, ok := solarForecastAt(forecast, now.Add(30*time.Minute))
+	assert.True(t, ok)
+	assert.Equal(t, 1.5, kwh)
+
+	// gaps inside the forecast mean no solar
+	kwh, ok = solarForecastAt(forecast, now.Add(time.Hour))
+	assert.True(t, ok)
+	assert.Zero(t, kwh)
+
+	kwh, ok = solarForecastAt(forecast, now.Add(2*time.Hour+5*time.Minute))
+	assert.True(t, ok)
+	assert.Equal(t, 3.0, kwh)
+
+	_, ok = solarForecastAt(forecast, now.Add(3*time.Hour))
+	assert.False(t, ok)
+
+	_, ok = solarForecastAt(nil, now)
+	assert.False(t, ok)
+}
+
+func TestSolarAt(t *testing.T) {
+	c := NewController()
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Hour)
+	other := now.Add(-time.Hour)
+	tomorrow := now.Add(24 * time.Hour)
+
+	// the prior is brighter tomorrow to check it's used for each date
+	prior := func(hourStart time.Time) float64 {
+		if hourStart.Equal(tomorrow) {
+			return 6.0
+		}
+		return 3.0
+	}
+
+	model := c.buildHourlyEnergyModel(ctx, []types.EnergyStats{
+		{TSHourStart: now, HomeKWH: 1.0, SolarKWH: 0.0},
+		{TSHourStart: other, HomeKWH: 1.0, SolarKWH: 1.5},
+	}, now)
+
+	// one day of history gets blended with two days of the prior
+	// (0 + 3 + 3) / 3 = 2.0
+	assert.InDelta(t, 2.0, solarAt(model, prior, now), 0.001)
+	// (0 + 6 + 6) / 3 = 4.0
+	assert.InDelta(t, 4.0, solarAt(model, prior, tomorrow), 0.001)
+	// hours without history use the prior
+	assert.InDelta(t, 3.0, solarAt(model, prior, now.Add(-2*time.Hour)), 0.001)
+	// without a prior only the history is used
+	assert.InDelta(t, 0.0, solarAt(model, nil, now), 0.001)
+
+	// enough history ignores the prior
+	model = c.buildHourlyEnergyModel(ctx, []types.EnergyStats{
+		{TSHourStart: now, SolarKWH: 0.0},
+		{TSHourStart: now.Add(-24 * time.Hour), SolarKWH: 0.0},
+		{TSHourStart: now.Add(-48 * time.Hour), SolarKWH: 0.0},
+	}, now)
+	assert.InDelta(t, 0.0, solarAt(model, prior, tomorrow), 0.001)
+}
@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+)
+
+// DefaultStrategy is the name of the strategy used when none is configured.
+const DefaultStrategy = "heuristic"
+
+// Strategy decides what the ESS should do next.
+type Strategy interface {
+	Decide(
+		ctx context.Context,
+		currentStatus types.SystemStatus,
+		currentPrice types.Price,
+		futurePrices []types.Price,
+		history []types.EnergyStats,
+		solarForecast []types.SolarForecast,
+		recentActions []types.Action,
+		settings types.Settings,
+	) (Decision, error)
+}
+
+// ClockedStrategy is a Strategy that can decide as of a time other than now,
+// such as when replaying history.
+type ClockedStrategy interface {
+	Strategy
+	SetClock(now func() time.Time)
+}
+
+var _ ClockedStrategy = (*Controller)(nil)
+
+var (
+	strategiesMu sync.RWMutex
+	strategies   = map[string]func() Strategy{
+		DefaultStrategy: func() Strategy { return NewController() },
+	}
+)
+
+// RegisterStrategy makes a strategy available by name. It panics if the name
+// is already registered.
+func RegisterStrategy(name string, fn func() Strategy) {
+	strategiesMu.Lock()
+	defer strategiesMu.Unlock()
+	if _, ok := strategies[name]; ok {
+		panic(fmt.Sprintf("strategy already registered: %s", name))
+	}
+	strategies[name] = fn
+}
+
+// NewStrategy returns a new instance of the named strategy. An empty name
+// returns the DefaultStrategy.
+func NewStrategy(name string) (Strategy, error) {
+	if name == "" {
+		name = DefaultStrategy
+	}
+	strategiesMu.RLock()
+	fn, ok := strategies[name]
+	strategiesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy: %s", name)
+	}
+	return fn(), nil
+}
+
+// Strategies returns the names of every registered strategy in order.
+func Strategies() []string {
+	strategiesMu.RLock()
+	defer strategiesMu.RUnlock()
+	names := make([]string, 0, len(strategies))
+	for name := range strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
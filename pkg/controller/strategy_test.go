@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type standbyStrategy struct{}
+
+func (standbyStrategy) Decide(context.Context, types.SystemStatus, types.Price, []types.Price, []types.EnergyStats, []types.SolarForecast, []types.Action, types.Settings) (Decision, error) {
+	return Decision{Action: types.Action{BatteryMode: types.BatteryModeStandby}}, nil
+}
+
+func TestStrategies(t *testing.T) {
+	t.Run("Default", func(t *testing.T) {
+		s, err := NewStrategy("")
+		require.NoError(t, err)
+		assert.IsType(t, &Controller{}, s)
+
+		s, err = NewStrategy(DefaultStrategy)
+		require.NoError(t, err)
+		assert.IsType(t, &Controller{}, s)
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		_, err := NewStrategy("unknown")
+		assert.Error(t, err)
+	})
+
+	t.Run("Register", func(t *testing.T) {
+		RegisterStrategy("test-standby", func() Strategy { return standbyStrategy{} })
+		assert.Contains(t, Strategies(), "test-standby")
+		assert.Contains(t, Strategies(), DefaultStrategy)
+
+		s, err := NewStrategy("test-standby")
+		require.NoError(t, err)
+		decision, err := s.Decide(context.Background(), types.SystemStatus{}, types.Price{}, nil, nil, nil, nil, types.Settings{})
+		require.NoError(t, err)
+		assert.Equal(t, types.BatteryModeStandby, decision.Action.BatteryMode)
+
+		// names can only be registered once
+		assert.Panics(t, func() {
+			RegisterStrategy("test-standby", func() Strategy { return standbyStrategy{} })
+		})
+	})
+}
@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"math"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+)
+
+// socTargetPenaltyPerKWH is the cost for each kWh the battery is short of a
+// SOC target so the optimizer meets the target whenever it can.
+const socTargetPenaltyPerKWH = 10.0
+
+// socDeadline is a SOC target's deadline within the simulation timeline.
+type socDeadline struct {
+	target   types.SOCTarget
+	deadline time.Time
+	kwh      float64
+}
+
+// applySOCTargets sets the minimum energy at the end of the last slot before
+// each target deadline in the timeline and returns the target that set it,
+// keyed by slot index. Recurring deadlines are in loc.
+func applySOCTargets(slots []simSlot, targets []types.SOCTarget, capacityKWH float64, loc *time.Location) map[int]socDeadline {
+	if len(slots) == 0 || len(targets) == 0 {
+		return nil
+	}
+	last := slots[len(slots)-1]
+	start, end := slots[0].ts, last.ts.Add(last.duration)
+
+	applied := make(map[int]socDeadline)
+	for _, target := range targets {
+		kwh := capacityKWH * math.Min(100, target.SOC) / 100
+		if kwh <= 0 {
+			continue
+		}
+		for _, deadline := range target.Deadlines(start, end, loc) {
+			// a deadline within the first slot can only apply to that slot
+			idx := 0
+			for i, slot := range slots {
+				if !slot.ts.Add(slot.duration).After(deadline) {
+					idx = i
+				}
+			}
+			if kwh <= slots[idx].minEndKWH {
+				continue
+			}
+			slots[idx].minEndKWH = kwh
+			applied[idx] = socDeadline{target: target, deadline: deadline, kwh: kwh}
+		}
+	}
+	return applied
+}
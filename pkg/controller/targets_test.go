@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+)
+
+func TestApplySOCTargets(t *testing.T) {
+	loc, err := time.LoadLocation("America/Chicago")
+	require.NoError(t, err)
+	// Friday at 10am UTC, which is 5am in Chicago
+	start := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	var slots []simSlot
+	for i := range 72 {
+		slots = append(slots, simSlot{ts: start.Add(time.Duration(i) * time.Hour), duration: time.Hour})
+	}
+
+	applied := applySOCTargets(slots, []types.SOCTarget{
+		{
+			Name: "Weekday Peak",
+			SOC:  90,
+			Time: "16:00",
+			Days: []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+		},
+		// a deadline in the middle of a slot applies to the slot before it
+		{Name: "Outage", SOC: 100, Deadline: start.Add(30*time.Hour + 30*time.Minute)},
+		// outside of the timeline
+		{SOC: 100, Deadline: start.Add(-time.Hour)},
+	}, 10, loc)
+
+	// only Friday is a weekday in the timeline and 4pm is in Chicago time, not
+	// the server's
+	require.Len(t, applied, 2)
+	assert.Equal(t, 9.0, slots[10].minEndKWH)
+	assert.Equal(t, "Weekday Peak", applied[10].target.Name)
+	assert.True(t, applied[10].deadline.Equal(time.Date(2026, 10, 16, 16, 0, 0, 0, loc)))
+	assert.Equal(t, 10.0, slots[29].minEndKWH)
+	assert.Equal(t, "Outage", applied[29].target.Name)
+
+	for i, slot := range slots {
+		if i != 10 && i != 29 {
+			assert.Zero(t, slot.minEndKWH, i)
+		}
+	}
+}
+
+func TestSOCTargetDeadlines(t *testing.T) {
+	loc, err := time.LoadLocation("America/Chicago")
+	require.NoError(t, err)
+	start := time.Date(2026, 10, 16, 17, 0, 0, 0, loc)
+
+	// every day at 4pm, today's has already passed
+	daily := types.SOCTarget{SOC: 80, Time: "16:00"}
+	deadlines := daily.Deadlines(start, start.Add(48*time.Hour), loc)
+	require.Len(t, deadlines, 2)
+	assert.True(t, deadlines[0].Equal(time.Date(2026, 10, 17, 16, 0, 0, 0, loc)))
+	assert.True(t, deadlines[1].Equal(time.Date(2026, 10, 18, 16, 0, 0, 0, loc)))
+
+	// weekends only
+	daily.Days = []time.Weekday{time.Sunday}
+	deadlines = daily.Deadlines(start, start.Add(48*time.Hour), loc)
+	require.Len(t, deadlines, 1)
+	assert.Equal(t, time.Sunday, deadlines[0].Weekday())
+
+	assert.Empty(t, types.SOCTarget{SOC: 80, Time: "4pm"}.Deadlines(start, start.Add(48*time.Hour), loc))
+
+	// a UTC start still resolves 4pm in the site's timezone
+	deadlines = types.SOCTarget{SOC: 80, Time: "16:00"}.Deadlines(start.UTC(), start.Add(24*time.Hour).UTC(), loc)
+	require.Len(t, deadlines, 1)
+	assert.True(t, deadlines[0].Equal(time.Date(2026, 10, 17, 16, 0, 0, 0, loc)))
+}
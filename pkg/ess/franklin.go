@@ -363,7 +363,19 @@ func (f *Franklin) GetStatus(ctx context.Context) (types.SystemStatus, error) {
 		return types.SystemStatus{}, err
 	}
 
+	// the runtime data doesn't say when it was measured so use the gateway's
+	// clock and leave it zero, which skips the staleness check, if it's unknown
+	var ts time.Time
+	if di.DeviceTime != "" {
+		ts, err = di.parseDeviceTime(di.DeviceTime)
+		if err != nil {
+			slog.WarnContext(ctx, "failed to parse franklin device time", slog.String("time", di.DeviceTime), slog.Any("error", err))
+			ts = time.Time{}
+		}
+	}
+
 	return types.SystemStatus{
+		Timestamp:             ts,
 		BatterySOC:            rd.RuntimeData.SOC,
 		EachBatterySOC:        rd.RuntimeData.EachSOC,
 		BatteryKW:             rd.RuntimeData.PowerBattery,
@@ -685,6 +697,19 @@ func (f *Franklin) SetModes(ctx context.Context, bat types.BatteryMode, sol type
 				updatedPC = true
 			}
 		}
+	case types.BatteryModeExport:
+		// exporting works like using the battery except we also allow the
+		// battery to feed the grid below
+		if !f.settings.GridExportBatteries {
+			slog.WarnContext(ctx, "battery export is not enabled")
+			return errors.New("battery export is not enabled")
+		}
+		soc = minBatterySOC
+		updatedModeOrSOC = true
+		if pc.GridMaxFlag != GridMaxFlagNoChargeFromGrid {
+			pc.GridMaxFlag = GridMaxFlagNoChargeFromGrid
+			updatedPC = true
+		}
 	case types.BatteryModeStandby:
 		rd, err := f.getRuntimeData(ctx)
 		if err != nil {
@@ -740,6 +765,38 @@ func (f *Franklin) SetModes(ctx context.Context, bat types.BatteryMode, sol type
 		return fmt.Errorf("unknown solar mode: %v", sol)
 	}
 
+	// cap how much power we pull from the grid while charging from it and
+	// remove the cap once the max grid use is cleared
+	if pc.GridMaxFlag == GridMaxFlagChargeFromGrid {
+		if f.settings.MaxGridUseKW > 0 && pc.GridMax != f.settings.MaxGridUseKW {
+			pc.GridMax = f.settings.MaxGridUseKW
+			updatedPC = true
+		} else if f.settings.MaxGridUseKW <= 0 && pc.GridMax > 0 {
+			pc.GridMax = gridMaxUncapped
+			updatedPC = true
+		}
+	}
+
+	// the battery should only feed the grid while we're exporting it
+	switch bat {
+	case types.BatteryModeExport:
+		if pc.GridFeedMaxFlag != GridFeedMaxFlagBatteryAndSolar {
+			pc.GridFeedMaxFlag = GridFeedMaxFlagBatteryAndSolar
+			updatedPC = true
+		}
+	case types.BatteryModeNoChange:
+		// leave exporting as is
+	default:
+		if pc.GridFeedMaxFlag == GridFeedMaxFlagBatteryAndSolar {
+			if f.settings.GridExportSolar && sol != types.SolarModeNoExport {
+				pc.GridFeedMaxFlag = GridFeedMaxFlagSolarOnly
+			} else {
+				pc.GridFeedMaxFlag = GridFeedMaxFlagNoExport
+			}
+			updatedPC = true
+		}
+	}
+
 	if updatedModeOrSOC {
 		if f.settings.DryRun {
 			if alreadySC {
@@ -1048,12 +1105,28 @@ type deviceInfoV2Result struct {
 	// TODO: sleepStatus, blackSleepFlag
 }
 
+// parseDeviceTime parses a time reported by the gateway in its time zone.
+func (di deviceInfoV2Result) parseDeviceTime(value string) (time.Time, error) {
+	// an empty zone would load as UTC and shift the time by the UTC offset
+	if di.TimeZone == "" {
+		return time.Time{}, errors.New("missing time zone")
+	}
+	loc, err := time.LoadLocation(di.TimeZone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.ParseInLocation("2006-01-02 15:04:05", value, loc)
+}
+
 type batteryInfo struct {
 	Serial     int `json:"id"`
 	CapacityWH int `json:"rateBatCap"`
 	PowerW     int `json:"ratedPwr"`
 }
 
+// gridMaxUncapped is the gridMax that doesn't limit grid import.
+const gridMaxUncapped = -1.0
+
 type gridMaxFlag int
 
 const (
@@ -103,7 +103,11 @@ func TestFranklin(t *testing.T) {
 				json.NewEncoder(w).Encode(map[string]interface{}{
 					"code":    200.0,
 					"success": true,
-					"result":  map[string]interface{}{"totalCap": 30.0},
+					"result": map[string]interface{}{
+						"totalCap":   30.0,
+						"deviceTime": "2026-02-01 12:05:00",
+						"zoneInfo":   "America/Chicago",
+					},
 				})
 				return
 			}
@@ -159,6 +163,7 @@ func TestFranklin(t *testing.T) {
 		require.NoError(t, err, "GetStatus should succeed")
 
 		assert.Equal(t, 88.5, status.BatterySOC, "BatterySOC should match")
+		assert.Equal(t, time.Date(2026, 2, 1, 18, 5, 0, 0, time.UTC), status.Timestamp.UTC(), "Timestamp should be the device time")
 		assert.Equal(t, 30.0, status.BatteryCapacityKWH, "BatteryCapacityKWH should match")
 		assert.True(t, status.CanExportSolar, "CanExportSolar should be true")
 		assert.True(t, status.CanExportBattery, "CanExportBattery should be true")
@@ -370,6 +375,135 @@ func TestFranklin(t *testing.T) {
 		assert.Equal(t, "setPowerControlV2", callOrder[1], "setPowerControlV2 should be called second")
 	})
 
+	t.Run("SetModes Export", func(t *testing.T) {
+		var callOrder []string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/hes-gateway/terminal/initialize/appUserOrInstallerLogin" {
+				json.NewEncoder(w).Encode(map[string]interface{}{"code": 200.0, "success": true, "result": map[string]interface{}{"token": "tok"}})
+				return
+			}
+			if r.URL.Path == "/hes-gateway/terminal/tou/getGatewayTouListV2" {
+				list := []map[string]interface{}{
+					{"id": 20.0, "workMode": 2.0, "electricityType": 1.0, "editSocFlag": true},
+				}
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"code":    200.0,
+					"success": true,
+					"result":  map[string]interface{}{"list": list, "currendId": 20.0},
+				})
+				return
+			}
+			if r.URL.Path == "/hes-gateway/terminal/tou/getPowerControlSetting" {
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"code":    200.0,
+					"success": true,
+					"result":  map[string]interface{}{"gridMaxFlag": 2, "gridFeedMaxFlag": 1},
+				})
+				return
+			}
+			if r.URL.Path == "/hes-gateway/terminal/tou/updateSocV2" {
+				callOrder = append(callOrder, "updateSocV2")
+				require.NoError(t, r.ParseForm())
+				assert.Equal(t, "20", r.Form.Get("soc"), "soc should be the minimum for Export")
+				json.NewEncoder(w).Encode(map[string]interface{}{"code": 200.0, "success": true, "result": nil})
+				return
+			}
+			if r.URL.Path == "/hes-gateway/terminal/tou/setPowerControlV2" {
+				callOrder = append(callOrder, "setPowerControlV2")
+				var data map[string]interface{}
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&data))
+				assert.EqualValues(t, 2, data["gridFeedMaxFlag"], "gridFeedMaxFlag should be 2 to export the battery")
+				assert.EqualValues(t, 1, data["gridMaxFlag"], "gridMaxFlag should be 1 to not charge from the grid")
+				json.NewEncoder(w).Encode(map[string]interface{}{"code": 200.0, "success": true, "result": map[string]interface{}{}})
+				return
+			}
+			http.Error(w, "not found "+r.URL.Path, 404)
+		}))
+		defer ts.Close()
+
+		f := &Franklin{
+			client:    ts.Client(),
+			baseURL:   ts.URL,
+			username:  "u",
+			password:  "p",
+			gatewayID: "g",
+		}
+
+		// exporting isn't allowed unless the settings allow it
+		require.NoError(t, f.ApplySettings(context.Background(), types.Settings{MinBatterySOC: 20, GridExportSolar: true}))
+		err := f.SetModes(context.Background(), types.BatteryModeExport, types.SolarModeAny)
+		assert.Error(t, err)
+		assert.Empty(t, callOrder)
+
+		require.NoError(t, f.ApplySettings(context.Background(), types.Settings{MinBatterySOC: 20, GridExportSolar: true, GridExportBatteries: true}))
+		err = f.SetModes(context.Background(), types.BatteryModeExport, types.SolarModeAny)
+		require.NoError(t, err, "SetModes should succeed")
+
+		require.Len(t, callOrder, 2, "both updateSocV2 and setPowerControlV2 should be called")
+		assert.Equal(t, "updateSocV2", callOrder[0])
+		assert.Equal(t, "setPowerControlV2", callOrder[1])
+	})
+
+	t.Run("SetModes Max Grid Use", func(t *testing.T) {
+		var gridMax interface{} = -1.0
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/hes-gateway/terminal/initialize/appUserOrInstallerLogin" {
+				json.NewEncoder(w).Encode(map[string]interface{}{"code": 200.0, "success": true, "result": map[string]interface{}{"token": "tok"}})
+				return
+			}
+			if r.URL.Path == "/hes-gateway/terminal/tou/getGatewayTouListV2" {
+				list := []map[string]interface{}{
+					{"id": 20.0, "workMode": 2.0, "electricityType": 1.0, "editSocFlag": true},
+				}
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"code":    200.0,
+					"success": true,
+					"result":  map[string]interface{}{"list": list, "currendId": 20.0},
+				})
+				return
+			}
+			if r.URL.Path == "/hes-gateway/terminal/tou/getPowerControlSetting" {
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"code":    200.0,
+					"success": true,
+					"result":  map[string]interface{}{"gridMaxFlag": 2, "gridFeedMaxFlag": 1, "gridMax": gridMax},
+				})
+				return
+			}
+			if r.URL.Path == "/hes-gateway/terminal/tou/updateSocV2" {
+				json.NewEncoder(w).Encode(map[string]interface{}{"code": 200.0, "success": true, "result": nil})
+				return
+			}
+			if r.URL.Path == "/hes-gateway/terminal/tou/setPowerControlV2" {
+				var data map[string]interface{}
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&data))
+				gridMax = data["gridMax"]
+				json.NewEncoder(w).Encode(map[string]interface{}{"code": 200.0, "success": true, "result": map[string]interface{}{}})
+				return
+			}
+			http.Error(w, "not found "+r.URL.Path, 404)
+		}))
+		defer ts.Close()
+
+		f := &Franklin{
+			client:    ts.Client(),
+			baseURL:   ts.URL,
+			username:  "u",
+			password:  "p",
+			gatewayID: "g",
+		}
+
+		require.NoError(t, f.ApplySettings(context.Background(), types.Settings{GridChargeBatteries: true, GridExportSolar: true, MaxGridUseKW: 7.5}))
+		err := f.SetModes(context.Background(), types.BatteryModeChargeAny, types.SolarModeAny)
+		require.NoError(t, err, "SetModes should succeed")
+		assert.EqualValues(t, 7.5, gridMax, "gridMax should be capped to the max grid use")
+
+		// clearing the max grid use removes the cap
+		require.NoError(t, f.ApplySettings(context.Background(), types.Settings{GridChargeBatteries: true, GridExportSolar: true}))
+		require.NoError(t, f.SetModes(context.Background(), types.BatteryModeChargeAny, types.SolarModeAny))
+		assert.EqualValues(t, gridMaxUncapped, gridMax, "gridMax should be uncapped")
+	})
+
 	t.Run("SetModes NoChange", func(t *testing.T) {
 		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			if r.URL.Path == "/hes-gateway/terminal/initialize/appUserOrInstallerLogin" {
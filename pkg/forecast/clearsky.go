@@ -0,0 +1,171 @@
+package forecast
+
+import (
+	"math"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+)
+
+const (
+	// solarConstant is the extraterrestrial irradiance in W/m².
+	solarConstant = 1353
+	// groundAlbedo is the fraction of light reflected by the ground.
+	groundAlbedo = 0.2
+	// defaultDerate is used until the model is calibrated and accounts for
+	// inverter, wiring, soiling and weather losses.
+	defaultDerate = 0.75
+	// minCalibrationHours is the number of daylight hours needed to calibrate.
+	minCalibrationHours = 12
+	// clearSkySteps is the number of points sampled within each hour.
+	clearSkySteps = 12
+)
+
+// Site describes the location and geometry of a solar array.
+type Site struct {
+	Latitude  float64
+	Longitude float64
+	// KWP is the peak DC power of the array in kW.
+	KWP float64
+	// Tilt is degrees from horizontal.
+	Tilt float64
+	// Azimuth is the compass direction the array faces in degrees (180 is
+	// south).
+	Azimuth float64
+}
+
+// SiteFromSettings returns the site described by settings and whether enough
+// was set to model it.
+func SiteFromSettings(settings types.Settings) (Site, bool) {
+	site := Site{
+		Latitude:  settings.SolarLatitude,
+		Longitude: settings.SolarLongitude,
+		KWP:       settings.SolarKWP,
+		Tilt:      settings.SolarTiltDegrees,
+		Azimuth:   settings.SolarAzimuthDegrees,
+	}
+	if site.KWP <= 0 || (site.Latitude == 0 && site.Longitude == 0) {
+		return Site{}, false
+	}
+	return site, true
+}
+
+// ClearSky estimates solar production from the sun's position assuming a
+// cloudless sky, scaled by a derate learned from actual production. It needs
+// no network access. It isn't a SolarForecaster since calibrating needs the
+// energy history, so the controller uses it directly as the solar prior.
+type ClearSky struct {
+	site   Site
+	derate float64
+}
+
+// NewClearSky returns a clear-sky model for the site using the default derate.
+func NewClearSky(site Site) *ClearSky {
+	return &ClearSky{
+		site:   site,
+		derate: defaultDerate,
+	}
+}
+
+// Derate returns the fraction of the clear-sky output the system is expected
+// to produce.
+func (c *ClearSky) Derate() float64 {
+	return c.derate
+}
+
+// Calibrate learns the derate by comparing the actual solar production in
+// history to the clear-sky output for the same hours. Because history includes
+// cloudy days the derate reflects typical rather than best-case production.
+// If there isn't enough daylight history the derate is left unchanged.
+func (c *ClearSky) Calibrate(history []types.EnergyStats) {
+	var actual, modeled float64
+	var hours int
+	for _, h := range history {
+		if h.TSHourStart.IsZero() {
+			continue
+		}
+		clear := c.clearKWH(h.TSHourStart)
+		// ignore hours around sunrise and sunset where small errors dominate
+		if clear < c.site.KWP*0.05 {
+			continue
+		}
+		actual += h.SolarKWH
+		modeled += clear
+		hours++
+	}
+	if hours < minCalibrationHours || modeled <= 0 {
+		return
+	}
+	c.derate = math.Min(1.2, math.Max(0.01, actual/modeled))
+}
+
+// HourlyKWH returns the expected production for the hour starting at
+// hourStart.
+func (c *ClearSky) HourlyKWH(hourStart time.Time) float64 {
+	return c.clearKWH(hourStart) * c.derate
+}
+
+// clearKWH returns the clear-sky production before the derate for the hour
+// starting at hourStart by averaging the power at points within the hour.
+func (c *ClearSky) clearKWH(hourStart time.Time) float64 {
+	step := time.Hour / clearSkySteps
+	var total float64
+	for i := range clearSkySteps {
+		t := hourStart.Add(step/2 + time.Duration(i)*step)
+		total += c.site.KWP * c.planeIrradiance(t) / 1000
+	}
+	return total / clearSkySteps
+}
+
+// planeIrradiance returns the clear-sky irradiance on the array in W/m² at t.
+func (c *ClearSky) planeIrradiance(t time.Time) float64 {
+	east, north, up := sunPosition(t, c.site.Latitude, c.site.Longitude)
+	if up <= 0 {
+		return 0
+	}
+
+	// Kasten-Young air mass and Meinel's clear-sky beam attenuation
+	zenith := math.Acos(up) * 180 / math.Pi
+	airMass := 1 / (up + 0.50572*math.Pow(96.07995-zenith, -1.6364))
+	direct := solarConstant * math.Pow(0.7, math.Pow(airMass, 0.678))
+	diffuse := 0.1 * direct
+	global := direct*up + diffuse
+
+	tilt := c.site.Tilt * math.Pi / 180
+	azimuth := c.site.Azimuth * math.Pi / 180
+	// the angle between the sun and the array's normal
+	cosIncidence := east*math.Sin(tilt)*math.Sin(azimuth) +
+		north*math.Sin(tilt)*math.Cos(azimuth) +
+		up*math.Cos(tilt)
+
+	return direct*math.Max(0, cosIncidence) +
+		diffuse*(1+math.Cos(tilt))/2 +
+		global*groundAlbedo*(1-math.Cos(tilt))/2
+}
+
+// sunPosition returns the unit vector pointing at the sun in east, north, up
+// coordinates using the NOAA approximations for declination and the equation
+// of time.
+func sunPosition(t time.Time, latitude, longitude float64) (float64, float64, float64) {
+	t = t.UTC()
+	hours := float64(t.Hour()) + float64(t.Minute())/60 + float64(t.Second())/3600
+	gamma := 2 * math.Pi / 365 * (float64(t.YearDay()-1) + (hours-12)/24)
+
+	eqTime := 229.18 * (0.000075 +
+		0.001868*math.Cos(gamma) - 0.032077*math.Sin(gamma) -
+		0.014615*math.Cos(2*gamma) - 0.040849*math.Sin(2*gamma))
+	decl := 0.006918 -
+		0.399912*math.Cos(gamma) + 0.070257*math.Sin(gamma) -
+		0.006758*math.Cos(2*gamma) + 0.000907*math.Sin(2*gamma) -
+		0.002697*math.Cos(3*gamma) + 0.00148*math.Sin(3*gamma)
+
+	// true solar time in minutes and the hour angle, positive after noon
+	solarMinutes := hours*60 + eqTime + 4*longitude
+	hourAngle := (solarMinutes/4 - 180) * math.Pi / 180
+
+	lat := latitude * math.Pi / 180
+	east := -math.Cos(decl) * math.Sin(hourAngle)
+	north := math.Cos(lat)*math.Sin(decl) - math.Sin(lat)*math.Cos(decl)*math.Cos(hourAngle)
+	up := math.Sin(lat)*math.Sin(decl) + math.Cos(lat)*math.Cos(decl)*math.Cos(hourAngle)
+	return east, north, up
+}
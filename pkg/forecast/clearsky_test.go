@@ -0,0 +1,101 @@
+package forecast
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClearSky(t *testing.T) {
+	loc, err := time.LoadLocation("America/Chicago")
+	require.NoError(t, err)
+
+	// a south facing 10kW array in Chicago
+	site := Site{
+		Latitude:  41.88,
+		Longitude: -87.63,
+		KWP:       10,
+		Tilt:      30,
+		Azimuth:   180,
+	}
+
+	dayKWH := func(c *ClearSky, day time.Time) float64 {
+		var total float64
+		for h := 0; h < 24; h++ {
+			total += c.HourlyKWH(day.Add(time.Duration(h) * time.Hour))
+		}
+		return total
+	}
+
+	t.Run("Seasons", func(t *testing.T) {
+		c := NewClearSky(site)
+		june := time.Date(2026, 6, 21, 0, 0, 0, 0, loc)
+		december := time.Date(2026, 12, 21, 0, 0, 0, 0, loc)
+
+		juneKWH := dayKWH(c, june)
+		decemberKWH := dayKWH(c, december)
+		assert.Greater(t, juneKWH, decemberKWH*1.5)
+		// a 10kW array makes somewhere between 30 and 80kWh on a clear June day
+		assert.Greater(t, juneKWH, 30.0)
+		assert.Less(t, juneKWH, 80.0)
+
+		// nothing at night
+		assert.Zero(t, c.HourlyKWH(june.Add(time.Hour)))
+		assert.Zero(t, c.HourlyKWH(december.Add(20*time.Hour)))
+
+		// peak around solar noon, which is after 12pm in daylight saving time
+		assert.Greater(t, c.HourlyKWH(june.Add(12*time.Hour)), c.HourlyKWH(june.Add(8*time.Hour)))
+		assert.Greater(t, c.HourlyKWH(june.Add(12*time.Hour)), c.HourlyKWH(june.Add(17*time.Hour)))
+	})
+
+	t.Run("Orientation", func(t *testing.T) {
+		east := site
+		east.Azimuth = 90
+		west := site
+		west.Azimuth = 270
+		morning := time.Date(2026, 6, 21, 8, 0, 0, 0, loc)
+
+		assert.Greater(t, NewClearSky(east).HourlyKWH(morning), NewClearSky(west).HourlyKWH(morning))
+	})
+
+	t.Run("Calibrate", func(t *testing.T) {
+		c := NewClearSky(site)
+		assert.Equal(t, defaultDerate, c.Derate())
+
+		// the system produces half of the clear-sky output
+		start := time.Date(2026, 6, 1, 0, 0, 0, 0, loc)
+		raw := NewClearSky(site)
+		var history []types.EnergyStats
+		for ts := start; ts.Before(start.Add(3 * 24 * time.Hour)); ts = ts.Add(time.Hour) {
+			history = append(history, types.EnergyStats{
+				TSHourStart: ts,
+				SolarKWH:    raw.clearKWH(ts) * 0.5,
+			})
+		}
+		c.Calibrate(history)
+		assert.InDelta(t, 0.5, c.Derate(), 0.001)
+
+		// not enough history leaves the derate alone
+		c = NewClearSky(site)
+		c.Calibrate(history[:10])
+		assert.Equal(t, defaultDerate, c.Derate())
+	})
+
+	t.Run("SiteFromSettings", func(t *testing.T) {
+		_, ok := SiteFromSettings(types.Settings{})
+		assert.False(t, ok)
+
+		s, ok := SiteFromSettings(types.Settings{
+			SolarLatitude:       41.88,
+			SolarLongitude:      -87.63,
+			SolarKWP:            10,
+			SolarTiltDegrees:    30,
+			SolarAzimuthDegrees: 180,
+		})
+		assert.True(t, ok)
+		assert.Equal(t, site, s)
+	})
+}
@@ -0,0 +1,48 @@
+package forecast
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+	"github.com/levenlabs/go-lflag"
+)
+
+// Configured sets up the solar forecaster based on flags.
+func Configured() SolarForecaster {
+	provider := lflag.String("solar-forecast-provider", "none", "Solar forecast provider to use (available: none, forecastsolar)")
+
+	var f struct{ SolarForecaster }
+
+	// Configure implementations
+	forecastSolar := configuredForecastSolar()
+
+	lflag.Do(func() {
+		switch *provider {
+		case "none", "":
+			f.SolarForecaster = none{}
+		case "forecastsolar":
+			if err := forecastSolar.Validate(); err != nil {
+				panic(fmt.Sprintf("forecastsolar validation failed: %v", err))
+			}
+			f.SolarForecaster = forecastSolar
+		default:
+			panic(fmt.Sprintf("unknown solar forecast provider: %s", *provider))
+		}
+	})
+
+	return &f
+}
+
+// none is used when no solar forecast provider is configured.
+type none struct{}
+
+// GetSolarForecast always returns an empty forecast.
+func (none) GetSolarForecast(ctx context.Context) ([]types.SolarForecast, error) {
+	return nil, nil
+}
+
+// ApplySettings does nothing since there's no forecast.
+func (none) ApplySettings(ctx context.Context, settings types.Settings) error {
+	return nil
+}
@@ -0,0 +1,213 @@
+package forecast
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+	"github.com/levenlabs/go-lflag"
+)
+
+// forecastHorizon is how far ahead forecasts are returned.
+const forecastHorizon = 48 * time.Hour
+
+// forecastSolarCacheTTL is how long forecasts are cached. The public API is
+// rate limited and only updates a few times an hour.
+const forecastSolarCacheTTL = 30 * time.Minute
+
+// ForecastSolar implements the SolarForecaster interface using the
+// Forecast.Solar estimate API.
+type ForecastSolar struct {
+	apiURL string
+	apiKey string
+	client *http.Client
+
+	mu sync.Mutex
+	// site is the solar array from the settings
+	site          Site
+	siteOK        bool
+	lastFetchTime time.Time
+	cachedHours   []types.SolarForecast
+}
+
+// configuredForecastSolar sets up flags for Forecast.Solar and returns the
+// instance.
+func configuredForecastSolar() *ForecastSolar {
+	f := &ForecastSolar{
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+	apiURL := lflag.String("forecastsolar-api-url", "https://api.forecast.solar", "URL for the Forecast.Solar API")
+	apiKey := lflag.String("forecastsolar-api-key", "", "API Key for Forecast.Solar (optional)")
+
+	lflag.Do(func() {
+		f.apiURL = *apiURL
+		f.apiKey = *apiKey
+	})
+
+	return f
+}
+
+// Validate ensures the configuration is valid.
+func (f *ForecastSolar) Validate() error {
+	if f.apiURL == "" {
+		return fmt.Errorf("forecastsolar-api-url is required")
+	}
+	if _, err := url.Parse(f.apiURL); err != nil {
+		return fmt.Errorf("failed to parse forecastsolar url (%s): %w", f.apiURL, err)
+	}
+	return nil
+}
+
+// ApplySettings uses the solar array from the settings. The cached forecast is
+// dropped if the array changed.
+func (f *ForecastSolar) ApplySettings(ctx context.Context, settings types.Settings) error {
+	site, ok := SiteFromSettings(settings)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if site != f.site || ok != f.siteOK {
+		f.cachedHours = nil
+		f.lastFetchTime = time.Time{}
+	}
+	f.site = site
+	f.siteOK = ok
+	return nil
+}
+
+// forecastSolarResponse represents the JSON returned by the estimate API.
+type forecastSolarResponse struct {
+	Result struct {
+		// WattHoursPeriod is keyed by the local time the period ends
+		WattHoursPeriod map[string]float64 `json:"watt_hours_period"`
+	} `json:"result"`
+	Message struct {
+		Code int    `json:"code"`
+		Type string `json:"type"`
+		Text string `json:"text"`
+		Info struct {
+			Timezone string `json:"timezone"`
+		} `json:"info"`
+	} `json:"message"`
+}
+
+// fetchForecast retrieves the hourly forecast from the API. It caches the
+// result for forecastSolarCacheTTL.
+func (f *ForecastSolar) fetchForecast(ctx context.Context) ([]types.SolarForecast, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if time.Since(f.lastFetchTime) < forecastSolarCacheTTL && len(f.cachedHours) > 0 {
+		return f.cachedHours, nil
+	}
+	if !f.siteOK {
+		return nil, fmt.Errorf("solar array location and kwp aren't set in the settings")
+	}
+
+	u, err := url.Parse(f.apiURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse url: %w", err)
+	}
+	if f.apiKey != "" {
+		u = u.JoinPath(f.apiKey)
+	}
+	// Forecast.Solar's azimuth is 0 for south and -90 for east
+	u = u.JoinPath(
+		"estimate",
+		formatFloat(f.site.Latitude),
+		formatFloat(f.site.Longitude),
+		formatFloat(f.site.Tilt),
+		formatFloat(f.site.Azimuth-180),
+		formatFloat(f.site.KWP),
+	)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch forecast: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var data forecastSolarResponse
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("failed to decode response (status %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || data.Message.Code != 0 {
+		return nil, fmt.Errorf("unexpected response (status %d): %s", resp.StatusCode, data.Message.Text)
+	}
+
+	loc := time.UTC
+	if data.Message.Info.Timezone != "" {
+		loc, err = time.LoadLocation(data.Message.Info.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load timezone (%s): %w", data.Message.Info.Timezone, err)
+		}
+	}
+
+	// periods can be shorter than an hour around sunrise and sunset so sum them
+	// into the hour they end in
+	byHour := make(map[time.Time]float64)
+	for ts, wh := range data.Result.WattHoursPeriod {
+		end, err := time.ParseInLocation(time.DateTime, ts, loc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse forecast time (%s): %w", ts, err)
+		}
+		hour := end.Add(-time.Second).Truncate(time.Hour)
+		byHour[hour] += wh / 1000
+	}
+
+	hours := make([]types.SolarForecast, 0, len(byHour))
+	for ts, kwh := range byHour {
+		hours = append(hours, types.SolarForecast{
+			TSHourStart: ts,
+			KWH:         kwh,
+		})
+	}
+	sort.Slice(hours, func(i, j int) bool {
+		return hours[i].TSHourStart.Before(hours[j].TSHourStart)
+	})
+
+	slog.DebugContext(ctx, "fetched solar forecast", slog.Int("hours", len(hours)))
+
+	f.cachedHours = hours
+	f.lastFetchTime = time.Now()
+	return hours, nil
+}
+
+// GetSolarForecast returns the expected solar production for each hour over
+// the next 48 hours.
+func (f *ForecastSolar) GetSolarForecast(ctx context.Context) ([]types.SolarForecast, error) {
+	hours, err := f.fetchForecast(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	start := now.Truncate(time.Hour)
+	end := now.Add(forecastHorizon)
+	var forecast []types.SolarForecast
+	for _, h := range hours {
+		if h.TSHourStart.Before(start) || !h.TSHourStart.Before(end) {
+			continue
+		}
+		forecast = append(forecast, h)
+	}
+	return forecast, nil
+}
+
+// formatFloat formats f for a URL path without trailing zeros.
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,102 @@
+package forecast
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForecastSolar(t *testing.T) {
+	loc, err := time.LoadLocation("America/Chicago")
+	require.NoError(t, err)
+
+	// build a forecast for today and tomorrow in the site's timezone where
+	// sunrise is partway through the 7am hour
+	today := time.Now().In(loc)
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, loc)
+	periods := make(map[string]float64)
+	for day := 0; day < 2; day++ {
+		date := today.AddDate(0, 0, day)
+		periods[date.Add(7*time.Hour+30*time.Minute).Format(time.DateTime)] = 0
+		periods[date.Add(8*time.Hour).Format(time.DateTime)] = 250
+		for h := 9; h <= 17; h++ {
+			periods[date.Add(time.Duration(h)*time.Hour).Format(time.DateTime)] = 2000
+		}
+	}
+
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "/key/estimate/41.8/-87.6/30/0/8", r.URL.Path)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"result": map[string]interface{}{
+				"watt_hours_period": periods,
+			},
+			"message": map[string]interface{}{
+				"code": 0,
+				"type": "success",
+				"info": map[string]interface{}{"timezone": "America/Chicago"},
+			},
+		})
+	}))
+	defer ts.Close()
+
+	f := &ForecastSolar{
+		apiURL: ts.URL,
+		apiKey: "key",
+		client: ts.Client(),
+	}
+	require.NoError(t, f.Validate())
+
+	_, err = f.GetSolarForecast(context.Background())
+	assert.Error(t, err, "the array isn't configured yet")
+
+	// a south facing array, which is 0 for Forecast.Solar
+	require.NoError(t, f.ApplySettings(context.Background(), types.Settings{
+		SolarLatitude:       41.8,
+		SolarLongitude:      -87.6,
+		SolarKWP:            8,
+		SolarTiltDegrees:    30,
+		SolarAzimuthDegrees: 180,
+	}))
+
+	t.Run("Hourly", func(t *testing.T) {
+		forecast, err := f.GetSolarForecast(context.Background())
+		require.NoError(t, err)
+		require.NotEmpty(t, forecast)
+
+		now := time.Now()
+		for i, h := range forecast {
+			assert.False(t, h.TSHourStart.Before(now.Truncate(time.Hour)), "forecast should start at the current hour")
+			assert.True(t, h.TSHourStart.Before(now.Add(48*time.Hour)), "forecast should end within 48 hours")
+			if i > 0 {
+				assert.True(t, h.TSHourStart.After(forecast[i-1].TSHourStart), "forecast should be sorted")
+			}
+			switch h.TSHourStart.In(loc).Hour() {
+			case 7:
+				// the 7:00-8:00 period ends at 8:00
+				assert.InDelta(t, 0.25, h.KWH, 0.0001)
+			default:
+				assert.InDelta(t, 2.0, h.KWH, 0.0001)
+			}
+		}
+	})
+
+	t.Run("Cached", func(t *testing.T) {
+		_, err := f.GetSolarForecast(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 1, requests)
+	})
+
+	t.Run("Validate", func(t *testing.T) {
+		assert.Error(t, (&ForecastSolar{}).Validate(), "api url is required")
+		assert.Error(t, (&ForecastSolar{apiURL: "://bad"}).Validate(), "api url must parse")
+	})
+}
@@ -0,0 +1,18 @@
+package forecast
+
+import (
+	"context"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+)
+
+// SolarForecaster defines the interface for forecasting solar production.
+type SolarForecaster interface {
+	// GetSolarForecast returns the expected solar production for each hour
+	// over the next 48 hours. It returns an empty list if no forecast is
+	// available.
+	GetSolarForecast(ctx context.Context) ([]types.SolarForecast, error)
+
+	// ApplySettings updates the solar array from the settings.
+	ApplySettings(ctx context.Context, settings types.Settings) error
+}
@@ -140,3 +140,33 @@ func (s *Server) handleAuthStatus(w http.ResponseWriter, r *http.Request) {
 		panic(http.ErrAbortHandler)
 	}
 }
+
+// authorizeAdmin writes an error and returns false unless the request is from
+// one of the admin emails. what describes the request in errors and logs.
+func (s *Server) authorizeAdmin(w http.ResponseWriter, r *http.Request, what string) bool {
+	if s.bypassAuth {
+		return true
+	}
+
+	// don't let a misconfiguration to allow updates
+	if len(s.adminEmails) == 0 {
+		http.Error(w, what+" are disabled", http.StatusForbidden)
+		return false
+	}
+
+	// Validate Authentication from Context (set by authMiddleware)
+	email, ok := r.Context().Value(emailContextKey).(string)
+	if !ok || email == "" {
+		http.Error(w, "missing authentication", http.StatusUnauthorized)
+		return false
+	}
+
+	for _, admin := range s.adminEmails {
+		if email == admin {
+			return true
+		}
+	}
+	slog.WarnContext(r.Context(), "unauthorized email for "+what, slog.String("email", email))
+	http.Error(w, "unauthorized email", http.StatusForbidden)
+	return false
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"math"
+	"net/http"
+	"time"
+)
+
+// maxEmissionsRange is the longest range the emissions report covers.
+const maxEmissionsRange = 31 * 24 * time.Hour
+
+// EmissionsStats is the carbon emitted by grid imports and avoided by the
+// battery and solar using the carbon intensity stored with the prices.
+type EmissionsStats struct {
+	Start                   time.Time `json:"start"`
+	End                     time.Time `json:"end"`
+	GridKG                  float64   `json:"gridKG"`                  // Emitted by grid imports
+	WithoutSolarOrBatteryKG float64   `json:"withoutSolarOrBatteryKG"` // Emitted if the grid powered the home
+	SolarAvoidedKG          float64   `json:"solarAvoidedKG"`          // (SolarToHome + SolarToGrid) * Intensity
+	BatteryAvoidedKG        float64   `json:"batteryAvoidedKG"`        // (BatteryToHome + BatteryToGrid - GridToBattery) * Intensity
+	TotalAvoidedKG          float64   `json:"totalAvoidedKG"`          // SolarAvoidedKG + BatteryAvoidedKG
+	Hours                   int       `json:"hours"`                   // Hours of energy history
+	MissingHours            int       `json:"missingHours"`            // Hours without a carbon intensity
+}
+
+func (s *Server) handleHistoryEmissions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	start, end, err := parseTimeRangeMax(r, maxEmissionsRange)
+	if err != nil {
+		http.Error(w, "invalid time range: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Fetch prices (these carry the carbon intensity)
+	prices, err := s.storage.GetPriceHistory(ctx, start, end)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to get prices", "error", err)
+		http.Error(w, "failed to get prices", http.StatusInternalServerError)
+		return
+	}
+
+	// Fetch energy stats (these are hourly)
+	energyStats, err := s.storage.GetEnergyHistory(ctx, start, end)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to get energy history", "error", err)
+		http.Error(w, "failed to get energy history", http.StatusInternalServerError)
+		return
+	}
+
+	// average the intensity over each hour in kg/kWh
+	hourlyIntensity := make(map[time.Time]float64)
+	hourlyCounts := make(map[time.Time]int)
+	for _, p := range prices {
+		if p.GCO2PerKWH == nil {
+			continue
+		}
+		tsHour := p.TSStart.Truncate(time.Hour)
+		hourlyIntensity[tsHour] += *p.GCO2PerKWH / 1000
+		hourlyCounts[tsHour]++
+	}
+	for ts, total := range hourlyIntensity {
+		hourlyIntensity[ts] = total / float64(hourlyCounts[ts])
+	}
+
+	stats := EmissionsStats{
+		Start: start,
+		End:   end,
+	}
+	for _, stat := range energyStats {
+		stats.Hours++
+		intensity, ok := hourlyIntensity[stat.TSHourStart.Truncate(time.Hour)]
+		if !ok {
+			stats.MissingHours++
+			continue
+		}
+
+		stats.GridKG += stat.GridImportKWH * intensity
+		stats.WithoutSolarOrBatteryKG += stat.HomeKWH * intensity
+
+		// Solar displaces grid energy whether it powers the home or is exported
+		stats.SolarAvoidedKG += (stat.SolarToHomeKWH + stat.SolarToGridKWH) * intensity
+
+		// The battery displaces grid energy when it discharges but emits when
+		// it's charged from the grid so shifting only helps when the grid is
+		// cleaner at the time it charges.
+		gridToBattery := math.Max(0, stat.BatteryChargedKWH-stat.SolarToBatteryKWH)
+		stats.BatteryAvoidedKG += (stat.BatteryToHomeKWH + stat.BatteryToGridKWH - gridToBattery) * intensity
+	}
+	stats.TotalAvoidedKG = stats.SolarAvoidedKG + stats.BatteryAvoidedKG
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// Set Cache-Control (copying pattern from history.go)
+	today := time.Now().Truncate(24 * time.Hour)
+	if end.Before(today) {
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=60")
+	}
+
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		panic(http.ErrAbortHandler)
+	}
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleHistoryEmissions(t *testing.T) {
+	mockStore := new(mockSavingsStorage)
+	s := &Server{storage: mockStore}
+
+	start := time.Now().Truncate(24 * time.Hour)
+	end := start.Add(24 * time.Hour)
+
+	clean, dirty := 200.0, 800.0
+	prices := []types.Price{
+		{TSStart: start, DollarsPerKWH: 0.05, GCO2PerKWH: &clean},
+		{TSStart: start.Add(time.Hour), DollarsPerKWH: 0.20, GCO2PerKWH: &dirty},
+		// Hour 3: no intensity
+		{TSStart: start.Add(2 * time.Hour), DollarsPerKWH: 0.10},
+	}
+	stats := []types.EnergyStats{
+		// Hour 1: charge the battery from the clean grid
+		{
+			TSHourStart:       start,
+			HomeKWH:           2,
+			GridImportKWH:     12,
+			BatteryChargedKWH: 10,
+		},
+		// Hour 2: use the battery and solar when the grid is dirty
+		{
+			TSHourStart:      start.Add(time.Hour),
+			HomeKWH:          10,
+			SolarKWH:         4,
+			SolarToHomeKWH:   2,
+			SolarToGridKWH:   2,
+			BatteryToHomeKWH: 8,
+			BatteryUsedKWH:   8,
+		},
+		{
+			TSHourStart:   start.Add(2 * time.Hour),
+			HomeKWH:       5,
+			GridImportKWH: 5,
+		},
+	}
+
+	mockStore.On("GetPriceHistory", mock.Anything, mock.Anything, mock.Anything).Return(prices, nil)
+	mockStore.On("GetEnergyHistory", mock.Anything, mock.Anything, mock.Anything).Return(stats, nil)
+
+	req, _ := http.NewRequest("GET", "/api/history/emissions?start="+start.Format(time.RFC3339)+"&end="+end.Format(time.RFC3339), nil)
+	rr := httptest.NewRecorder()
+
+	s.handleHistoryEmissions(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var emissions EmissionsStats
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &emissions))
+
+	// Grid: 12 * 0.2 = 2.4
+	assert.InDelta(t, 2.4, emissions.GridKG, 1e-9)
+	// Without: 2 * 0.2 + 10 * 0.8 = 8.4
+	assert.InDelta(t, 8.4, emissions.WithoutSolarOrBatteryKG, 1e-9)
+	// Solar: (2 + 2) * 0.8 = 3.2
+	assert.InDelta(t, 3.2, emissions.SolarAvoidedKG, 1e-9)
+	// Battery: -10 * 0.2 + 8 * 0.8 = 4.4
+	assert.InDelta(t, 4.4, emissions.BatteryAvoidedKG, 1e-9)
+	assert.InDelta(t, 7.6, emissions.TotalAvoidedKG, 1e-9)
+	assert.Equal(t, 3, emissions.Hours)
+	assert.Equal(t, 1, emissions.MissingHours)
+}
@@ -0,0 +1,234 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/controller"
+	"github.com/jameshartig/autoenergy/pkg/types"
+)
+
+// maxHindsightRange is the longest range the hindsight benchmark covers.
+const maxHindsightRange = 31 * 24 * time.Hour
+
+// minWrongActionRegret is the regret in dollars an hour needs before a
+// different mode counts as wrong.
+const minWrongActionRegret = 0.001
+
+// HindsightStats compares what happened to the best possible battery schedule
+// with perfect knowledge of prices, load and solar. Regret is OptimalCost -
+// ActualCost so it's negative when we could have done better.
+type HindsightStats struct {
+	Start        time.Time                  `json:"start"`
+	End          time.Time                  `json:"end"`
+	OptimalCost  float64                    `json:"optimalCost"`
+	ActualCost   float64                    `json:"actualCost"`
+	Regret       float64                    `json:"regret"`
+	Days         []HindsightDay             `json:"days"`
+	WrongActions []WrongAction              `json:"wrongActions"`
+	Hours        []controller.HindsightHour `json:"hours"`
+}
+
+// HindsightDay is the regret over a single day.
+type HindsightDay struct {
+	Date        string  `json:"date"`
+	OptimalCost float64 `json:"optimalCost"`
+	ActualCost  float64 `json:"actualCost"`
+	Regret      float64 `json:"regret"`
+	// WrongHours is the number of hours our mode differed from the optimal one
+	// and it made a difference to the cost
+	WrongHours int `json:"wrongHours"`
+}
+
+// WrongAction is an action whose battery mode differed from the optimal mode
+// for the hours it was in effect.
+type WrongAction struct {
+	Action             types.Action      `json:"action"`
+	OptimalBatteryMode types.BatteryMode `json:"optimalBatteryMode"`
+	Hours              int               `json:"hours"`
+	Regret             float64           `json:"regret"`
+}
+
+func (s *Server) handleHistoryHindsight(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	start, end, err := parseTimeRangeMax(r, maxHindsightRange)
+	if err != nil {
+		http.Error(w, "invalid time range: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	settings, err := s.storage.GetSettings(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to get settings", "error", err)
+		http.Error(w, "failed to get settings", http.StatusInternalServerError)
+		return
+	}
+
+	prices, err := s.storage.GetPriceHistory(ctx, start, end)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to get prices", "error", err)
+		http.Error(w, "failed to get prices", http.StatusInternalServerError)
+		return
+	}
+
+	energyStats, err := s.storage.GetEnergyHistory(ctx, start, end)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to get energy history", "error", err)
+		http.Error(w, "failed to get energy history", http.StatusInternalServerError)
+		return
+	}
+
+	// include the day before so we know what mode we were in at the start
+	actions, err := s.storage.GetActionHistory(ctx, start.Add(-24*time.Hour), end)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to get actions", "error", err)
+		http.Error(w, "failed to get actions", http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(actions, func(i, j int) bool {
+		return actions[i].Timestamp.Before(actions[j].Timestamp)
+	})
+
+	// the battery starts where it was as of the last action before the range
+	// or the first one in it
+	var status types.SystemStatus
+	for _, a := range actions {
+		if a.SystemStatus.BatteryCapacityKWH <= 0 {
+			continue
+		}
+		if status.BatteryCapacityKWH > 0 && a.Timestamp.After(start) {
+			break
+		}
+		status = a.SystemStatus
+	}
+	if status.BatteryCapacityKWH <= 0 {
+		http.Error(w, "no battery status found", http.StatusNotFound)
+		return
+	}
+
+	stats := HindsightStats{
+		Start: start,
+		End:   end,
+		Hours: controller.Hindsight(energyStats, prices, status, settings),
+	}
+
+	statsByHour := make(map[time.Time]types.EnergyStats, len(energyStats))
+	for _, stat := range energyStats {
+		statsByHour[stat.TSHourStart.Truncate(time.Hour)] = stat
+	}
+
+	// dry run actions never changed the battery so they can't be blamed for
+	// what it did
+	executed := make([]types.Action, 0, len(actions))
+	for _, a := range actions {
+		if !a.DryRun {
+			executed = append(executed, a)
+		}
+	}
+
+	days := make(map[string]*HindsightDay)
+	var order []string
+	wrong := make(map[time.Time]*WrongAction)
+	var ai int
+	var current *types.Action
+	mode := types.BatteryModeNoChange
+	for _, h := range stats.Hours {
+		stat := statsByHour[h.TSHourStart]
+		actual := stat.GridImportKWH*h.DollarsPerKWH - stat.GridExportKWH*h.ExportDollarsPerKWH
+		regret := h.Cost - actual
+		stats.OptimalCost += h.Cost
+		stats.ActualCost += actual
+
+		date := h.TSHourStart.In(start.Location()).Format(time.DateOnly)
+		day, ok := days[date]
+		if !ok {
+			day = &HindsightDay{Date: date}
+			days[date] = day
+			order = append(order, date)
+		}
+		day.OptimalCost += h.Cost
+		day.ActualCost += actual
+		day.Regret += regret
+
+		// the action in effect is the last one at or before the start of the
+		// hour, or the first one during it
+		for ai < len(executed) && !executed[ai].Timestamp.After(h.TSHourStart) {
+			current = applyAction(&executed[ai], current, &mode)
+			ai++
+		}
+		if current == nil && ai < len(executed) && executed[ai].Timestamp.Before(h.TSHourStart.Add(time.Hour)) {
+			current = applyAction(&executed[ai], current, &mode)
+			ai++
+		}
+		if current == nil || mode == types.BatteryModeNoChange || sameMode(mode, h.BatteryMode) {
+			continue
+		}
+		// a different mode that cost nothing, like using an empty battery
+		// instead of standby, isn't wrong
+		if math.Abs(regret) <= minWrongActionRegret {
+			continue
+		}
+		day.WrongHours++
+		wa, ok := wrong[current.Timestamp]
+		if !ok {
+			wa = &WrongAction{Action: *current, OptimalBatteryMode: h.BatteryMode}
+			wrong[current.Timestamp] = wa
+		}
+		wa.Hours++
+		wa.Regret += regret
+	}
+	stats.Regret = stats.OptimalCost - stats.ActualCost
+
+	for _, date := range order {
+		stats.Days = append(stats.Days, *days[date])
+	}
+	for _, wa := range wrong {
+		stats.WrongActions = append(stats.WrongActions, *wa)
+	}
+	// worst first
+	sort.Slice(stats.WrongActions, func(i, j int) bool {
+		return stats.WrongActions[i].Regret < stats.WrongActions[j].Regret
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	today := time.Now().Truncate(24 * time.Hour)
+	if end.Before(today) {
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=60")
+	}
+
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// applyAction returns the action in effect after a, updating mode unless a
+// kept the previous battery mode.
+func applyAction(a *types.Action, current *types.Action, mode *types.BatteryMode) *types.Action {
+	if a.BatteryMode != types.BatteryModeNoChange {
+		*mode = a.BatteryMode
+		return a
+	}
+	// keep blaming the action that set the mode
+	if current == nil {
+		return a
+	}
+	return current
+}
+
+// sameMode returns whether two battery modes behave the same.
+func sameMode(a, b types.BatteryMode) bool {
+	// both only let solar charge the battery
+	if a == types.BatteryModeChargeSolar {
+		a = types.BatteryModeStandby
+	}
+	if b == types.BatteryModeChargeSolar {
+		b = types.BatteryModeStandby
+	}
+	return a == b
+}
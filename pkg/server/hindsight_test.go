@@ -0,0 +1,149 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type hindsightMockStorage struct {
+	mockStorage
+	prices  []types.Price
+	stats   []types.EnergyStats
+	actions []types.Action
+}
+
+func (m *hindsightMockStorage) GetPriceHistory(ctx context.Context, start, end time.Time) ([]types.Price, error) {
+	return m.prices, nil
+}
+
+func (m *hindsightMockStorage) GetEnergyHistory(ctx context.Context, start, end time.Time) ([]types.EnergyStats, error) {
+	return m.stats, nil
+}
+
+func (m *hindsightMockStorage) GetActionHistory(ctx context.Context, start, end time.Time) ([]types.Action, error) {
+	return m.actions, nil
+}
+
+func TestHandleHistoryHindsight(t *testing.T) {
+	start := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+
+	store := &hindsightMockStorage{
+		mockStorage: mockStorage{settings: types.Settings{
+			MinBatterySOC:       20,
+			GridChargeBatteries: true,
+		}},
+	}
+	for i := range 24 {
+		ts := start.Add(time.Duration(i) * time.Hour)
+		price := 0.05
+		if i >= 17 && i < 21 {
+			price = 0.40
+		}
+		store.prices = append(store.prices, types.Price{TSStart: ts, TSEnd: ts.Add(time.Hour), DollarsPerKWH: price})
+		// the battery sat idle all day
+		store.stats = append(store.stats, types.EnergyStats{TSHourStart: ts, HomeKWH: 2, GridImportKWH: 2})
+	}
+	status := types.SystemStatus{BatterySOC: 20, BatteryCapacityKWH: 10, MaxBatteryChargeKW: 5}
+	store.actions = []types.Action{
+		{Timestamp: start.Add(-time.Hour), BatteryMode: types.BatteryModeStandby, SystemStatus: status},
+		{Timestamp: start.Add(16*time.Hour + 30*time.Minute), BatteryMode: types.BatteryModeNoChange, SystemStatus: status},
+	}
+
+	request := func(s *Server, start, end time.Time) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/history/hindsight?start="+start.Format(time.RFC3339)+"&end="+end.Format(time.RFC3339), nil)
+		rr := httptest.NewRecorder()
+		s.handleHistoryHindsight(rr, req)
+		return rr
+	}
+
+	t.Run("Regret", func(t *testing.T) {
+		rr := request(&Server{storage: store}, start, end)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var stats HindsightStats
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &stats))
+		assert.Len(t, stats.Hours, 24)
+		assert.InDelta(t, 20*2*0.05+4*2*0.40, stats.ActualCost, 0.001)
+		// charging 8kWh at 0.05 to avoid 0.40 would have saved 2.80
+		assert.InDelta(t, -2.80, stats.Regret, 0.01)
+		assert.InDelta(t, stats.OptimalCost-stats.ActualCost, stats.Regret, 0.001)
+
+		require.Len(t, stats.Days, 1)
+		assert.Equal(t, "2026-10-01", stats.Days[0].Date)
+		assert.InDelta(t, stats.Regret, stats.Days[0].Regret, 0.001)
+		assert.Greater(t, stats.Days[0].WrongHours, 4)
+
+		// the standby action is blamed for using the battery at the peak and
+		// charging before it
+		require.NotEmpty(t, stats.WrongActions)
+		worst := stats.WrongActions[0]
+		assert.True(t, worst.Action.Timestamp.Equal(start.Add(-time.Hour)))
+		assert.Equal(t, types.BatteryModeStandby, worst.Action.BatteryMode)
+		assert.Less(t, worst.Regret, -2.0)
+		for _, wa := range stats.WrongActions {
+			assert.NotEqual(t, types.BatteryModeNoChange, wa.Action.BatteryMode)
+		}
+	})
+
+	t.Run("No Regret Isn't Wrong", func(t *testing.T) {
+		// flat prices and an empty battery so using it or holding it is the
+		// same and the optimal hours are relabeled standby
+		flat := &hindsightMockStorage{mockStorage: store.mockStorage, stats: store.stats}
+		for _, p := range store.prices {
+			p.DollarsPerKWH = 0.05
+			flat.prices = append(flat.prices, p)
+		}
+		flat.actions = []types.Action{
+			{Timestamp: start.Add(-time.Hour), BatteryMode: types.BatteryModeLoad, SystemStatus: status},
+		}
+
+		rr := request(&Server{storage: flat}, start, end)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var stats HindsightStats
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &stats))
+		require.Len(t, stats.Hours, 24)
+		assert.Equal(t, types.BatteryModeStandby, stats.Hours[0].BatteryMode)
+		assert.InDelta(t, 0, stats.Regret, 0.001)
+		assert.Zero(t, stats.Days[0].WrongHours)
+		assert.Empty(t, stats.WrongActions)
+	})
+
+	t.Run("Dry Run Isn't Blamed", func(t *testing.T) {
+		dryRun := &hindsightMockStorage{mockStorage: store.mockStorage, prices: store.prices, stats: store.stats}
+		dryRun.actions = append(append([]types.Action(nil), store.actions...),
+			types.Action{Timestamp: start.Add(12 * time.Hour), BatteryMode: types.BatteryModeLoad, SystemStatus: status, DryRun: true},
+		)
+
+		rr := request(&Server{storage: dryRun}, start, end)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var stats HindsightStats
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &stats))
+		// the battery stayed in standby so that action is still blamed
+		require.NotEmpty(t, stats.WrongActions)
+		for _, wa := range stats.WrongActions {
+			assert.False(t, wa.Action.DryRun)
+		}
+		assert.True(t, stats.WrongActions[0].Action.Timestamp.Equal(start.Add(-time.Hour)))
+	})
+
+	t.Run("No Battery Status", func(t *testing.T) {
+		rr := request(&Server{storage: &hindsightMockStorage{prices: store.prices, stats: store.stats}}, start, end)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("Range Too Long", func(t *testing.T) {
+		rr := request(&Server{storage: store}, start, start.Add(32*24*time.Hour))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
@@ -73,6 +73,11 @@ func (s *Server) handleHistoryActions(w http.ResponseWriter, r *http.Request) {
 }
 
 func parseTimeRange(r *http.Request) (time.Time, time.Time, error) {
+	return parseTimeRangeMax(r, 24*time.Hour)
+}
+
+// parseTimeRangeMax is parseTimeRange allowing ranges up to maxRange.
+func parseTimeRangeMax(r *http.Request, maxRange time.Duration) (time.Time, time.Time, error) {
 	startStr := r.URL.Query().Get("start")
 	endStr := r.URL.Query().Get("end")
 
@@ -97,8 +102,8 @@ func parseTimeRange(r *http.Request) (time.Time, time.Time, error) {
 		return time.Time{}, time.Time{}, fmt.Errorf("start time must be before end time")
 	}
 
-	if end.Sub(start) > 24*time.Hour {
-		return time.Time{}, time.Time{}, fmt.Errorf("time range cannot exceed 24 hours")
+	if end.Sub(start) > maxRange {
+		return time.Time{}, time.Time{}, fmt.Errorf("time range cannot exceed %d hours", int(maxRange.Hours()))
 	}
 
 	return start, end, nil
@@ -53,7 +53,7 @@ func TestHistory(t *testing.T) {
 		essSystem:       &mockESS{},
 		storage:         mockS,
 		listenAddr:      ":8080",
-		controller:      controller.NewController(),
+		strategy:        controller.NewController(),
 	}
 
 	handler := srv.setupHandler()
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/controller"
+)
+
+// handleLoadModel returns the home load the controller expects for each hour
+// of weekdays and weekends based on the stored history.
+func (s *Server) handleLoadModel(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	settings, err := s.storage.GetSettings(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to get settings", slog.Any("error", err))
+		http.Error(w, "failed to get settings", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	history, err := s.storage.GetEnergyHistory(ctx, now.Add(-s.loadHistoryLookback), now)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to get energy history", slog.Any("error", err))
+		http.Error(w, "failed to get energy history", http.StatusInternalServerError)
+		return
+	}
+
+	model := controller.BuildLoadModel(history, now, settings)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	if err := json.NewEncoder(w).Encode(model); err != nil {
+		panic(http.ErrAbortHandler)
+	}
+}
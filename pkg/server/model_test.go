@@ -0,0 +1,62 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/controller"
+	"github.com/jameshartig/autoenergy/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleLoadModel(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		mockStore := new(mockSavingsStorage)
+		s := &Server{storage: mockStore, loadHistoryLookback: 28 * 24 * time.Hour}
+
+		var stats []types.EnergyStats
+		ts := time.Now().Truncate(time.Hour)
+		for i := 1; i <= 21; i++ {
+			stats = append(stats, types.EnergyStats{TSHourStart: ts.Add(time.Duration(-i) * 24 * time.Hour), HomeKWH: 2})
+		}
+		mockStore.On("GetSettings", mock.Anything).Return(types.Settings{Holidays: []string{"2026-12-25"}}, nil)
+		mockStore.On("GetEnergyHistory", mock.Anything, mock.MatchedBy(func(start time.Time) bool {
+			return time.Since(start) >= 28*24*time.Hour
+		}), mock.Anything).Return(stats, nil)
+
+		req := httptest.NewRequest("GET", "/api/model/load", nil)
+		rr := httptest.NewRecorder()
+		s.handleLoadModel(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var model controller.LoadModel
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &model))
+		require.Len(t, model.Weekday, 24)
+		require.Len(t, model.Weekend, 24)
+		// the model's hours are in the site's timezone
+		hour := ts.In(types.Settings{}.Location()).Hour()
+		assert.InDelta(t, 2.0, model.Weekday[hour].KWH, 0.001)
+		assert.InDelta(t, 2.0, model.Weekend[hour].KWH, 0.001)
+		assert.Equal(t, []string{"2026-12-25"}, model.Holidays)
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("Storage Error", func(t *testing.T) {
+		mockStore := new(mockSavingsStorage)
+		s := &Server{storage: mockStore, loadHistoryLookback: 28 * 24 * time.Hour}
+
+		mockStore.On("GetSettings", mock.Anything).Return(types.Settings{}, nil)
+		mockStore.On("GetEnergyHistory", mock.Anything, mock.Anything, mock.Anything).Return([]types.EnergyStats(nil), errors.New("boom"))
+
+		req := httptest.NewRequest("GET", "/api/model/load", nil)
+		rr := httptest.NewRecorder()
+		s.handleLoadModel(rr, req)
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+)
+
+// maxOverrideDuration is the longest a manual override can last.
+const maxOverrideDuration = 7 * 24 * time.Hour
+
+func (s *Server) handleGetOverride(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	override, err := s.storage.GetOverride(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to get override", slog.Any("error", err))
+		http.Error(w, "failed to get override", http.StatusInternalServerError)
+		return
+	}
+
+	// expired overrides are deleted on the next update so hide them until then
+	var res *types.Override
+	if override.Active(time.Now()) {
+		res = &override
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		slog.ErrorContext(ctx, "failed to encode override", slog.Any("error", err))
+	}
+}
+
+func (s *Server) handleSetOverride(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !s.authorizeAdmin(w, r, "overrides") {
+		return
+	}
+
+	var req struct {
+		BatteryMode types.BatteryMode `json:"batteryMode"`
+		TargetSOC   float64           `json:"targetSOC"`
+		// Expires or DurationMinutes sets when the override ends
+		Expires         time.Time `json:"expires"`
+		DurationMinutes int       `json:"durationMinutes"`
+		Reason          string    `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		slog.WarnContext(ctx, "failed to decode override", slog.Any("error", err))
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	switch req.BatteryMode {
+	case types.BatteryModeStandby, types.BatteryModeChargeAny, types.BatteryModeLoad, types.BatteryModeExport:
+	default:
+		http.Error(w, "invalid battery mode", http.StatusBadRequest)
+		return
+	}
+	if req.TargetSOC < 0 || req.TargetSOC > 100 {
+		http.Error(w, "invalid target SOC", http.StatusBadRequest)
+		return
+	}
+	if req.BatteryMode == types.BatteryModeExport {
+		settings, err := s.storage.GetSettings(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to get settings", slog.Any("error", err))
+			http.Error(w, "failed to get settings", http.StatusInternalServerError)
+			return
+		}
+		if !settings.GridExportBatteries {
+			http.Error(w, "exporting batteries to the grid is disabled in settings", http.StatusBadRequest)
+			return
+		}
+	}
+
+	now := time.Now()
+	expires := req.Expires
+	if req.DurationMinutes != 0 {
+		if !expires.IsZero() {
+			http.Error(w, "only one of expires or durationMinutes can be set", http.StatusBadRequest)
+			return
+		}
+		expires = now.Add(time.Duration(req.DurationMinutes) * time.Minute)
+	}
+	if !expires.After(now) || expires.Sub(now) > maxOverrideDuration {
+		http.Error(w, "expiry must be in the next 7 days", http.StatusBadRequest)
+		return
+	}
+
+	email, _ := ctx.Value(emailContextKey).(string)
+	override := types.Override{
+		BatteryMode: req.BatteryMode,
+		TargetSOC:   req.TargetSOC,
+		Expires:     expires,
+		Reason:      req.Reason,
+		CreatedBy:   email,
+		CreatedAt:   now,
+	}
+	if err := s.storage.SetOverride(ctx, override); err != nil {
+		slog.ErrorContext(ctx, "failed to save override", slog.Any("error", err))
+		http.Error(w, "failed to save override", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(
+		ctx,
+		"override set",
+		slog.String("mode", override.BatteryMode.String()),
+		slog.Float64("targetSOC", override.TargetSOC),
+		slog.Time("expires", override.Expires),
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(override); err != nil {
+		slog.ErrorContext(ctx, "failed to encode override", slog.Any("error", err))
+	}
+}
+
+func (s *Server) handleClearOverride(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !s.authorizeAdmin(w, r, "overrides") {
+		return
+	}
+
+	if err := s.storage.ClearOverride(ctx); err != nil {
+		slog.ErrorContext(ctx, "failed to clear override", slog.Any("error", err))
+		http.Error(w, "failed to clear override", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(ctx, "override cleared")
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// overrideAction returns the action for an active override. Once the battery
+// reaches the override's target SOC it holds the battery there.
+func overrideAction(override types.Override, status types.SystemStatus, price types.Price, now time.Time) types.Action {
+	mode := override.BatteryMode
+	desc := fmt.Sprintf("Manual override: %s for %s more", mode, override.Expires.Sub(now).Round(time.Minute))
+	if override.TargetSOC > 0 {
+		var reached bool
+		switch mode {
+		case types.BatteryModeChargeAny:
+			reached = status.BatterySOC >= override.TargetSOC
+		case types.BatteryModeLoad, types.BatteryModeExport:
+			reached = status.BatterySOC <= override.TargetSOC
+		}
+		if reached {
+			mode = types.BatteryModeStandby
+			desc = fmt.Sprintf("Manual override: reached %.0f%% target, holding battery for %s more", override.TargetSOC, override.Expires.Sub(now).Round(time.Minute))
+		} else if override.BatteryMode != types.BatteryModeStandby {
+			desc += fmt.Sprintf(" or until %.0f%%", override.TargetSOC)
+		}
+	}
+	if override.Reason != "" {
+		desc += ": " + override.Reason
+	}
+
+	return types.Action{
+		Timestamp:    now,
+		BatteryMode:  mode,
+		Description:  desc,
+		CurrentPrice: price,
+		SystemStatus: status,
+		Override:     &override,
+	}
+}
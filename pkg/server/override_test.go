@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/controller"
+	"github.com/jameshartig/autoenergy/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOverride(t *testing.T) {
+	mockS := &mockStorage{}
+	srv := &Server{
+		utilityProvider: &mockUtility{},
+		essSystem:       &mockESS{},
+		storage:         mockS,
+		strategy:        controller.NewController(),
+		adminEmails:     []string{"admin@example.com"},
+	}
+
+	withEmail := func(req *http.Request, email string) *http.Request {
+		ctx := context.WithValue(req.Context(), emailContextKey, email)
+		return req.WithContext(ctx)
+	}
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/override", strings.NewReader(`{"batteryMode": 2, "durationMinutes": 60}`))
+		w := httptest.NewRecorder()
+		srv.handleSetOverride(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Result().StatusCode)
+
+		req = withEmail(httptest.NewRequest("POST", "/api/override", strings.NewReader(`{"batteryMode": 2, "durationMinutes": 60}`)), "hacker@example.com")
+		w = httptest.NewRecorder()
+		srv.handleSetOverride(w, req)
+		assert.Equal(t, http.StatusForbidden, w.Result().StatusCode)
+
+		req = httptest.NewRequest("DELETE", "/api/override", nil)
+		w = httptest.NewRecorder()
+		srv.handleClearOverride(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Result().StatusCode)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, body := range []string{
+			`{"batteryMode": 0, "durationMinutes": 60}`,
+			`{"batteryMode": 3, "durationMinutes": 60}`,
+			`{"batteryMode": 2, "targetSOC": 120, "durationMinutes": 60}`,
+			`{"batteryMode": 2}`,
+			`{"batteryMode": 2, "durationMinutes": -5}`,
+			`{"batteryMode": 2, "durationMinutes": 20000}`,
+			`{"batteryMode": 2, "durationMinutes": 60, "expires": "2099-01-01T00:00:00Z"}`,
+			`{"batteryMode": 2, "expires": "2001-01-01T00:00:00Z"}`,
+		} {
+			req := withEmail(httptest.NewRequest("POST", "/api/override", strings.NewReader(body)), "admin@example.com")
+			w := httptest.NewRecorder()
+			srv.handleSetOverride(w, req)
+			assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode, body)
+		}
+	})
+
+	t.Run("Export Disabled", func(t *testing.T) {
+		body := `{"batteryMode": -2, "durationMinutes": 60}`
+		req := withEmail(httptest.NewRequest("POST", "/api/override", strings.NewReader(body)), "admin@example.com")
+		w := httptest.NewRecorder()
+		srv.handleSetOverride(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+		assert.True(t, mockS.override.Expires.IsZero())
+
+		mockS.settings.GridExportBatteries = true
+		defer func() { mockS.settings.GridExportBatteries = false }()
+		req = withEmail(httptest.NewRequest("POST", "/api/override", strings.NewReader(body)), "admin@example.com")
+		w = httptest.NewRecorder()
+		srv.handleSetOverride(w, req)
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+		assert.Equal(t, types.BatteryModeExport, mockS.override.BatteryMode)
+		mockS.override = types.Override{}
+	})
+
+	t.Run("Set Get Clear", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/override", nil)
+		w := httptest.NewRecorder()
+		srv.handleGetOverride(w, req)
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+		assert.Equal(t, "null", strings.TrimSpace(w.Body.String()))
+
+		body := `{"batteryMode": 1, "durationMinutes": 180, "reason": "guests"}`
+		req = withEmail(httptest.NewRequest("POST", "/api/override", strings.NewReader(body)), "admin@example.com")
+		w = httptest.NewRecorder()
+		srv.handleSetOverride(w, req)
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+		assert.Equal(t, types.BatteryModeStandby, mockS.override.BatteryMode)
+		assert.Equal(t, "admin@example.com", mockS.override.CreatedBy)
+		assert.WithinDuration(t, time.Now().Add(3*time.Hour), mockS.override.Expires, time.Minute)
+
+		req = httptest.NewRequest("GET", "/api/override", nil)
+		w = httptest.NewRecorder()
+		srv.handleGetOverride(w, req)
+		var got types.Override
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+		assert.Equal(t, "guests", got.Reason)
+
+		req = withEmail(httptest.NewRequest("DELETE", "/api/override", nil), "admin@example.com")
+		w = httptest.NewRecorder()
+		srv.handleClearOverride(w, req)
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+		assert.True(t, mockS.override.Expires.IsZero())
+	})
+
+	t.Run("Expired Hidden", func(t *testing.T) {
+		mockS.override = types.Override{BatteryMode: types.BatteryModeLoad, Expires: time.Now().Add(-time.Minute)}
+		req := httptest.NewRequest("GET", "/api/override", nil)
+		w := httptest.NewRecorder()
+		srv.handleGetOverride(w, req)
+		assert.Equal(t, "null", strings.TrimSpace(w.Body.String()))
+	})
+}
+
+func TestOverrideAction(t *testing.T) {
+	now := time.Now()
+	override := types.Override{
+		BatteryMode: types.BatteryModeLoad,
+		TargetSOC:   30,
+		Expires:     now.Add(90 * time.Minute),
+	}
+
+	action := overrideAction(override, types.SystemStatus{BatterySOC: 60}, types.Price{}, now)
+	assert.Equal(t, types.BatteryModeLoad, action.BatteryMode)
+	assert.Equal(t, "Manual override: Use Battery for 1h30m0s more or until 30%", action.Description)
+	require.NotNil(t, action.Override)
+
+	action = overrideAction(override, types.SystemStatus{BatterySOC: 29}, types.Price{}, now)
+	assert.Equal(t, types.BatteryModeStandby, action.BatteryMode)
+	assert.Contains(t, action.Description, "reached 30% target")
+}
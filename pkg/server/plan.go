@@ -0,0 +1,29 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// handleLatestPlan returns the plan behind the most recent action.
+func (s *Server) handleLatestPlan(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	plan, err := s.storage.GetLatestPlan(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to get latest plan", slog.Any("error", err))
+		http.Error(w, "failed to get latest plan", http.StatusInternalServerError)
+		return
+	}
+	if plan.Timestamp.IsZero() {
+		http.Error(w, "no plan found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	if err := json.NewEncoder(w).Encode(plan); err != nil {
+		panic(http.ErrAbortHandler)
+	}
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type planMockStorage struct {
+	mockStorage
+	plan types.Plan
+}
+
+func (m *planMockStorage) GetLatestPlan(ctx context.Context) (types.Plan, error) {
+	return m.plan, nil
+}
+
+func TestHandleLatestPlan(t *testing.T) {
+	t.Run("No Plan", func(t *testing.T) {
+		s := &Server{storage: &planMockStorage{}}
+
+		rr := httptest.NewRecorder()
+		s.handleLatestPlan(rr, httptest.NewRequest("GET", "/api/plan", nil))
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("Latest Plan", func(t *testing.T) {
+		now := time.Now().Truncate(time.Second).UTC()
+		plan := types.Plan{
+			Timestamp: now,
+			Action:    types.Action{Timestamp: now, BatteryMode: types.BatteryModeStandby},
+			Steps: []types.PlanStep{
+				{TSStart: now, TSEnd: now.Add(time.Hour), BatteryMode: types.BatteryModeStandby, StartSOC: 40, EndSOC: 40, Reason: "Holding battery"},
+			},
+		}
+		s := &Server{storage: &planMockStorage{plan: plan}}
+
+		rr := httptest.NewRecorder()
+		s.handleLatestPlan(rr, httptest.NewRequest("GET", "/api/plan", nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var got types.Plan
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+		assert.Equal(t, plan, got)
+	})
+}
@@ -9,18 +9,26 @@ import (
 )
 
 type SavingsStats struct {
-	Timestamp      time.Time `json:"timestamp"`
-	Cost           float64   `json:"cost"`
-	Credit         float64   `json:"credit"`
-	BatterySavings float64   `json:"batterySavings"` // Estimated Battery Savings = Avoided - Charging
-	SolarSavings   float64   `json:"solarSavings"`   // Estimated Solar Savings = SolarToHome * Price
-	AvoidedCost    float64   `json:"avoidedCost"`    // Cost we would have paid w/o battery (BatteryToHome * Price)
-	ChargingCost   float64   `json:"chargingCost"`   // Cost to charge the battery from grid
-	SolarGenerated float64   `json:"solarGenerated"` // Total solar generated
-	GridImported   float64   `json:"gridImported"`   // Total grid imported
-	GridExported   float64   `json:"gridExported"`   // Total grid exported
-	HomeUsed       float64   `json:"homeUsed"`       // Total home usage
-	BatteryUsed    float64   `json:"batteryUsed"`    // Total battery discharged
+	Timestamp          time.Time `json:"timestamp"`
+	Cost               float64   `json:"cost"`      // Grid imports at the all-in import price plus FixedCost
+	FixedCost          float64   `json:"fixedCost"` // Monthly fixed and capacity charges prorated over the range
+	Credit             float64   `json:"credit"`
+	BatterySavings     float64   `json:"batterySavings"`     // Estimated Battery Savings = Avoided - Charging - Degradation
+	SolarSavings       float64   `json:"solarSavings"`       // Estimated Solar Savings = SolarToHome * Price
+	AvoidedCost        float64   `json:"avoidedCost"`        // Cost we would have paid w/o battery (BatteryToHome * Price)
+	ChargingCost       float64   `json:"chargingCost"`       // Cost to charge the battery from grid
+	DegradationCost    float64   `json:"degradationCost"`    // Cost of battery wear (BatteryUsed * Degradation)
+	EfficiencyLossCost float64   `json:"efficiencyLossCost"` // Portion of ChargingCost lost to round trip inefficiency
+	SolarGenerated     float64   `json:"solarGenerated"`     // Total solar generated
+	GridImported       float64   `json:"gridImported"`       // Total grid imported
+	GridExported       float64   `json:"gridExported"`       // Total grid exported
+	HomeUsed           float64   `json:"homeUsed"`           // Total home usage
+	BatteryUsed        float64   `json:"batteryUsed"`        // Total battery discharged
+
+	PeakGridKW               float64 `json:"peakGridKW"`               // Highest hourly grid import
+	PeakGridKWWithoutBattery float64 `json:"peakGridKWWithoutBattery"` // Highest hourly grid import w/o battery
+	PeakKWAvoided            float64 `json:"peakKWAvoided"`            // PeakGridKWWithoutBattery - PeakGridKW
+	DemandChargeAvoided      float64 `json:"demandChargeAvoided"`      // PeakKWAvoided * Demand Charge
 }
 
 func (s *Server) handleHistorySavings(w http.ResponseWriter, r *http.Request) {
@@ -31,6 +39,17 @@ func (s *Server) handleHistorySavings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	settings, err := s.storage.GetSettings(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to get settings", "error", err)
+		http.Error(w, "failed to get settings", http.StatusInternalServerError)
+		return
+	}
+	efficiency := 1.0
+	if settings.BatteryRoundTripEfficiency > 0 {
+		efficiency = settings.BatteryRoundTripEfficiency / 100
+	}
+
 	// Fetch prices (these are hourly)
 	prices, err := s.storage.GetPriceHistory(ctx, start, end)
 	if err != nil {
@@ -47,26 +66,23 @@ func (s *Server) handleHistorySavings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Create a map of prices for easier lookup by timestamp
-	priceMap := make(map[time.Time]float64)
-	for _, p := range prices {
-		priceMap[p.TSStart.Truncate(time.Hour)] = p.DollarsPerKWH
-	}
-
 	var totalSavings SavingsStats
 	totalSavings.Timestamp = start
 	hourlyPrices := make(map[time.Time]float64)
+	hourlyExportPrices := make(map[time.Time]float64)
 	hourlyPriceCounts := make(map[time.Time]int)
 
 	for _, p := range prices {
 		tsHour := p.TSStart.Truncate(time.Hour)
-		hourlyPrices[tsHour] += p.DollarsPerKWH
+		hourlyPrices[tsHour] += settings.ImportPrice(p)
+		hourlyExportPrices[tsHour] += settings.ExportPrice(p)
 		hourlyPriceCounts[tsHour]++
 	}
 
 	for ts, total := range hourlyPrices {
 		if count := hourlyPriceCounts[ts]; count > 0 {
 			hourlyPrices[ts] = total / float64(count)
+			hourlyExportPrices[ts] /= float64(count)
 		}
 	}
 
@@ -75,6 +91,7 @@ func (s *Server) handleHistorySavings(w http.ResponseWriter, r *http.Request) {
 
 		// this will be 0 if we don't have price data for this hour
 		price := hourlyPrices[ts]
+		exportPrice := hourlyExportPrices[ts]
 
 		// Accumulate Energy Amounts even if price is missing
 		totalSavings.HomeUsed += stat.HomeKWH
@@ -85,7 +102,7 @@ func (s *Server) handleHistorySavings(w http.ResponseWriter, r *http.Request) {
 
 		// Cost and Credit
 		cost := stat.GridImportKWH * price
-		credit := stat.GridExportKWH * price
+		credit := stat.GridExportKWH * exportPrice
 		totalSavings.Cost += cost
 		totalSavings.Credit += credit
 
@@ -100,6 +117,16 @@ func (s *Server) handleHistorySavings(w http.ResponseWriter, r *http.Request) {
 		gridToBattery := math.Max(0, stat.BatteryChargedKWH-stat.SolarToBatteryKWH)
 		chargingCost := gridToBattery * price
 		totalSavings.ChargingCost += chargingCost
+		totalSavings.EfficiencyLossCost += chargingCost * (1 - efficiency)
+
+		// Hourly kWh is the average kW over the hour. Without the battery the
+		// grid would've covered what the battery did but not charged it.
+		totalSavings.PeakGridKW = math.Max(totalSavings.PeakGridKW, stat.GridImportKWH)
+		withoutBattery := math.Max(0, stat.GridImportKWH+batteryToHome-gridToBattery)
+		totalSavings.PeakGridKWWithoutBattery = math.Max(totalSavings.PeakGridKWWithoutBattery, withoutBattery)
+
+		// Every kWh discharged wears the battery
+		totalSavings.DegradationCost += stat.BatteryUsedKWH * settings.BatteryDegradationDollarsPerKWH
 
 		// Solar Savings: Solar powering the home.
 		solarToHome := stat.SolarToHomeKWH
@@ -107,7 +134,12 @@ func (s *Server) handleHistorySavings(w http.ResponseWriter, r *http.Request) {
 		totalSavings.SolarSavings += solarSavings
 	}
 
-	totalSavings.BatterySavings = totalSavings.AvoidedCost - totalSavings.ChargingCost
+	totalSavings.FixedCost = fixedCost(settings.MonthlyFixedDollars(), start, end)
+	totalSavings.Cost += totalSavings.FixedCost
+
+	totalSavings.BatterySavings = totalSavings.AvoidedCost - totalSavings.ChargingCost - totalSavings.DegradationCost
+	totalSavings.PeakKWAvoided = math.Max(0, totalSavings.PeakGridKWWithoutBattery-totalSavings.PeakGridKW)
+	totalSavings.DemandChargeAvoided = totalSavings.PeakKWAvoided * settings.DemandChargeDollarsPerKW
 
 	w.Header().Set("Content-Type", "application/json")
 
@@ -123,3 +155,23 @@ func (s *Server) handleHistorySavings(w http.ResponseWriter, r *http.Request) {
 		panic(http.ErrAbortHandler)
 	}
 }
+
+// fixedCost prorates the monthly fixed charges over start to end by the
+// fraction of each month covered.
+func fixedCost(monthly float64, start, end time.Time) float64 {
+	if monthly <= 0 {
+		return 0
+	}
+	var cost float64
+	for t := start; t.Before(end); {
+		monthStart := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+		monthEnd := monthStart.AddDate(0, 1, 0)
+		until := monthEnd
+		if end.Before(until) {
+			until = end
+		}
+		cost += monthly * until.Sub(t).Hours() / monthEnd.Sub(monthStart).Hours()
+		t = until
+	}
+	return cost
+}
@@ -29,6 +29,11 @@ func (m *mockSavingsStorage) GetEnergyHistory(ctx context.Context, start, end ti
 	return args.Get(0).([]types.EnergyStats), args.Error(1)
 }
 
+func (m *mockSavingsStorage) GetSettings(ctx context.Context) (types.Settings, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(types.Settings), args.Error(1)
+}
+
 func TestHandleHistorySavings(t *testing.T) {
 	mockStore := new(mockSavingsStorage)
 	s := &Server{storage: mockStore}
@@ -88,6 +93,7 @@ func TestHandleHistorySavings(t *testing.T) {
 		},
 	}
 
+	mockStore.On("GetSettings", mock.Anything).Return(types.Settings{}, nil)
 	mockStore.On("GetPriceHistory", mock.Anything, mock.Anything, mock.Anything).Return(prices, nil)
 	mockStore.On("GetEnergyHistory", mock.Anything, mock.Anything, mock.Anything).Return(stats, nil)
 
@@ -135,3 +141,223 @@ func TestHandleHistorySavings(t *testing.T) {
 	// Home Used: 10 + 10 + 0 + 0 + 10 = 30
 	assert.Equal(t, 30.0, savings.HomeUsed)
 }
+
+func TestHandleHistorySavings_Degradation(t *testing.T) {
+	mockStore := new(mockSavingsStorage)
+	s := &Server{storage: mockStore}
+
+	start := time.Now().Truncate(24 * time.Hour)
+	end := start.Add(24 * time.Hour)
+
+	prices := []types.Price{
+		{TSStart: start, TSEnd: start.Add(time.Hour), DollarsPerKWH: 0.05},
+		{TSStart: start.Add(time.Hour), TSEnd: start.Add(2 * time.Hour), DollarsPerKWH: 0.20},
+	}
+	stats := []types.EnergyStats{
+		// Charge 10kWh from the grid
+		{
+			TSHourStart:       start,
+			GridImportKWH:     10,
+			BatteryChargedKWH: 10,
+		},
+		// Discharge 8kWh to the home
+		{
+			TSHourStart:      start.Add(time.Hour),
+			HomeKWH:          8,
+			BatteryUsedKWH:   8,
+			BatteryToHomeKWH: 8,
+		},
+	}
+
+	mockStore.On("GetSettings", mock.Anything).Return(types.Settings{
+		BatteryRoundTripEfficiency:      80,
+		BatteryDegradationDollarsPerKWH: 0.02,
+	}, nil)
+	mockStore.On("GetPriceHistory", mock.Anything, mock.Anything, mock.Anything).Return(prices, nil)
+	mockStore.On("GetEnergyHistory", mock.Anything, mock.Anything, mock.Anything).Return(stats, nil)
+
+	req, _ := http.NewRequest("GET", "/api/history/savings?start="+start.Format(time.RFC3339)+"&end="+end.Format(time.RFC3339), nil)
+	rr := httptest.NewRecorder()
+
+	s.handleHistorySavings(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var savings SavingsStats
+	err := json.Unmarshal(rr.Body.Bytes(), &savings)
+	assert.NoError(t, err)
+
+	// Charging: 10 * 0.05 = 0.50, of which 20% was lost
+	assert.InDelta(t, 0.50, savings.ChargingCost, 0.0001)
+	assert.InDelta(t, 0.10, savings.EfficiencyLossCost, 0.0001)
+
+	// Degradation: 8 * 0.02 = 0.16
+	assert.InDelta(t, 0.16, savings.DegradationCost, 0.0001)
+
+	// Battery Savings: 8 * 0.20 - 0.50 - 0.16 = 0.94
+	assert.InDelta(t, 0.94, savings.BatterySavings, 0.0001)
+}
+
+func TestHandleHistorySavings_Tariff(t *testing.T) {
+	mockStore := new(mockSavingsStorage)
+	s := &Server{storage: mockStore}
+
+	// 1 day of the 30 in June
+	start := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+
+	prices := []types.Price{
+		{TSStart: start, TSEnd: start.Add(time.Hour), DollarsPerKWH: 0.05},
+		{TSStart: start.Add(time.Hour), TSEnd: start.Add(2 * time.Hour), DollarsPerKWH: 0.20},
+	}
+	stats := []types.EnergyStats{
+		{
+			TSHourStart:       start,
+			GridImportKWH:     10,
+			BatteryChargedKWH: 10,
+		},
+		{
+			TSHourStart:      start.Add(time.Hour),
+			HomeKWH:          8,
+			BatteryUsedKWH:   8,
+			BatteryToHomeKWH: 8,
+		},
+	}
+
+	mockStore.On("GetSettings", mock.Anything).Return(types.Settings{
+		CapacityChargeDollarsPerKW: 72,
+		Tariff: types.Tariff{
+			DeliveryDollarsPerKWH:  0.05,
+			TaxPercent:             10,
+			MonthlyFixedDollars:    15,
+			PeakLoadContributionKW: 2.5,
+		},
+	}, nil)
+	mockStore.On("GetPriceHistory", mock.Anything, mock.Anything, mock.Anything).Return(prices, nil)
+	mockStore.On("GetEnergyHistory", mock.Anything, mock.Anything, mock.Anything).Return(stats, nil)
+
+	req, _ := http.NewRequest("GET", "/api/history/savings?start="+start.Format(time.RFC3339)+"&end="+end.Format(time.RFC3339), nil)
+	rr := httptest.NewRecorder()
+
+	s.handleHistorySavings(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var savings SavingsStats
+	err := json.Unmarshal(rr.Body.Bytes(), &savings)
+	assert.NoError(t, err)
+
+	// Fixed: (15 + 2.5 * 72 / 12) / 30 = 1.00
+	assert.InDelta(t, 1.00, savings.FixedCost, 0.0001)
+	// Cost: 10 * (0.05 + 0.05) * 1.1 + 1.00 = 2.10
+	assert.InDelta(t, 2.10, savings.Cost, 0.0001)
+	// Avoided: 8 * (0.20 + 0.05) * 1.1 = 2.20
+	assert.InDelta(t, 2.20, savings.AvoidedCost, 0.0001)
+	assert.InDelta(t, 1.10, savings.ChargingCost, 0.0001)
+}
+
+func TestFixedCost(t *testing.T) {
+	assert.Zero(t, fixedCost(0, time.Now().Add(-time.Hour), time.Now()))
+
+	// half a day in May and half a day in June
+	start := time.Date(2026, 5, 31, 12, 0, 0, 0, time.UTC)
+	assert.InDelta(t, 31*(12.0/744+12.0/720), fixedCost(31, start, start.Add(24*time.Hour)), 1e-9)
+}
+
+func TestHandleHistorySavings_PeakShaving(t *testing.T) {
+	mockStore := new(mockSavingsStorage)
+	s := &Server{storage: mockStore}
+
+	start := time.Now().Truncate(24 * time.Hour)
+	end := start.Add(24 * time.Hour)
+
+	stats := []types.EnergyStats{
+		// Charge 4kWh from the grid while the home uses 2kWh
+		{
+			TSHourStart:       start,
+			HomeKWH:           2,
+			GridImportKWH:     6,
+			BatteryChargedKWH: 4,
+		},
+		// Shave a 9kW peak down to 5kW
+		{
+			TSHourStart:      start.Add(time.Hour),
+			HomeKWH:          9,
+			GridImportKWH:    5,
+			BatteryUsedKWH:   4,
+			BatteryToHomeKWH: 4,
+		},
+	}
+
+	mockStore.On("GetSettings", mock.Anything).Return(types.Settings{DemandChargeDollarsPerKW: 15}, nil)
+	mockStore.On("GetPriceHistory", mock.Anything, mock.Anything, mock.Anything).Return([]types.Price{}, nil)
+	mockStore.On("GetEnergyHistory", mock.Anything, mock.Anything, mock.Anything).Return(stats, nil)
+
+	req, _ := http.NewRequest("GET", "/api/history/savings?start="+start.Format(time.RFC3339)+"&end="+end.Format(time.RFC3339), nil)
+	rr := httptest.NewRecorder()
+
+	s.handleHistorySavings(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var savings SavingsStats
+	err := json.Unmarshal(rr.Body.Bytes(), &savings)
+	assert.NoError(t, err)
+
+	// the charging hour is now the peak
+	assert.InDelta(t, 6.0, savings.PeakGridKW, 0.0001)
+	assert.InDelta(t, 9.0, savings.PeakGridKWWithoutBattery, 0.0001)
+	assert.InDelta(t, 3.0, savings.PeakKWAvoided, 0.0001)
+	assert.InDelta(t, 45.0, savings.DemandChargeAvoided, 0.0001)
+}
+
+func TestHandleHistorySavings_ExportCredit(t *testing.T) {
+	start := time.Now().Truncate(24 * time.Hour)
+	end := start.Add(24 * time.Hour)
+
+	utilityExport := 0.04
+	prices := []types.Price{
+		{TSStart: start, TSEnd: start.Add(time.Hour), DollarsPerKWH: 0.20},
+		{TSStart: start.Add(time.Hour), TSEnd: start.Add(2 * time.Hour), DollarsPerKWH: 0.20, ExportDollarsPerKWH: &utilityExport},
+	}
+	stats := []types.EnergyStats{
+		{TSHourStart: start, SolarKWH: 5, SolarToGridKWH: 5, GridExportKWH: 5},
+		{TSHourStart: start.Add(time.Hour), SolarKWH: 5, SolarToGridKWH: 5, GridExportKWH: 5},
+	}
+
+	tests := []struct {
+		name     string
+		settings types.Settings
+		credit   float64
+	}{
+		// 5 * 0.20 + 5 * 0.04
+		{name: "Utility", settings: types.Settings{}, credit: 1.20},
+		// 10 * 0.03
+		{name: "Fixed", settings: types.Settings{ExportCreditType: types.ExportCreditTypeFixed, ExportCreditDollarsPerKWH: 0.03}, credit: 0.30},
+		// 10 * 0.20 * 25%
+		{name: "Percent", settings: types.Settings{ExportCreditType: types.ExportCreditTypePercent, ExportCreditPercent: 25}, credit: 0.50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := new(mockSavingsStorage)
+			s := &Server{storage: mockStore}
+
+			mockStore.On("GetSettings", mock.Anything).Return(tt.settings, nil)
+			mockStore.On("GetPriceHistory", mock.Anything, mock.Anything, mock.Anything).Return(prices, nil)
+			mockStore.On("GetEnergyHistory", mock.Anything, mock.Anything, mock.Anything).Return(stats, nil)
+
+			req, _ := http.NewRequest("GET", "/api/history/savings?start="+start.Format(time.RFC3339)+"&end="+end.Format(time.RFC3339), nil)
+			rr := httptest.NewRecorder()
+
+			s.handleHistorySavings(rr, req)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+
+			var savings SavingsStats
+			err := json.Unmarshal(rr.Body.Bytes(), &savings)
+			assert.NoError(t, err)
+			assert.InDelta(t, tt.credit, savings.Credit, 0.0001)
+		})
+	}
+}
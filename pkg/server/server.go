@@ -15,8 +15,10 @@ import (
 
 	"google.golang.org/api/idtoken"
 
+	"github.com/jameshartig/autoenergy/pkg/carbon"
 	"github.com/jameshartig/autoenergy/pkg/controller"
 	"github.com/jameshartig/autoenergy/pkg/ess"
+	"github.com/jameshartig/autoenergy/pkg/forecast"
 	"github.com/jameshartig/autoenergy/pkg/storage"
 	"github.com/jameshartig/autoenergy/pkg/utility"
 	"github.com/jameshartig/autoenergy/web"
@@ -39,7 +41,14 @@ type Server struct {
 	utilityProvider utility.Provider
 	essSystem       ess.System
 	storage         storage.Provider
-	controller      *controller.Controller
+	solarForecaster forecast.SolarForecaster
+	carbonProvider  carbon.Provider
+	// strategy is used unless the settings pick a different one
+	strategy        controller.Strategy
+	priceForecaster *utility.PriceForecaster
+
+	// loadHistoryLookback is how much energy history is used to model load
+	loadHistoryLookback time.Duration
 
 	listenAddr             string
 	devProxy               string
@@ -55,12 +64,13 @@ type Server struct {
 
 // Configured initializes the Server with dependencies.
 // It uses lflag to register command-line flags for configuration.
-func Configured(u utility.Provider, e ess.System, s storage.Provider) *Server {
+func Configured(u utility.Provider, e ess.System, s storage.Provider, f forecast.SolarForecaster, c carbon.Provider) *Server {
 	srv := &Server{
 		utilityProvider: u,
 		essSystem:       e,
 		storage:         s,
-		controller:      controller.NewController(),
+		solarForecaster: f,
+		carbonProvider:  c,
 		tokenValidator:  idtoken.Validate,
 	}
 
@@ -77,8 +87,16 @@ func Configured(u utility.Provider, e ess.System, s storage.Provider) *Server {
 	adminEmails := lflag.String("admin-emails", "", "comma-delimited list of email addresses allowed to update settings via IAP")
 	oidcAudience := lflag.String("oidc-audience", "", "token to use for id tokens audience to validate")
 	updateSpecificAudience := lflag.String("update-specific-audience", "", "audience to validate for /api/update")
+	strategy := lflag.String("strategy", controller.DefaultStrategy, fmt.Sprintf("Strategy to decide what the ESS does (available: %s)", strings.Join(controller.Strategies(), ", ")))
+	loadHistoryLookback := lflag.Duration("load-history-lookback", 28*24*time.Hour, "how much energy history to use when modeling home load")
+	priceForecastLookback := lflag.Duration("price-forecast-lookback", 28*24*time.Hour, "how much price history to use when forecasting prices without day-ahead prices (0 to disable)")
 
 	lflag.Do(func() {
+		strat, err := controller.NewStrategy(*strategy)
+		if err != nil {
+			panic(err.Error())
+		}
+		srv.strategy = strat
 		srv.listenAddr = *listenAddr
 		srv.devProxy = *devProxy
 		srv.updateSpecificEmail = *updateSpecificEmail
@@ -90,6 +108,10 @@ func Configured(u utility.Provider, e ess.System, s storage.Provider) *Server {
 		}
 		srv.oidcAudience = *oidcAudience
 		srv.updateSpecificAudience = *updateSpecificAudience
+		srv.loadHistoryLookback = *loadHistoryLookback
+		if *priceForecastLookback > 0 {
+			srv.priceForecaster = utility.NewPriceForecaster(s, *priceForecastLookback)
+		}
 
 		if *devProxy != "" && *oidcAudience == "" && *adminEmails == "" {
 			srv.bypassAuth = true
@@ -105,8 +127,15 @@ func (s *Server) setupHandler() http.Handler {
 	mux.HandleFunc("GET /api/history/prices", s.handleHistoryPrices)
 	mux.HandleFunc("GET /api/history/actions", s.handleHistoryActions)
 	mux.HandleFunc("GET /api/history/savings", s.handleHistorySavings)
+	mux.HandleFunc("GET /api/history/hindsight", s.handleHistoryHindsight)
+	mux.HandleFunc("GET /api/history/emissions", s.handleHistoryEmissions)
+	mux.HandleFunc("GET /api/model/load", s.handleLoadModel)
+	mux.HandleFunc("GET /api/plan", s.handleLatestPlan)
 	mux.HandleFunc("GET /api/settings", s.handleGetSettings)
 	mux.HandleFunc("POST /api/settings", s.handleUpdateSettings)
+	mux.HandleFunc("GET /api/override", s.handleGetOverride)
+	mux.HandleFunc("POST /api/override", s.handleSetOverride)
+	mux.HandleFunc("DELETE /api/override", s.handleClearOverride)
 	mux.HandleFunc("GET /api/auth/status", s.handleAuthStatus)
 	mux.HandleFunc("POST /api/auth/login", s.handleLogin)
 	mux.HandleFunc("POST /api/auth/logout", s.handleLogout)
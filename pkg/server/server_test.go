@@ -15,7 +15,8 @@ import (
 
 // Mock implementations
 type mockUtility struct {
-	price types.Price
+	price     types.Price
+	futureErr error
 }
 
 func (m *mockUtility) GetCurrentPrice(ctx context.Context) (types.Price, error) {
@@ -25,11 +26,14 @@ func (m *mockUtility) LastConfirmedPrice(ctx context.Context) (types.Price, erro
 	return m.price, nil
 }
 func (m *mockUtility) GetFuturePrices(ctx context.Context) ([]types.Price, error) {
-	return nil, nil
+	return nil, m.futureErr
 }
 func (m *mockUtility) GetConfirmedPrices(ctx context.Context, start, end time.Time) ([]types.Price, error) {
 	return nil, nil
 }
+func (m *mockUtility) ApplySettings(ctx context.Context, settings types.Settings) error {
+	return nil
+}
 func (m *mockUtility) Validate() error { return nil }
 
 type mockESS struct{}
@@ -53,6 +57,7 @@ func (m *mockESS) Validate() error { return nil }
 
 type mockStorage struct {
 	settings types.Settings
+	override types.Override
 }
 
 func (m *mockStorage) GetSettings(ctx context.Context) (types.Settings, error) {
@@ -62,8 +67,20 @@ func (m *mockStorage) SetSettings(ctx context.Context, settings types.Settings)
 	m.settings = settings
 	return nil
 }
+func (m *mockStorage) GetOverride(ctx context.Context) (types.Override, error) {
+	return m.override, nil
+}
+func (m *mockStorage) SetOverride(ctx context.Context, override types.Override) error {
+	m.override = override
+	return nil
+}
+func (m *mockStorage) ClearOverride(ctx context.Context) error {
+	m.override = types.Override{}
+	return nil
+}
 func (m *mockStorage) UpsertPrice(ctx context.Context, price types.Price) error    { return nil }
 func (m *mockStorage) InsertAction(ctx context.Context, action types.Action) error { return nil }
+func (m *mockStorage) SetLatestPlan(ctx context.Context, plan types.Plan) error    { return nil }
 func (m *mockStorage) GetPriceHistory(ctx context.Context, start, end time.Time) ([]types.Price, error) {
 	return nil, nil
 }
@@ -82,6 +99,9 @@ func (m *mockStorage) GetLatestEnergyHistoryTime(ctx context.Context) (time.Time
 func (m *mockStorage) GetLatestPriceHistoryTime(ctx context.Context) (time.Time, error) {
 	return time.Time{}, nil
 }
+func (m *mockStorage) GetLatestPlan(ctx context.Context) (types.Plan, error) {
+	return types.Plan{}, nil
+}
 func (m *mockStorage) Close() error { return nil }
 
 func TestSPAHandler(t *testing.T) {
@@ -106,7 +126,7 @@ func TestSPAHandler(t *testing.T) {
 			essSystem:       &mockESS{},
 			storage:         mockS,
 			listenAddr:      ":8080",
-			controller:      controller.NewController(),
+			strategy:        controller.NewController(),
 		}
 
 		// Manually setup the handler with our test FS to avoid web.DistFS dependency in this specific test unit
@@ -131,7 +151,7 @@ func TestSPAHandler(t *testing.T) {
 			essSystem:       &mockESS{},
 			storage:         mockS,
 			listenAddr:      ":8080",
-			controller:      controller.NewController(),
+			strategy:        controller.NewController(),
 		}
 
 		mux := http.NewServeMux()
@@ -154,7 +174,7 @@ func TestSPAHandler(t *testing.T) {
 			essSystem:       &mockESS{},
 			storage:         mockS,
 			listenAddr:      ":8080",
-			controller:      controller.NewController(),
+			strategy:        controller.NewController(),
 		}
 
 		mux := http.NewServeMux()
@@ -184,7 +204,7 @@ func TestSPAHandler(t *testing.T) {
 			essSystem:       &mockESS{},
 			storage:         mockS,
 			listenAddr:      ":8080",
-			controller:      controller.NewController(),
+			strategy:        controller.NewController(),
 			devProxy:        devServer.URL, // Point to our mock dev server
 		}
 
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"log/slog"
 	"net/http"
+	"time"
 
+	"github.com/jameshartig/autoenergy/pkg/controller"
 	"github.com/jameshartig/autoenergy/pkg/types"
 )
 
@@ -25,33 +27,8 @@ func (s *Server) handleGetSettings(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleUpdateSettings(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	if !s.bypassAuth {
-		// don't let a misconfiguration to allow updates
-		if len(s.adminEmails) == 0 {
-			http.Error(w, "settings updates are disabled", http.StatusForbidden)
-			return
-		}
-
-		// Validate Authentication from Context (set by authMiddleware)
-		email, ok := ctx.Value(emailContextKey).(string)
-		if !ok || email == "" {
-			http.Error(w, "missing authentication", http.StatusUnauthorized)
-			return
-		}
-
-		var allowed bool
-		for _, admin := range s.adminEmails {
-			if email == admin {
-				allowed = true
-				break
-			}
-		}
-
-		if !allowed {
-			slog.WarnContext(ctx, "unauthorized email for settings update", slog.String("email", email))
-			http.Error(w, "unauthorized email", http.StatusForbidden)
-			return
-		}
+	if !s.authorizeAdmin(w, r, "settings updates") {
+		return
 	}
 
 	var newSettings types.Settings
@@ -65,11 +42,122 @@ func (s *Server) handleUpdateSettings(w http.ResponseWriter, r *http.Request) {
 	if newSettings.AlwaysChargeUnderDollarsPerKWH < 0 ||
 		newSettings.AdditionalFeesDollarsPerKWH < 0 ||
 		newSettings.MinArbitrageDifferenceDollarsPerKWH < 0 ||
+		newSettings.CarbonDollarsPerKG < 0 ||
 		newSettings.MinBatterySOC < 0 || newSettings.MinBatterySOC > 100 ||
-		newSettings.IgnoreHourUsageOverMultiple < 1 {
+		newSettings.BatteryRoundTripEfficiency < 0 || newSettings.BatteryRoundTripEfficiency > 100 ||
+		newSettings.BatteryDegradationDollarsPerKWH < 0 ||
+		newSettings.MaxBatteryCyclesPerDay < 0 ||
+		newSettings.ExportCreditDollarsPerKWH < 0 ||
+		newSettings.MaxGridUseKW < 0 ||
+		(newSettings.PlanningHorizonHours != 0 && (newSettings.PlanningHorizonHours < 24 || newSettings.PlanningHorizonHours > 48)) ||
+		newSettings.DemandChargeDollarsPerKW < 0 ||
+		newSettings.CapacityChargeDollarsPerKW < 0 ||
+		newSettings.CapacityPeakLoadMW < 0 ||
+		newSettings.CapacityPeakPriceDollarsPerKWH < 0 ||
+		newSettings.MinModeDwellMinutes < 0 || newSettings.MinModeDwellMinutes > 24*60 ||
+		newSettings.ModeHysteresisDollarsPerKWH < 0 ||
+		newSettings.FailSafeReserveSOC < 0 || newSettings.FailSafeReserveSOC > 100 ||
+		newSettings.StaleDataMinutes < 0 ||
+		newSettings.LoadOutlierStdDevs < 0 ||
+		newSettings.SolarLatitude < -90 || newSettings.SolarLatitude > 90 ||
+		newSettings.SolarLongitude < -180 || newSettings.SolarLongitude > 180 ||
+		newSettings.SolarKWP < 0 ||
+		newSettings.SolarTiltDegrees < 0 || newSettings.SolarTiltDegrees > 90 ||
+		newSettings.SolarAzimuthDegrees < 0 || newSettings.SolarAzimuthDegrees > 360 ||
+		newSettings.ExportCreditPercent < 0 || newSettings.ExportCreditPercent > 100 ||
+		newSettings.Tariff.DeliveryDollarsPerKWH < 0 ||
+		newSettings.Tariff.TransmissionDollarsPerKWH < 0 ||
+		newSettings.Tariff.TaxPercent < 0 ||
+		newSettings.Tariff.MonthlyFixedDollars < 0 ||
+		newSettings.Tariff.PeakLoadContributionKW < 0 {
 		http.Error(w, "invalid settings values", http.StatusBadRequest)
 		return
 	}
+	switch newSettings.ExportCreditType {
+	case "", types.ExportCreditTypeUtility, types.ExportCreditTypeFixed, types.ExportCreditTypePercent:
+	default:
+		http.Error(w, "invalid export credit type", http.StatusBadRequest)
+		return
+	}
+
+	switch newSettings.FailSafeMode {
+	case "", types.FailSafeModeReserve, types.FailSafeModeStandby, types.FailSafeModeContinue:
+	default:
+		http.Error(w, "invalid fail-safe mode", http.StatusBadRequest)
+		return
+	}
+
+	if newSettings.Strategy != "" {
+		if _, err := controller.NewStrategy(newSettings.Strategy); err != nil {
+			http.Error(w, "invalid strategy", http.StatusBadRequest)
+			return
+		}
+	}
+	if newSettings.Timezone != "" {
+		if _, err := time.LoadLocation(newSettings.Timezone); err != nil {
+			http.Error(w, "invalid timezone", http.StatusBadRequest)
+			return
+		}
+	}
+	for _, target := range newSettings.SOCTargets {
+		if target.SOC <= 0 || target.SOC > 100 {
+			http.Error(w, "invalid SOC target", http.StatusBadRequest)
+			return
+		}
+		if !target.Deadline.IsZero() {
+			continue
+		}
+		if _, err := time.Parse("15:04", target.Time); err != nil {
+			http.Error(w, "invalid SOC target time", http.StatusBadRequest)
+			return
+		}
+		for _, day := range target.Days {
+			if day < time.Sunday || day > time.Saturday {
+				http.Error(w, "invalid SOC target day", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	for _, period := range newSettings.Tariff.TimeOfDay {
+		if _, err := time.Parse("15:04", period.Start); err != nil {
+			http.Error(w, "invalid tariff period start", http.StatusBadRequest)
+			return
+		}
+		if _, err := time.Parse("15:04", period.End); err != nil {
+			http.Error(w, "invalid tariff period end", http.StatusBadRequest)
+			return
+		}
+		for _, day := range period.Days {
+			if day < time.Sunday || day > time.Saturday {
+				http.Error(w, "invalid tariff period day", http.StatusBadRequest)
+				return
+			}
+		}
+		for _, month := range period.Months {
+			if month < time.January || month > time.December {
+				http.Error(w, "invalid tariff period month", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	if newSettings.TOUSchedule != nil {
+		if err := newSettings.TOUSchedule.Validate(); err != nil {
+			http.Error(w, "invalid TOU schedule: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	for _, holiday := range newSettings.Holidays {
+		if _, err := time.Parse(time.DateOnly, holiday); err != nil {
+			http.Error(w, "invalid holiday", http.StatusBadRequest)
+			return
+		}
+	}
+	for _, alert := range newSettings.CapacityPeakAlerts {
+		if _, err := time.Parse(time.DateOnly, alert); err != nil {
+			http.Error(w, "invalid capacity peak alert", http.StatusBadRequest)
+			return
+		}
+	}
 
 	if err := s.storage.SetSettings(ctx, newSettings); err != nil {
 		slog.ErrorContext(ctx, "failed to save settings", slog.Any("error", err))
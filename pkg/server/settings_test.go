@@ -10,6 +10,7 @@ import (
 	"github.com/jameshartig/autoenergy/pkg/controller"
 	"github.com/jameshartig/autoenergy/pkg/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSettings(t *testing.T) {
@@ -27,7 +28,7 @@ func TestSettings(t *testing.T) {
 			utilityProvider: mockU,
 			essSystem:       &mockESS{},
 			storage:         mockS,
-			controller:      controller.NewController(),
+			strategy:        controller.NewController(),
 			adminEmails:     emails,
 			oidcAudience:    audience,
 			tokenValidator:  validator,
@@ -91,8 +92,98 @@ func TestSettings(t *testing.T) {
 		srv.handleUpdateSettings(w, req)
 		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
 
-		// Invalid value (IgnoreHourUsageOverMultiple < 1)
-		body = `{"ignoreHourUsageOverMultiple": 0}`
+		// Invalid holiday
+		body = `{"holidays": ["12/25/2026"]}`
+		req = httptest.NewRequest("POST", "/api/settings", strings.NewReader(body))
+		req = withEmail(req, "admin@example.com")
+		w = httptest.NewRecorder()
+
+		srv.handleUpdateSettings(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+
+		// Invalid planning horizon
+		body = `{"planningHorizonHours": 72}`
+		req = httptest.NewRequest("POST", "/api/settings", strings.NewReader(body))
+		req = withEmail(req, "admin@example.com")
+		w = httptest.NewRecorder()
+
+		srv.handleUpdateSettings(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+
+		// Invalid dwell time
+		body = `{"minModeDwellMinutes": 2000}`
+		req = httptest.NewRequest("POST", "/api/settings", strings.NewReader(body))
+		req = withEmail(req, "admin@example.com")
+		w = httptest.NewRecorder()
+
+		srv.handleUpdateSettings(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+
+		// Invalid SOC target
+		body = `{"socTargets": [{"soc": 90, "time": "4pm"}]}`
+		req = httptest.NewRequest("POST", "/api/settings", strings.NewReader(body))
+		req = withEmail(req, "admin@example.com")
+		w = httptest.NewRecorder()
+
+		srv.handleUpdateSettings(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+
+		// Negative carbon weight
+		body = `{"carbonDollarsPerKG": -0.1}`
+		req = httptest.NewRequest("POST", "/api/settings", strings.NewReader(body))
+		req = withEmail(req, "admin@example.com")
+		w = httptest.NewRecorder()
+
+		srv.handleUpdateSettings(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+
+		// Invalid timezone
+		body = `{"timezone": "Central"}`
+		req = httptest.NewRequest("POST", "/api/settings", strings.NewReader(body))
+		req = withEmail(req, "admin@example.com")
+		w = httptest.NewRecorder()
+
+		srv.handleUpdateSettings(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+
+		// Invalid capacity peak alert
+		body = `{"capacityPeakAlerts": ["July 15"]}`
+		req = httptest.NewRequest("POST", "/api/settings", strings.NewReader(body))
+		req = withEmail(req, "admin@example.com")
+		w = httptest.NewRecorder()
+
+		srv.handleUpdateSettings(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+
+		// Invalid tariff period
+		body = `{"tariff": {"timeOfDay": [{"start": "13:00", "end": "7pm", "dollarsPerKWH": 0.04}]}}`
+		req = httptest.NewRequest("POST", "/api/settings", strings.NewReader(body))
+		req = withEmail(req, "admin@example.com")
+		w = httptest.NewRecorder()
+
+		srv.handleUpdateSettings(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+
+		// Invalid TOU schedule
+		body = `{"touSchedule": {"seasons": [{"startMonth": 1, "endMonth": 12, "periods": [{"days": "workdays", "dollarsPerKWH": 0.1}]}]}}`
+		req = httptest.NewRequest("POST", "/api/settings", strings.NewReader(body))
+		req = withEmail(req, "admin@example.com")
+		w = httptest.NewRecorder()
+
+		srv.handleUpdateSettings(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+
+		// Unknown fail-safe mode
+		body = `{"failSafeMode": "panic"}`
+		req = httptest.NewRequest("POST", "/api/settings", strings.NewReader(body))
+		req = withEmail(req, "admin@example.com")
+		w = httptest.NewRecorder()
+
+		srv.handleUpdateSettings(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+
+		// Unknown strategy
+		body = `{"strategy": "magic"}`
 		req = httptest.NewRequest("POST", "/api/settings", strings.NewReader(body))
 		req = withEmail(req, "admin@example.com")
 		w = httptest.NewRecorder()
@@ -104,7 +195,7 @@ func TestSettings(t *testing.T) {
 	t.Run("Update Settings - Success", func(t *testing.T) {
 		srv := newAuthServer("my-audience", []string{"admin@example.com"}, nil)
 
-		body := `{"minBatterySOC": 80, "dryRun": true, "ignoreHourUsageOverMultiple": 5}`
+		body := `{"minBatterySOC": 80, "dryRun": true, "holidays": ["2026-12-25"], "strategy": "heuristic", "socTargets": [{"soc": 90, "time": "16:00", "days": [1, 2, 3, 4, 5]}]}`
 		req := httptest.NewRequest("POST", "/api/settings", strings.NewReader(body))
 		req = withEmail(req, "admin@example.com")
 		w := httptest.NewRecorder()
@@ -115,6 +206,9 @@ func TestSettings(t *testing.T) {
 		// Verify storage updated
 		assert.Equal(t, 80.0, mockS.settings.MinBatterySOC)
 		assert.True(t, mockS.settings.DryRun)
+		assert.Equal(t, []string{"2026-12-25"}, mockS.settings.Holidays)
+		require.Len(t, mockS.settings.SOCTargets, 1)
+		assert.Equal(t, "16:00", mockS.settings.SOCTargets[0].Time)
 	})
 
 	t.Run("Auth Status - Is Admin", func(t *testing.T) {
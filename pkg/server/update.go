@@ -8,9 +8,15 @@ import (
 	"strings"
 	"time"
 
+	"github.com/jameshartig/autoenergy/pkg/carbon"
+	"github.com/jameshartig/autoenergy/pkg/controller"
 	"github.com/jameshartig/autoenergy/pkg/types"
 )
 
+// recentActionsLookback is how far back to look for the mode we're in. It
+// covers the longest MinModeDwellMinutes.
+const recentActionsLookback = 24 * time.Hour
+
 func (s *Server) handleUpdate(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -102,6 +108,22 @@ func (s *Server) handleUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	err = s.utilityProvider.ApplySettings(ctx, settings)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to apply settings to utility", slog.Any("error", err))
+		http.Error(w, "failed to apply settings", http.StatusInternalServerError)
+		return
+	}
+
+	if s.solarForecaster != nil {
+		err = s.solarForecaster.ApplySettings(ctx, settings)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to apply settings to solar forecaster", slog.Any("error", err))
+			http.Error(w, "failed to apply settings", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	slog.DebugContext(ctx, "update: settings applied")
 
 	// 2. Sync energy history
@@ -179,6 +201,14 @@ func (s *Server) handleUpdate(w http.ResponseWriter, r *http.Request) {
 			if err != nil {
 				slog.ErrorContext(ctx, "failed to get confirmed prices", slog.Any("error", err), slog.Time("start", t), slog.Time("end", end))
 			} else {
+				// store the emissions alongside the prices for reporting
+				if s.carbonProvider != nil {
+					intensities, err := s.carbonProvider.GetHistoricalIntensity(ctx, t, end)
+					if err != nil {
+						slog.WarnContext(ctx, "failed to get historical carbon intensity", slog.Any("error", err), slog.Time("start", t), slog.Time("end", end))
+					}
+					carbon.Annotate(newPrices, intensities)
+				}
 				for _, p := range newPrices {
 					if err := s.storage.UpsertPrice(ctx, p); err != nil {
 						slog.ErrorContext(ctx, "failed to upsert price", slog.Any("error", err))
@@ -225,42 +255,143 @@ func (s *Server) handleUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// degraded are the inputs that are missing or stale
+	var degraded []types.DegradedInput
+
 	// 4. Get Current Price for controller
 	currentPrice, err := s.utilityProvider.GetCurrentPrice(ctx)
 	if err != nil {
-		slog.ErrorContext(ctx, "failed to get price", slog.Any("error", err))
-		http.Error(w, "failed to get price", http.StatusInternalServerError)
-		return
+		// without a price we can only decide with the fail-safe
+		if settings.FailSafeMode == types.FailSafeModeContinue {
+			slog.ErrorContext(ctx, "failed to get price", slog.Any("error", err))
+			http.Error(w, "failed to get price", http.StatusInternalServerError)
+			return
+		}
+		slog.WarnContext(ctx, "failed to get price", slog.Any("error", err))
+		degraded = append(degraded, types.DegradedInputCurrentPrice)
 	}
 
 	slog.DebugContext(ctx, "update: current price fetched")
 
 	// 5. Get Future Prices for controller
-	futurePrices, err := s.utilityProvider.GetFuturePrices(ctx)
-	if err != nil {
-		slog.WarnContext(ctx, "failed to get future prices", slog.Any("error", err))
+	futurePrices, futurePricesErr := s.utilityProvider.GetFuturePrices(ctx)
+	if futurePricesErr != nil {
+		slog.WarnContext(ctx, "failed to get future prices", slog.Any("error", futurePricesErr))
 		// Continue with empty future prices
 	}
 
-	// 6. Get History for Controller (Last 72 hours from Storage)
-	historyStart := time.Now().Add(-72 * time.Hour)
+	// 5b. Fill in the hours without future prices from historical prices
+	if s.priceForecaster != nil {
+		forecast, err := s.priceForecaster.Forecast(ctx, time.Now(), futurePrices, settings.PlanningHorizon())
+		if err != nil {
+			slog.WarnContext(ctx, "failed to forecast future prices", slog.Any("error", err))
+		} else {
+			futurePrices = forecast
+		}
+	}
+	// the forecast covers for missing day-ahead prices so we're only degraded
+	// if nothing filled them in
+	if futurePricesErr != nil && len(futurePrices) == 0 {
+		degraded = append(degraded, types.DegradedInputFuturePrices)
+	}
+
+	// 5c. Add the carbon intensity to the prices if we have it
+	if s.carbonProvider != nil {
+		current, err := s.carbonProvider.GetCurrentIntensity(ctx)
+		if err != nil {
+			slog.WarnContext(ctx, "failed to get current carbon intensity", slog.Any("error", err))
+		} else if !current.TSStart.IsZero() {
+			currentPrice.GCO2PerKWH = &current.GCO2PerKWH
+		}
+		forecast, err := s.carbonProvider.GetForecastIntensity(ctx)
+		if err != nil {
+			slog.WarnContext(ctx, "failed to get carbon intensity forecast", slog.Any("error", err))
+		}
+		carbon.Annotate(futurePrices, forecast)
+	}
+
+	// 6. Get History for Controller (from Storage)
+	historyStart := time.Now().Add(-s.loadHistoryLookback)
 	historyEnd := time.Now()
 	energyHistory, err := s.storage.GetEnergyHistory(ctx, historyStart, historyEnd)
 	if err != nil {
 		slog.WarnContext(ctx, "failed to get energy history from storage", slog.Any("error", err))
+		degraded = append(degraded, types.DegradedInputEnergyHistory)
+	}
+
+	// 6b. Get the solar forecast if we have one
+	var solarForecast []types.SolarForecast
+	if s.solarForecaster != nil {
+		solarForecast, err = s.solarForecaster.GetSolarForecast(ctx)
+		if err != nil {
+			slog.WarnContext(ctx, "failed to get solar forecast", slog.Any("error", err))
+			// Continue with the historical solar average
+		}
+	}
+
+	// 6c. Get recent actions so the controller knows what mode we're in
+	recentActions, err := s.storage.GetActionHistory(ctx, time.Now().Add(-recentActionsLookback), time.Now())
+	if err != nil {
+		slog.WarnContext(ctx, "failed to get recent actions", slog.Any("error", err))
 	}
 
 	slog.DebugContext(ctx, "update: starting decision")
 
-	// 7. Decide Action
-	decision, err := s.controller.Decide(ctx, status, currentPrice, futurePrices, energyHistory, settings)
+	// 6d. Check if the status or price are too old to trust
+	now := time.Now()
+	degraded = append(degraded, controller.StaleInputs(status, currentPrice, settings, now)...)
+	if len(degraded) > 0 {
+		slog.WarnContext(ctx, "update: degraded inputs", slog.Any("degraded", degraded))
+	}
+
+	// 7. Decide Action, unless a manual override is active or the inputs are
+	// degraded
+	override, err := s.storage.GetOverride(ctx)
 	if err != nil {
-		slog.ErrorContext(ctx, "controller decision failed", slog.Any("error", err))
-		http.Error(w, "controller error", http.StatusInternalServerError)
-		return
+		slog.WarnContext(ctx, "failed to get override", slog.Any("error", err))
+	}
+	if !override.Expires.IsZero() && !override.Active(now) {
+		slog.InfoContext(ctx, "manual override expired", slog.Time("expires", override.Expires))
+		if err := s.storage.ClearOverride(ctx); err != nil {
+			slog.ErrorContext(ctx, "failed to clear expired override", slog.Any("error", err))
+		}
+	}
+	var decision controller.Decision
+	if override.Active(now) {
+		decision = controller.Decision{
+			Action:      overrideAction(override, status, currentPrice, now),
+			Explanation: "Manual Override",
+		}
+	} else if len(degraded) > 0 && settings.FailSafeMode != types.FailSafeModeContinue {
+		decision = controller.FailSafe(status, currentPrice, degraded, settings, now)
+		// the ESS discharges down to the min battery SOC so give it the
+		// reserve while we can't trust the inputs, the next update restores it
+		if settings.FailSafeMode != types.FailSafeModeStandby && settings.FailSafeReserve() > settings.MinBatterySOC {
+			reserveSettings := settings
+			reserveSettings.MinBatterySOC = settings.FailSafeReserve()
+			if err := s.essSystem.ApplySettings(ctx, reserveSettings); err != nil {
+				slog.ErrorContext(ctx, "failed to apply fail-safe reserve", slog.Any("error", err))
+			}
+		}
+	} else {
+		strategy := s.strategy
+		if settings.Strategy != "" {
+			if strat, err := controller.NewStrategy(settings.Strategy); err != nil {
+				slog.WarnContext(ctx, "unknown strategy in settings, using default", slog.String("strategy", settings.Strategy))
+			} else {
+				strategy = strat
+			}
+		}
+		decision, err = strategy.Decide(ctx, status, currentPrice, futurePrices, energyHistory, solarForecast, recentActions, settings)
+		if err != nil {
+			slog.ErrorContext(ctx, "controller decision failed", slog.Any("error", err))
+			http.Error(w, "controller error", http.StatusInternalServerError)
+			return
+		}
 	}
 
 	action := decision.Action
+	action.DegradedInputs = degraded
 	// Ensure timestamps match if not set
 	if action.Timestamp.IsZero() {
 		action.Timestamp = time.Now()
@@ -280,6 +411,8 @@ func (s *Server) handleUpdate(w http.ResponseWriter, r *http.Request) {
 		err = s.essSystem.SetModes(ctx, types.BatteryModeChargeAny, types.SolarModeAny) // Force charge
 	case types.BatteryModeLoad:
 		err = s.essSystem.SetModes(ctx, types.BatteryModeLoad, types.SolarModeAny) // Use battery
+	case types.BatteryModeExport:
+		err = s.essSystem.SetModes(ctx, types.BatteryModeExport, types.SolarModeAny) // Sell battery
 	case types.BatteryModeStandby:
 		// "self_consumption" is usually safe for idle too (just don't force charge)
 		err = s.essSystem.SetModes(ctx, types.BatteryModeStandby, types.SolarModeAny)
@@ -297,11 +430,22 @@ func (s *Server) handleUpdate(w http.ResponseWriter, r *http.Request) {
 		slog.ErrorContext(ctx, "failed to insert action", slog.Any("error", err))
 	}
 
+	// 9b. Log the plan behind the action
+	plan := decision.Plan
+	plan.Timestamp = action.Timestamp
+	plan.Action = action
+	if err := s.storage.SetLatestPlan(ctx, plan); err != nil {
+		slog.ErrorContext(ctx, "failed to save plan", slog.Any("error", err))
+	}
+
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(map[string]interface{}{
-		"status": "success",
-		"action": action,
-		"price":  currentPrice,
+		"status":        "success",
+		"action":        action,
+		"price":         currentPrice,
+		"futurePrices":  futurePrices,
+		"solarForecast": solarForecast,
+		"degraded":      degraded,
 	}); err != nil {
 		panic(http.ErrAbortHandler)
 	}
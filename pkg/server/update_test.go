@@ -11,7 +11,9 @@ import (
 
 	"github.com/jameshartig/autoenergy/pkg/controller"
 	"github.com/jameshartig/autoenergy/pkg/types"
+	"github.com/jameshartig/autoenergy/pkg/utility"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"google.golang.org/api/idtoken"
 )
 
@@ -32,7 +34,7 @@ func TestHandleUpdate(t *testing.T) {
 		essSystem:       &mockESS{},
 		storage:         mockS,
 		listenAddr:      ":8080",
-		controller:      controller.NewController(),
+		strategy:        controller.NewController(),
 		bypassAuth:      true,
 	}
 
@@ -56,7 +58,7 @@ func TestHandleUpdate(t *testing.T) {
 				utilityProvider:        mockU,
 				essSystem:              &mockESS{},
 				storage:                mockS,
-				controller:             controller.NewController(),
+				strategy:               controller.NewController(),
 				updateSpecificAudience: audience,
 				oidcAudience:           audience,
 				updateSpecificEmail:    email,
@@ -160,6 +162,207 @@ func TestHandleUpdate(t *testing.T) {
 		})
 	})
 
+	t.Run("Stores Plan", func(t *testing.T) {
+		mockS := &RecordingMockStorage{
+			mockStorage: mockStorage{settings: types.Settings{DryRun: true, MinBatterySOC: 20}},
+		}
+		essRec := &RecordingMockESS{
+			status: types.SystemStatus{
+				BatterySOC:         50,
+				BatteryCapacityKWH: 10,
+				MaxBatteryChargeKW: 5,
+			},
+		}
+
+		srv := &Server{
+			utilityProvider: &mockUtility{price: types.Price{DollarsPerKWH: 0.10, TSStart: time.Now()}},
+			essSystem:       essRec,
+			storage:         mockS,
+			listenAddr:      ":8080",
+			strategy:        controller.NewController(),
+			bypassAuth:      true,
+		}
+
+		req := httptest.NewRequest("GET", "/api/update", nil)
+		w := httptest.NewRecorder()
+
+		srv.handleUpdate(w, req)
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+		require.NotNil(t, mockS.insertedAction)
+		require.NotNil(t, mockS.insertedPlan)
+		assert.Equal(t, mockS.insertedAction.Timestamp, mockS.insertedPlan.Timestamp)
+		assert.Equal(t, *mockS.insertedAction, mockS.insertedPlan.Action)
+		require.NotEmpty(t, mockS.insertedPlan.Steps)
+		assert.InDelta(t, 50.0, mockS.insertedPlan.Steps[0].StartSOC, 0.001)
+		assert.NotEmpty(t, mockS.insertedPlan.Steps[0].Reason)
+	})
+
+	t.Run("Manual Override", func(t *testing.T) {
+		mockS := &RecordingMockStorage{
+			mockStorage: mockStorage{
+				settings: types.Settings{MinBatterySOC: 20},
+				override: types.Override{
+					BatteryMode: types.BatteryModeChargeAny,
+					TargetSOC:   100,
+					Expires:     time.Now().Add(2 * time.Hour),
+					Reason:      "storm",
+				},
+			},
+		}
+		essRec := &RecordingMockESS{
+			status: types.SystemStatus{
+				BatterySOC:         50,
+				BatteryCapacityKWH: 10,
+				MaxBatteryChargeKW: 5,
+			},
+		}
+
+		srv := &Server{
+			utilityProvider: &mockUtility{price: types.Price{DollarsPerKWH: 0.50, TSStart: time.Now()}},
+			essSystem:       essRec,
+			storage:         mockS,
+			listenAddr:      ":8080",
+			strategy:        controller.NewController(),
+			bypassAuth:      true,
+		}
+
+		req := httptest.NewRequest("GET", "/api/update", nil)
+		w := httptest.NewRecorder()
+
+		srv.handleUpdate(w, req)
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+		// charge even though power is expensive
+		assert.Equal(t, types.BatteryModeChargeAny, essRec.setBatMode)
+		require.NotNil(t, mockS.insertedAction)
+		assert.Equal(t, types.BatteryModeChargeAny, mockS.insertedAction.BatteryMode)
+		require.NotNil(t, mockS.insertedAction.Override)
+		assert.Equal(t, 100.0, mockS.insertedAction.Override.TargetSOC)
+		assert.Contains(t, mockS.insertedAction.Description, "Manual override")
+		assert.Contains(t, mockS.insertedAction.Description, "storm")
+
+		// hold once the target is reached
+		essRec.status.BatterySOC = 100
+		w = httptest.NewRecorder()
+		srv.handleUpdate(w, req)
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+		assert.Equal(t, types.BatteryModeStandby, essRec.setBatMode)
+		assert.Contains(t, mockS.insertedAction.Description, "reached 100% target")
+
+		// expired overrides are dropped and the controller decides again
+		mockS.override.Expires = time.Now().Add(-time.Minute)
+		w = httptest.NewRecorder()
+		srv.handleUpdate(w, req)
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+		assert.Nil(t, mockS.insertedAction.Override)
+		assert.True(t, mockS.override.Expires.IsZero())
+	})
+
+	t.Run("Stale Price -> Fail-Safe", func(t *testing.T) {
+		mockS := &RecordingMockStorage{
+			mockStorage: mockStorage{
+				settings: types.Settings{MinBatterySOC: 20, FailSafeReserveSOC: 40, AlwaysChargeUnderDollarsPerKWH: 0.05},
+				override: types.Override{BatteryMode: types.BatteryModeChargeAny, Expires: time.Now().Add(-time.Minute)},
+			},
+		}
+		essRec := &RecordingMockESS{
+			status: types.SystemStatus{
+				Timestamp:          time.Now(),
+				BatterySOC:         50,
+				BatteryCapacityKWH: 10,
+				MaxBatteryChargeKW: 5,
+			},
+		}
+		srv := &Server{
+			utilityProvider: &mockUtility{price: types.Price{DollarsPerKWH: 0.01, TSStart: time.Now().Add(-3 * time.Hour)}},
+			essSystem:       essRec,
+			storage:         mockS,
+			listenAddr:      ":8080",
+			strategy:        controller.NewController(),
+			bypassAuth:      true,
+		}
+
+		req := httptest.NewRequest("GET", "/api/update", nil)
+		w := httptest.NewRecorder()
+		srv.handleUpdate(w, req)
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+		var resp struct {
+			Degraded []types.DegradedInput `json:"degraded"`
+		}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		assert.Equal(t, []types.DegradedInput{types.DegradedInputCurrentPrice}, resp.Degraded)
+
+		// don't trust the old price and use the battery down to the reserve
+		assert.Equal(t, types.BatteryModeLoad, essRec.setBatMode)
+		assert.Equal(t, 40.0, essRec.settings.MinBatterySOC)
+		require.NotNil(t, mockS.insertedAction)
+		assert.Equal(t, resp.Degraded, mockS.insertedAction.DegradedInputs)
+		assert.Contains(t, mockS.insertedAction.Description, "Fail-Safe")
+		// the expired override is cleared even though we failed safe
+		assert.True(t, mockS.override.Expires.IsZero())
+
+		// continue ignores the stale price but still records it
+		mockS.settings.FailSafeMode = types.FailSafeModeContinue
+		w = httptest.NewRecorder()
+		srv.handleUpdate(w, req)
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+		assert.NotContains(t, mockS.insertedAction.Description, "Fail-Safe")
+		assert.Equal(t, resp.Degraded, mockS.insertedAction.DegradedInputs)
+		// the min battery SOC is back once we stop failing safe
+		assert.Equal(t, 20.0, essRec.settings.MinBatterySOC)
+	})
+
+	t.Run("Forecast Covers Future Prices", func(t *testing.T) {
+		mockS := &RecordingMockStorage{
+			mockStorage: mockStorage{settings: types.Settings{MinBatterySOC: 20, FailSafeMode: types.FailSafeModeStandby}},
+		}
+		essRec := &RecordingMockESS{
+			status: types.SystemStatus{
+				Timestamp:          time.Now(),
+				BatterySOC:         50,
+				BatteryCapacityKWH: 10,
+				MaxBatteryChargeKW: 5,
+			},
+		}
+		mockU := &mockUtility{
+			price:     types.Price{DollarsPerKWH: 0.10, TSStart: time.Now()},
+			futureErr: fmt.Errorf("day-ahead prices unavailable"),
+		}
+		var history []types.Price
+		start := time.Now().Truncate(time.Hour).Add(-72 * time.Hour)
+		for i := 0; i < 72; i++ {
+			ts := start.Add(time.Duration(i) * time.Hour)
+			history = append(history, types.Price{TSStart: ts, TSEnd: ts.Add(time.Hour), DollarsPerKWH: 0.10})
+		}
+		srv := &Server{
+			utilityProvider: mockU,
+			essSystem:       essRec,
+			storage:         mockS,
+			priceForecaster: utility.NewPriceForecaster(&hindsightMockStorage{prices: history}, 72*time.Hour),
+			listenAddr:      ":8080",
+			strategy:        controller.NewController(),
+			bypassAuth:      true,
+		}
+
+		req := httptest.NewRequest("GET", "/api/update", nil)
+		w := httptest.NewRecorder()
+		srv.handleUpdate(w, req)
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+		require.NotNil(t, mockS.insertedAction)
+		assert.Empty(t, mockS.insertedAction.DegradedInputs)
+		assert.NotContains(t, mockS.insertedAction.Description, "Fail-Safe")
+
+		// without a forecast there are no future prices to plan with
+		srv.priceForecaster = nil
+		w = httptest.NewRecorder()
+		srv.handleUpdate(w, req)
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+		assert.Equal(t, []types.DegradedInput{types.DegradedInputFuturePrices}, mockS.insertedAction.DegradedInputs)
+		assert.Contains(t, mockS.insertedAction.Description, "Fail-Safe")
+	})
+
 	t.Run("Paused Updates", func(t *testing.T) {
 		mockS := &mockStorage{
 			settings: types.Settings{
@@ -182,7 +385,7 @@ func TestHandleUpdate(t *testing.T) {
 			essSystem:       essRec,
 			storage:         mockS,
 			listenAddr:      ":8080",
-			controller:      controller.NewController(),
+			strategy:        controller.NewController(),
 			bypassAuth:      true,
 		}
 
@@ -208,6 +411,12 @@ type RecordingMockESS struct {
 	setSolMode    types.SolarMode
 	GetStatusFunc func(ctx context.Context) (types.SystemStatus, error)
 	SetModesFunc  func(ctx context.Context, bat types.BatteryMode, sol types.SolarMode) error
+	settings      types.Settings
+}
+
+func (m *RecordingMockESS) ApplySettings(ctx context.Context, settings types.Settings) error {
+	m.settings = settings
+	return nil
 }
 
 func (m *RecordingMockESS) GetStatus(ctx context.Context) (types.SystemStatus, error) {
@@ -230,6 +439,7 @@ func (m *RecordingMockESS) SetModes(ctx context.Context, bat types.BatteryMode,
 type RecordingMockStorage struct {
 	mockStorage
 	insertedAction   *types.Action
+	insertedPlan     *types.Plan
 	InsertActionFunc func(ctx context.Context, action types.Action) error
 }
 
@@ -240,3 +450,8 @@ func (m *RecordingMockStorage) InsertAction(ctx context.Context, action types.Ac
 	m.insertedAction = &action
 	return nil
 }
+
+func (m *RecordingMockStorage) SetLatestPlan(ctx context.Context, plan types.Plan) error {
+	m.insertedPlan = &plan
+	return nil
+}
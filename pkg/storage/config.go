@@ -9,11 +9,12 @@ import (
 
 // Configured sets up the Storage provider based on flags.
 func Configured() Provider {
-	provider := lflag.String("storage-provider", "firestore", "Storage provider to use (available: firestore)")
+	provider := lflag.String("storage-provider", "firestore", "Storage provider to use (available: firestore, file)")
 
 	var p struct{ Provider }
 
 	fs := configuredFirestore()
+	file := configuredFile()
 
 	lflag.Do(func() {
 		switch *provider {
@@ -25,6 +26,14 @@ func Configured() Provider {
 			if err := fs.Init(context.Background()); err != nil {
 				panic(fmt.Sprintf("firestore init failed: %v", err))
 			}
+		case "file":
+			if err := file.Validate(); err != nil {
+				panic(fmt.Sprintf("file storage validation failed: %v", err))
+			}
+			p.Provider = file
+			if err := file.Init(context.Background()); err != nil {
+				panic(fmt.Sprintf("file storage init failed: %v", err))
+			}
 		default:
 			panic(fmt.Sprintf("unknown storage provider: %s", *provider))
 		}
@@ -0,0 +1,260 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+	"github.com/levenlabs/go-lflag"
+)
+
+// FileData is the JSON document read by FileProvider.
+type FileData struct {
+	Settings types.Settings      `json:"settings"`
+	Prices   []types.Price       `json:"prices"`
+	Energy   []types.EnergyStats `json:"energy"`
+	Actions  []types.Action      `json:"actions"`
+}
+
+// FileProvider implements the Provider interface from a JSON fixture file so
+// history can be replayed without Firestore, like in CI. Writes are kept in
+// memory and never saved back to the file.
+type FileProvider struct {
+	path string
+
+	mu       sync.Mutex
+	data     FileData
+	override types.Override
+	plan     types.Plan
+}
+
+// configuredFile sets up the file provider.
+// It registers flags for configuration.
+func configuredFile() *FileProvider {
+	path := lflag.String("storage-file", "", "Path to a JSON file with settings, prices, energy and actions for the file storage provider")
+
+	f := &FileProvider{}
+
+	lflag.Do(func() {
+		f.path = *path
+	})
+
+	return f
+}
+
+// NewFileProvider returns a provider with the data loaded from the JSON file
+// at path.
+func NewFileProvider(path string) (*FileProvider, error) {
+	f := &FileProvider{path: path}
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	if err := f.Init(context.Background()); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Validate checks if the provider is properly configured.
+func (f *FileProvider) Validate() error {
+	if f.path == "" {
+		return fmt.Errorf("storage-file is required")
+	}
+	return nil
+}
+
+// Init loads the data from the file.
+// This must be called before using the provider methods.
+func (f *FileProvider) Init(ctx context.Context) error {
+	b, err := os.ReadFile(f.path)
+	if err != nil {
+		return fmt.Errorf("failed to read storage file: %w", err)
+	}
+	var data FileData
+	if err := json.Unmarshal(b, &data); err != nil {
+		return fmt.Errorf("failed to parse storage file: %w", err)
+	}
+	sort.Slice(data.Prices, func(i, j int) bool {
+		return data.Prices[i].TSStart.Before(data.Prices[j].TSStart)
+	})
+	sort.Slice(data.Energy, func(i, j int) bool {
+		return data.Energy[i].TSHourStart.Before(data.Energy[j].TSHourStart)
+	})
+	sort.Slice(data.Actions, func(i, j int) bool {
+		return data.Actions[i].Timestamp.Before(data.Actions[j].Timestamp)
+	})
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.data = data
+	return nil
+}
+
+// Close does nothing since the file isn't kept open.
+func (f *FileProvider) Close() error {
+	return nil
+}
+
+// GetSettings returns the settings from the file.
+func (f *FileProvider) GetSettings(ctx context.Context) (types.Settings, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.data.Settings, nil
+}
+
+// SetSettings replaces the settings in memory.
+func (f *FileProvider) SetSettings(ctx context.Context, settings types.Settings) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.data.Settings = settings
+	return nil
+}
+
+// GetOverride returns the override set in memory.
+func (f *FileProvider) GetOverride(ctx context.Context) (types.Override, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.override, nil
+}
+
+// SetOverride replaces the override in memory.
+func (f *FileProvider) SetOverride(ctx context.Context, override types.Override) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.override = override
+	return nil
+}
+
+// ClearOverride removes the override from memory.
+func (f *FileProvider) ClearOverride(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.override = types.Override{}
+	return nil
+}
+
+// UpsertPrice adds or replaces the price with the same TSStart in memory.
+func (f *FileProvider) UpsertPrice(ctx context.Context, price types.Price) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i := sort.Search(len(f.data.Prices), func(i int) bool {
+		return !f.data.Prices[i].TSStart.Before(price.TSStart)
+	})
+	if i < len(f.data.Prices) && f.data.Prices[i].TSStart.Equal(price.TSStart) {
+		f.data.Prices[i] = price
+		return nil
+	}
+	f.data.Prices = append(f.data.Prices[:i], append([]types.Price{price}, f.data.Prices[i:]...)...)
+	return nil
+}
+
+// InsertAction adds the action in memory.
+func (f *FileProvider) InsertAction(ctx context.Context, action types.Action) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i := sort.Search(len(f.data.Actions), func(i int) bool {
+		return action.Timestamp.Before(f.data.Actions[i].Timestamp)
+	})
+	f.data.Actions = append(f.data.Actions[:i], append([]types.Action{action}, f.data.Actions[i:]...)...)
+	return nil
+}
+
+// SetLatestPlan replaces the plan in memory.
+func (f *FileProvider) SetLatestPlan(ctx context.Context, plan types.Plan) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.plan = plan
+	return nil
+}
+
+// UpsertEnergyHistory adds or replaces the stats for the same hour in memory.
+func (f *FileProvider) UpsertEnergyHistory(ctx context.Context, stats types.EnergyStats) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i := sort.Search(len(f.data.Energy), func(i int) bool {
+		return !f.data.Energy[i].TSHourStart.Before(stats.TSHourStart)
+	})
+	if i < len(f.data.Energy) && f.data.Energy[i].TSHourStart.Equal(stats.TSHourStart) {
+		f.data.Energy[i] = stats
+		return nil
+	}
+	f.data.Energy = append(f.data.Energy[:i], append([]types.EnergyStats{stats}, f.data.Energy[i:]...)...)
+	return nil
+}
+
+// GetPriceHistory returns the prices starting within the time range.
+func (f *FileProvider) GetPriceHistory(ctx context.Context, start, end time.Time) ([]types.Price, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var prices []types.Price
+	for _, p := range f.data.Prices {
+		if !p.TSStart.Before(start) && p.TSStart.Before(end) {
+			prices = append(prices, p)
+		}
+	}
+	return prices, nil
+}
+
+// GetActionHistory returns the actions within the time range.
+func (f *FileProvider) GetActionHistory(ctx context.Context, start, end time.Time) ([]types.Action, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var actions []types.Action
+	for _, a := range f.data.Actions {
+		if !a.Timestamp.Before(start) && a.Timestamp.Before(end) {
+			actions = append(actions, a)
+		}
+	}
+	return actions, nil
+}
+
+// GetEnergyHistory returns the hourly stats within the time range, which is
+// truncated to the hour.
+func (f *FileProvider) GetEnergyHistory(ctx context.Context, start, end time.Time) ([]types.EnergyStats, error) {
+	start = start.Truncate(time.Hour)
+	end = end.Truncate(time.Hour)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var stats []types.EnergyStats
+	for _, s := range f.data.Energy {
+		if !s.TSHourStart.Before(start) && s.TSHourStart.Before(end) {
+			stats = append(stats, s)
+		}
+	}
+	return stats, nil
+}
+
+// GetLatestEnergyHistoryTime returns the start of the latest hour of stats or
+// zero if there are none.
+func (f *FileProvider) GetLatestEnergyHistoryTime(ctx context.Context) (time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.data.Energy) == 0 {
+		return time.Time{}, nil
+	}
+	return f.data.Energy[len(f.data.Energy)-1].TSHourStart, nil
+}
+
+// GetLatestPriceHistoryTime returns the start of the latest price or zero if
+// there are none.
+func (f *FileProvider) GetLatestPriceHistoryTime(ctx context.Context) (time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.data.Prices) == 0 {
+		return time.Time{}, nil
+	}
+	return f.data.Prices[len(f.data.Prices)-1].TSStart, nil
+}
+
+// GetLatestPlan returns the plan set in memory.
+func (f *FileProvider) GetLatestPlan(ctx context.Context) (types.Plan, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.plan, nil
+}
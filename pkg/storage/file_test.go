@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileProvider(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "fixture.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+		"settings": {"minBatterySOC": 20},
+		"prices": [
+			{"tsStart": "2026-09-01T01:00:00Z", "dollarsPerKWH": 0.2},
+			{"tsStart": "2026-09-01T00:00:00Z", "dollarsPerKWH": 0.1}
+		],
+		"energy": [{"tsHourStart": "2026-09-01T00:00:00Z", "homeKWH": 1}],
+		"actions": [{"timestamp": "2026-09-01T00:05:00Z", "description": "Standby."}]
+	}`), 0o600))
+
+	f, err := NewFileProvider(path)
+	require.NoError(t, err)
+
+	settings, err := f.GetSettings(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 20.0, settings.MinBatterySOC)
+
+	start := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	prices, err := f.GetPriceHistory(ctx, start, start.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, prices, 1)
+	assert.Equal(t, 0.1, prices[0].DollarsPerKWH)
+
+	latest, err := f.GetLatestPriceHistoryTime(ctx)
+	require.NoError(t, err)
+	assert.True(t, latest.Equal(start.Add(time.Hour)))
+
+	// the range is truncated to the hour
+	energy, err := f.GetEnergyHistory(ctx, start.Add(30*time.Minute), start.Add(90*time.Minute))
+	require.NoError(t, err)
+	assert.Len(t, energy, 1)
+
+	actions, err := f.GetActionHistory(ctx, start, start.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Len(t, actions, 1)
+
+	// writes replace the same hour in memory
+	require.NoError(t, f.UpsertEnergyHistory(ctx, types.EnergyStats{TSHourStart: start, HomeKWH: 2}))
+	require.NoError(t, f.UpsertEnergyHistory(ctx, types.EnergyStats{TSHourStart: start.Add(time.Hour), HomeKWH: 3}))
+	energy, err = f.GetEnergyHistory(ctx, start, start.Add(2*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, energy, 2)
+	assert.Equal(t, 2.0, energy[0].HomeKWH)
+	assert.Equal(t, 3.0, energy[1].HomeKWH)
+
+	_, err = NewFileProvider(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
@@ -123,6 +123,58 @@ func (f *FirestoreProvider) SetSettings(ctx context.Context, settings types.Sett
 	return nil
 }
 
+// GetOverride retrieves the manual override from the "config/override" document.
+func (f *FirestoreProvider) GetOverride(ctx context.Context) (types.Override, error) {
+	doc, err := f.client.Collection("config").Doc("override").Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return types.Override{}, nil
+		}
+		return types.Override{}, fmt.Errorf("failed to fetch override doc: %w", err)
+	}
+
+	val, err := doc.DataAt("json")
+	if err != nil {
+		return types.Override{}, fmt.Errorf("override document missing 'json' field: %w", err)
+	}
+
+	jsonStr, ok := val.(string)
+	if !ok {
+		return types.Override{}, fmt.Errorf("override 'json' field is not a string")
+	}
+
+	var o types.Override
+	if err := json.Unmarshal([]byte(jsonStr), &o); err != nil {
+		return types.Override{}, fmt.Errorf("failed to unmarshal override json: %w", err)
+	}
+	return o, nil
+}
+
+// SetOverride saves the manual override to the "config/override" document.
+func (f *FirestoreProvider) SetOverride(ctx context.Context, override types.Override) error {
+	jsonBytes, err := json.Marshal(override)
+	if err != nil {
+		return fmt.Errorf("failed to marshal override: %w", err)
+	}
+
+	_, err = f.client.Collection("config").Doc("override").Set(ctx, map[string]interface{}{
+		"json": string(jsonBytes),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save override: %w", err)
+	}
+	return nil
+}
+
+// ClearOverride deletes the "config/override" document.
+func (f *FirestoreProvider) ClearOverride(ctx context.Context) error {
+	_, err := f.client.Collection("config").Doc("override").Delete(ctx)
+	if err != nil && status.Code(err) != codes.NotFound {
+		return fmt.Errorf("failed to clear override: %w", err)
+	}
+	return nil
+}
+
 // UpsertPrice adds or updates a price record in the "utility_prices" collection.
 // The document ID is the RFC3339 timestamp of TSStart for efficient range queries.
 func (f *FirestoreProvider) UpsertPrice(ctx context.Context, price types.Price) error {
@@ -162,6 +214,24 @@ func (f *FirestoreProvider) InsertAction(ctx context.Context, action types.Actio
 	return nil
 }
 
+// SetLatestPlan overwrites the "config/plan" document with the plan as a JSON
+// blob. Only the latest plan is kept since a plan every update adds up fast.
+func (f *FirestoreProvider) SetLatestPlan(ctx context.Context, plan types.Plan) error {
+	jsonBytes, err := json.Marshal(plan)
+	if err != nil {
+		return fmt.Errorf("failed to marshal plan: %w", err)
+	}
+
+	_, err = f.client.Collection("config").Doc("plan").Set(ctx, map[string]interface{}{
+		"json":      string(jsonBytes),
+		"timestamp": plan.Timestamp,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save plan: %w", err)
+	}
+	return nil
+}
+
 // GetPriceHistory retrieves price records within the specified time range.
 // Uses document ID range queries for efficient filtering.
 func (f *FirestoreProvider) GetPriceHistory(ctx context.Context, start, end time.Time) ([]types.Price, error) {
@@ -358,3 +428,30 @@ func (f *FirestoreProvider) GetLatestPriceHistoryTime(ctx context.Context) (time
 	}
 	return ts, nil
 }
+
+// GetLatestPlan retrieves the plan from the "config/plan" document.
+func (f *FirestoreProvider) GetLatestPlan(ctx context.Context) (types.Plan, error) {
+	doc, err := f.client.Collection("config").Doc("plan").Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return types.Plan{}, nil
+		}
+		return types.Plan{}, fmt.Errorf("failed to fetch plan doc: %w", err)
+	}
+
+	val, err := doc.DataAt("json")
+	if err != nil {
+		return types.Plan{}, fmt.Errorf("plan document missing 'json' field: %w", err)
+	}
+
+	jsonStr, ok := val.(string)
+	if !ok {
+		return types.Plan{}, fmt.Errorf("plan 'json' field is not a string")
+	}
+
+	var plan types.Plan
+	if err := json.Unmarshal([]byte(jsonStr), &plan); err != nil {
+		return types.Plan{}, fmt.Errorf("failed to unmarshal plan json: %w", err)
+	}
+	return plan, nil
+}
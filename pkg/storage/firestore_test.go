@@ -50,10 +50,33 @@ func TestFirestoreProvider(t *testing.T) {
 		assert.Equal(t, settings.DryRun, gotSettings.DryRun)
 	})
 
+	t.Run("Override", func(t *testing.T) {
+		expires := time.Now().Add(time.Hour).Truncate(time.Second).UTC()
+		require.NoError(t, f.SetOverride(ctx, types.Override{
+			BatteryMode: types.BatteryModeChargeAny,
+			TargetSOC:   100,
+			Expires:     expires,
+		}))
+
+		o, err := f.GetOverride(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, types.BatteryModeChargeAny, o.BatteryMode)
+		assert.Equal(t, 100.0, o.TargetSOC)
+		assert.True(t, expires.Equal(o.Expires))
+
+		require.NoError(t, f.ClearOverride(ctx))
+		o, err = f.GetOverride(ctx)
+		require.NoError(t, err)
+		assert.True(t, o.Expires.IsZero())
+		// clearing twice is fine
+		require.NoError(t, f.ClearOverride(ctx))
+	})
+
 	t.Run("Prices", func(t *testing.T) {
 		now := time.Now().Truncate(time.Second).UTC() // Firestore timestamp precision (RFC3339 is seconds)
 		p1 := types.Price{TSStart: now.Add(-1 * time.Hour), DollarsPerKWH: 0.10}
-		p2 := types.Price{TSStart: now, DollarsPerKWH: 0.12}
+		exportPrice := 0.03
+		p2 := types.Price{TSStart: now, DollarsPerKWH: 0.12, ExportDollarsPerKWH: &exportPrice}
 
 		require.NoError(t, f.UpsertPrice(ctx, p1))
 		require.NoError(t, f.UpsertPrice(ctx, p2))
@@ -68,9 +91,13 @@ func TestFirestoreProvider(t *testing.T) {
 		for _, p := range prices {
 			if p.DollarsPerKWH == 0.10 && p.TSStart.Equal(p1.TSStart) {
 				foundP1 = true
+				assert.Nil(t, p.ExportDollarsPerKWH)
 			}
 			if p.DollarsPerKWH == 0.12 && p.TSStart.Equal(p2.TSStart) {
 				foundP2 = true
+				if assert.NotNil(t, p.ExportDollarsPerKWH) {
+					assert.Equal(t, 0.03, *p.ExportDollarsPerKWH)
+				}
 			}
 		}
 		assert.True(t, foundP1, "did not find inserted p1")
@@ -211,4 +238,30 @@ func TestFirestoreProvider(t *testing.T) {
 			assert.Equal(t, future, latestTime, "latest time should match the future timestamp we just inserted")
 		})
 	})
+
+	t.Run("Plans", func(t *testing.T) {
+		now := time.Now().Truncate(time.Second).UTC()
+		older := types.Plan{
+			Timestamp: now.Add(-time.Hour),
+			Action:    types.Action{Timestamp: now.Add(-time.Hour), Description: "Older plan"},
+		}
+		latest := types.Plan{
+			Timestamp: now,
+			Action:    types.Action{Timestamp: now, BatteryMode: types.BatteryModeStandby, Description: "Latest plan"},
+			Steps: []types.PlanStep{
+				{TSStart: now, TSEnd: now.Add(time.Hour), BatteryMode: types.BatteryModeStandby, StartSOC: 40, EndSOC: 40},
+			},
+			Cost: 1.23,
+		}
+		// only the latest plan is kept
+		require.NoError(t, f.SetLatestPlan(ctx, older))
+		require.NoError(t, f.SetLatestPlan(ctx, latest))
+
+		plan, err := f.GetLatestPlan(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "Latest plan", plan.Action.Description)
+		require.Len(t, plan.Steps, 1)
+		assert.Equal(t, 40.0, plan.Steps[0].StartSOC)
+		assert.Equal(t, 1.23, plan.Cost)
+	})
 }
@@ -13,10 +13,19 @@ type Provider interface {
 	GetSettings(ctx context.Context) (types.Settings, error)
 	SetSettings(ctx context.Context, settings types.Settings) error
 
+	// Override
+	// GetOverride returns the manual override or an empty override if there
+	// is none.
+	GetOverride(ctx context.Context) (types.Override, error)
+	SetOverride(ctx context.Context, override types.Override) error
+	ClearOverride(ctx context.Context) error
+
 	// Data Persistence
 	// UpsertPrice adds or updates a price record.
 	UpsertPrice(ctx context.Context, price types.Price) error
 	InsertAction(ctx context.Context, action types.Action) error
+	// SetLatestPlan replaces the latest plan with the plan behind an action.
+	SetLatestPlan(ctx context.Context, plan types.Plan) error
 	UpsertEnergyHistory(ctx context.Context, stats types.EnergyStats) error
 
 	// History
@@ -25,6 +34,9 @@ type Provider interface {
 	GetEnergyHistory(ctx context.Context, start, end time.Time) ([]types.EnergyStats, error)
 	GetLatestEnergyHistoryTime(ctx context.Context) (time.Time, error)
 	GetLatestPriceHistoryTime(ctx context.Context) (time.Time, error)
+	// GetLatestPlan returns the latest plan or an empty plan if there isn't
+	// one.
+	GetLatestPlan(ctx context.Context) (types.Plan, error)
 
 	// Lifecycle
 	Close() error
@@ -1,12 +1,49 @@
 package types
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 // Price represents the cost of electricity in a time interval.
 type Price struct {
 	TSStart       time.Time `json:"tsStart"`
 	TSEnd         time.Time `json:"tsEnd"`
 	DollarsPerKWH float64   `json:"dollarsPerKWH"`
+	// ExportDollarsPerKWH is what the utility credits for exporting energy. It
+	// is nil if the utility doesn't publish a separate export price.
+	ExportDollarsPerKWH *float64    `json:"exportDollarsPerKWH,omitempty"`
+	Source              PriceSource `json:"source,omitempty"`
+	// GCO2PerKWH is the marginal carbon intensity of grid electricity during
+	// the interval. It is nil if it isn't known.
+	GCO2PerKWH *float64 `json:"gCO2PerKWH,omitempty"`
+	// GridLoadMW is the grid operator's forecasted load during the interval,
+	// like PJM's RTO load for ComEd. It is nil if it isn't known.
+	GridLoadMW *float64 `json:"gridLoadMW,omitempty"`
+}
+
+// CarbonIntensity is the marginal carbon intensity of grid electricity in a
+// time interval.
+type CarbonIntensity struct {
+	TSStart    time.Time `json:"tsStart"`
+	TSEnd      time.Time `json:"tsEnd"`
+	GCO2PerKWH float64   `json:"gCO2PerKWH"`
+}
+
+// PriceSource represents where a future price came from.
+type PriceSource string
+
+const (
+	// PriceSourceDayAhead is a price published by the utility or market.
+	PriceSourceDayAhead PriceSource = "dayAhead"
+	// PriceSourceHistorical is a price forecasted from historical prices.
+	PriceSourceHistorical PriceSource = "historical"
+)
+
+// SolarForecast is the expected solar production for an hour.
+type SolarForecast struct {
+	TSHourStart time.Time `json:"tsHourStart"`
+	KWH         float64   `json:"kwh"`
 }
 
 // ActionType represents the type of action taken by the system.
@@ -27,6 +64,70 @@ type Action struct {
 	CurrentPrice Price        `json:"currentPrice"`
 	SystemStatus SystemStatus `json:"systemStatus"`
 	DryRun       bool         `json:"dryRun,omitempty"`
+	// Override is set if the action came from a manual override instead of
+	// the controller
+	Override *Override `json:"override,omitempty"`
+	// DegradedInputs are the inputs that were missing or stale when deciding
+	DegradedInputs []DegradedInput `json:"degradedInputs,omitempty"`
+}
+
+// DegradedInput names an input to a decision that was missing or stale.
+type DegradedInput string
+
+const (
+	DegradedInputStatus        DegradedInput = "status"
+	DegradedInputCurrentPrice  DegradedInput = "currentPrice"
+	DegradedInputFuturePrices  DegradedInput = "futurePrices"
+	DegradedInputEnergyHistory DegradedInput = "energyHistory"
+)
+
+// Override is a temporary manual battery mode that takes precedence over the
+// controller until it expires.
+type Override struct {
+	BatteryMode BatteryMode `json:"batteryMode"`
+	// TargetSOC (0-100) is when to stop charging or discharging and hold the
+	// battery instead. 0 means no target.
+	TargetSOC float64   `json:"targetSOC,omitempty"`
+	Expires   time.Time `json:"expires"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedBy string    `json:"createdBy,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Active returns true if the override exists and hasn't expired at now.
+func (o Override) Active(now time.Time) bool {
+	return !o.Expires.IsZero() && now.Before(o.Expires)
+}
+
+// Plan is the simulated schedule behind a decision.
+type Plan struct {
+	Timestamp time.Time  `json:"timestamp"`
+	Action    Action     `json:"action"`
+	Steps     []PlanStep `json:"steps"`
+	// Cost is the expected cost of following the plan over the horizon
+	Cost float64 `json:"cost"`
+}
+
+// PlanStep is a single interval of a plan.
+type PlanStep struct {
+	TSStart     time.Time   `json:"tsStart"`
+	TSEnd       time.Time   `json:"tsEnd"`
+	BatteryMode BatteryMode `json:"batteryMode"`
+	// Reason explains why the mode was or wasn't chosen
+	Reason              string  `json:"reason"`
+	DollarsPerKWH       float64 `json:"dollarsPerKWH"`       // Import cost including fees
+	ExportDollarsPerKWH float64 `json:"exportDollarsPerKWH"` // Value of exporting the battery
+	// StoredDollarsPerKWH is what 1kWh left in the battery is worth later
+	StoredDollarsPerKWH float64 `json:"storedDollarsPerKWH"`
+	NetLoadKWH          float64 `json:"netLoadKWH"` // Home load minus solar
+	StartSOC            float64 `json:"startSOC"`   // 0-100
+	EndSOC              float64 `json:"endSOC"`     // 0-100
+	GridImportKWH       float64 `json:"gridImportKWH"`
+	GridExportKWH       float64 `json:"gridExportKWH"`
+	GridChargeKWH       float64 `json:"gridChargeKWH"`
+	BatteryUsedKWH      float64 `json:"batteryUsedKWH"`
+	BatteryExportKWH    float64 `json:"batteryExportKWH"`
+	Cost                float64 `json:"cost"`
 }
 
 // EnergyStats represents aggregated energy statistics for an hourly period.
@@ -69,7 +170,7 @@ type SystemStatus struct {
 	EmergencyMode         bool      `json:"emergencyMode"`
 }
 
-// 0: standby, 1: charge, -1: discharge
+// 0: standby, 1: charge, -1: discharge, -2: discharge to grid
 type BatteryMode int
 
 const (
@@ -78,8 +179,29 @@ const (
 	BatteryModeChargeAny   BatteryMode = 2
 	BatteryModeChargeSolar BatteryMode = 3
 	BatteryModeLoad        BatteryMode = -1
+	BatteryModeExport      BatteryMode = -2
 )
 
+// String returns the name of the mode as shown on the dashboard.
+func (m BatteryMode) String() string {
+	switch m {
+	case BatteryModeNoChange:
+		return "No Change"
+	case BatteryModeStandby:
+		return "Hold Battery"
+	case BatteryModeChargeAny:
+		return "Charge From Solar+Grid"
+	case BatteryModeChargeSolar:
+		return "Charge From Solar"
+	case BatteryModeLoad:
+		return "Use Battery"
+	case BatteryModeExport:
+		return "Export Battery"
+	default:
+		return fmt.Sprintf("BatteryMode(%d)", int(m))
+	}
+}
+
 type SolarMode int
 
 const (
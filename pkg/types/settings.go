@@ -1,5 +1,11 @@
 package types
 
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
 // Settings represents the configuration stored in the database.
 // These are dynamic settings that can be changed without redeploying.
 type Settings struct {
@@ -7,30 +13,517 @@ type Settings struct {
 	// Pause updates
 	Pause bool `json:"pause"`
 
+	// Name of the controller strategy to use. Empty uses the --strategy flag.
+	Strategy string `json:"strategy"`
+	// How far ahead to plan (in hours, 24-48). 0 means 24 hours.
+	PlanningHorizonHours int `json:"planningHorizonHours"`
+	// Minimum time to stay in a battery mode before switching unless it's
+	// needed for safety (in minutes). 0 means there is no minimum.
+	MinModeDwellMinutes int `json:"minModeDwellMinutes"`
+	// How much better (in $/kWh) another mode has to be before switching away
+	// from the current one. It also keeps charging under the always charge
+	// threshold plus this amount once started.
+	ModeHysteresisDollarsPerKWH float64 `json:"modeHysteresisDollarsPerKWH"`
+	// What to do when the status or prices are missing or stale. Empty means
+	// reserve.
+	FailSafeMode FailSafeMode `json:"failSafeMode"`
+	// Battery SOC to keep in the reserve fail-safe mode. It's given to the ESS
+	// as its reserve while failing safe. 0 means the minimum battery SOC.
+	FailSafeReserveSOC float64 `json:"failSafeReserveSOC"`
+	// How old the status or current price can be (in minutes) before it's
+	// stale. 0 means 15 minutes.
+	StaleDataMinutes int `json:"staleDataMinutes"`
+	// IANA timezone of the site that recurring SOC target deadlines and the
+	// load model's days and hours are in. Empty means America/Chicago.
+	Timezone string `json:"timezone"`
+
 	// Power History Settings
-	// What multiple over previous days to ignore when calculating power usage
-	IgnoreHourUsageOverMultiple float64 `json:"ignoreHourUsageOverMultiple"`
+	// Days to model home usage like a weekend (formatted as 2006-01-02)
+	Holidays []string `json:"holidays"`
+	// How many robust standard deviations from the median an hour of home
+	// usage can be before it's ignored, like during a party or a trip. This
+	// replaces the old ignoreHourUsageOverMultiple. 0 means 3.5.
+	LoadOutlierStdDevs float64 `json:"loadOutlierStdDevs"`
 
 	// Price Settings
 	// Always charge when the price is under this amount (in $/kWh)
 	AlwaysChargeUnderDollarsPerKWH float64 `json:"alwaysChargeUnderDollarsPerKWH"`
-	// Additional fees to add to the price when charging (in $/kWh)
+	// Additional fees to add to the supply price of imports (in $/kWh)
 	AdditionalFeesDollarsPerKWH float64 `json:"additionalFeesDollarsPerKWH"`
-	// TODO: add a setting for solar credit value (in $/kWh)
+	// Retail tariff components added to the supply price to get the all-in
+	// import price
+	Tariff Tariff `json:"tariff"`
+	// Time-of-use rates for the tou utility provider when it isn't given a
+	// schedule file
+	TOUSchedule *TOUSchedule `json:"touSchedule"`
+	// How exported energy is credited
+	ExportCreditType ExportCreditType `json:"exportCreditType"`
+	// Credit for exported energy when ExportCreditType is fixed (in $/kWh)
+	ExportCreditDollarsPerKWH float64 `json:"exportCreditDollarsPerKWH"`
+	// Credit for exported energy as a percent of the import price when
+	// ExportCreditType is percent
+	ExportCreditPercent                 float64 `json:"exportCreditPercent"`
 	MinArbitrageDifferenceDollarsPerKWH float64 `json:"minArbitrageDifferenceDollarsPerKWH"`
+	// Cost of emitting 1kg of CO2 (in $/kg) used to trade dollars for carbon
+	// when deciding. 0 ignores emissions.
+	CarbonDollarsPerKG float64 `json:"carbonDollarsPerKG"`
 
 	// The minimum battery SOC should be charged to at all times.
 	MinBatterySOC float64 `json:"minBatterySOC"`
+	// Battery round trip efficiency (in %). 0 means the battery is lossless.
+	BatteryRoundTripEfficiency float64 `json:"batteryRoundTripEfficiency"`
+	// Cost of battery wear for each kWh discharged (in $/kWh)
+	BatteryDegradationDollarsPerKWH float64 `json:"batteryDegradationDollarsPerKWH"`
+	// Maximum full battery cycles per day. 0 means no limit.
+	MaxBatteryCyclesPerDay float64 `json:"maxBatteryCyclesPerDay"`
+	// Battery SOC to reach by recurring or one-off deadlines
+	SOCTargets []SOCTarget `json:"socTargets"`
+
+	// Solar Settings
+	// Location of the solar array (in degrees)
+	SolarLatitude  float64 `json:"solarLatitude"`
+	SolarLongitude float64 `json:"solarLongitude"`
+	// Peak power of the solar array (in kW). 0 disables the clear-sky model.
+	SolarKWP float64 `json:"solarKWP"`
+	// Tilt of the solar array from horizontal (in degrees)
+	SolarTiltDegrees float64 `json:"solarTiltDegrees"`
+	// Compass direction the solar array faces (in degrees, 180 is south)
+	SolarAzimuthDegrees float64 `json:"solarAzimuthDegrees"`
 
 	// Grid Settings
-	// Maximum Grid Use (in kW) (not supported yet)
-	// MaxGridUseKW float64 `json:"maxGridUseKW"`
+	// Maximum Grid Use (in kW). The battery shaves peaks above this and grid
+	// charging is capped to stay under it. 0 means there is no limit.
+	MaxGridUseKW float64 `json:"maxGridUseKW"`
+	// Demand charge for the highest grid use in a billing period (in $/kW)
+	DemandChargeDollarsPerKW float64 `json:"demandChargeDollarsPerKW"`
+	// Capacity charge for each kW of peak load contribution set during PJM's
+	// summer coincident peaks (in $/kW per year). If set, summer weekday
+	// afternoons that meet the load or price threshold are predicted to be
+	// peaks.
+	CapacityChargeDollarsPerKW float64 `json:"capacityChargeDollarsPerKW"`
+	// Predict summer weekday afternoons with a forecasted PJM load at or above
+	// this to be capacity peaks (in MW). 0 disables the load threshold.
+	CapacityPeakLoadMW float64 `json:"capacityPeakLoadMW"`
+	// Predict summer weekday afternoons with a day-ahead price at or above
+	// this to be capacity peaks (in $/kWh). 0 disables the price threshold.
+	CapacityPeakPriceDollarsPerKWH float64 `json:"capacityPeakPriceDollarsPerKWH"`
+	// Days with a capacity peak alert (formatted as 2006-01-02). Their
+	// afternoons are always treated as capacity peaks.
+	CapacityPeakAlerts []string `json:"capacityPeakAlerts"`
 	// Can charge batteries from grid
 	GridChargeBatteries bool `json:"gridChargeBatteries"`
 	// Maximum Grid Export (in kW)
 	//MaxGridExportKW float64 `json:"maxGridExportKW"`
 	// Can export solar to grid
 	GridExportSolar bool `json:"gridExportSolar"`
-	// Can export batteries to grid (not supported yet)
-	//GridExportBatteries bool `json:"gridExportBatteries"`
+	// Can export batteries to grid
+	GridExportBatteries bool `json:"gridExportBatteries"`
+}
+
+// DefaultPlanningHorizon is how far ahead to plan if PlanningHorizonHours is
+// not set.
+const DefaultPlanningHorizon = 24 * time.Hour
+
+// PlanningHorizon returns how far ahead the controller should plan.
+func (s Settings) PlanningHorizon() time.Duration {
+	if s.PlanningHorizonHours <= 0 {
+		return DefaultPlanningHorizon
+	}
+	return time.Duration(s.PlanningHorizonHours) * time.Hour
+}
+
+// SOCTarget is a battery SOC to reach by a deadline, either once or at a time
+// of day on some days of the week.
+type SOCTarget struct {
+	Name string `json:"name,omitempty"`
+	// SOC to reach by the deadline (0-100)
+	SOC float64 `json:"soc"`
+	// Deadline is a one-off deadline. If it's set Time and Days are ignored.
+	Deadline time.Time `json:"deadline,omitempty"`
+	// Time of day of a recurring deadline (formatted as 15:04)
+	Time string `json:"time,omitempty"`
+	// Days of the week the recurring deadline applies to. Empty means every
+	// day.
+	Days []time.Weekday `json:"days,omitempty"`
+}
+
+// Deadlines returns the target's deadlines after start and up to and
+// including end. Recurring deadlines are in loc.
+func (t SOCTarget) Deadlines(start, end time.Time, loc *time.Location) []time.Time {
+	inRange := func(ts time.Time) bool {
+		return ts.After(start) && !ts.After(end)
+	}
+	if !t.Deadline.IsZero() {
+		if inRange(t.Deadline) {
+			return []time.Time{t.Deadline}
+		}
+		return nil
+	}
+
+	tod, err := time.Parse("15:04", t.Time)
+	if err != nil {
+		return nil
+	}
+	var deadlines []time.Time
+	y, m, d := start.In(loc).Date()
+	for day := time.Date(y, m, d, 0, 0, 0, 0, loc); !day.After(end); day = day.AddDate(0, 0, 1) {
+		ts := time.Date(day.Year(), day.Month(), day.Day(), tod.Hour(), tod.Minute(), 0, 0, loc)
+		if !inRange(ts) || !t.on(ts.Weekday()) {
+			continue
+		}
+		deadlines = append(deadlines, ts)
+	}
+	return deadlines
+}
+
+// on returns true if the recurring deadline applies on the day of the week.
+func (t SOCTarget) on(day time.Weekday) bool {
+	if len(t.Days) == 0 {
+		return true
+	}
+	for _, d := range t.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultStaleData is how old the status or current price can be if
+// StaleDataMinutes is not set.
+const DefaultStaleData = 15 * time.Minute
+
+// StaleData returns how old the status or current price can be before it's
+// stale.
+func (s Settings) StaleData() time.Duration {
+	if s.StaleDataMinutes <= 0 {
+		return DefaultStaleData
+	}
+	return time.Duration(s.StaleDataMinutes) * time.Minute
+}
+
+// FailSafeReserve returns the battery SOC to keep in the reserve fail-safe
+// mode.
+func (s Settings) FailSafeReserve() float64 {
+	if s.FailSafeReserveSOC <= 0 {
+		return s.MinBatterySOC
+	}
+	return s.FailSafeReserveSOC
+}
+
+// DefaultLoadOutlierStdDevs is how many robust standard deviations an hour of
+// home usage can be from the median if LoadOutlierStdDevs is not set.
+const DefaultLoadOutlierStdDevs = 3.5
+
+// LoadOutlierDeviations returns how many robust standard deviations an hour of
+// home usage can be from the median before it's ignored.
+func (s Settings) LoadOutlierDeviations() float64 {
+	if s.LoadOutlierStdDevs <= 0 {
+		return DefaultLoadOutlierStdDevs
+	}
+	return s.LoadOutlierStdDevs
+}
+
+// DefaultTimezone is the site's timezone if Timezone is not set.
+const DefaultTimezone = "America/Chicago"
+
+var defaultLocation = func() *time.Location {
+	loc, err := time.LoadLocation(DefaultTimezone)
+	if err != nil {
+		panic(fmt.Errorf("failed to load default timezone: %w", err))
+	}
+	return loc
+}()
+
+// Location returns the site's timezone. The server usually runs in UTC so
+// local times of day must be resolved in this instead. An invalid Timezone
+// falls back to DefaultTimezone.
+func (s Settings) Location() *time.Location {
+	if s.Timezone == "" {
+		return defaultLocation
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return defaultLocation
+	}
+	return loc
+}
+
+// FailSafeMode determines what to do when inputs are missing or stale.
+type FailSafeMode string
+
+const (
+	// FailSafeModeReserve uses the battery for the home down to
+	// FailSafeReserveSOC and then holds it. This is the default.
+	FailSafeModeReserve FailSafeMode = "reserve"
+	// FailSafeModeStandby holds the battery.
+	FailSafeModeStandby FailSafeMode = "standby"
+	// FailSafeModeContinue decides as usual with whatever inputs are left.
+	FailSafeModeContinue FailSafeMode = "continue"
+)
+
+// CarbonCost returns the cost in $/kWh of the carbon emitted by 1kWh of grid
+// electricity during the price's interval.
+func (s Settings) CarbonCost(p Price) float64 {
+	if p.GCO2PerKWH == nil {
+		return 0
+	}
+	return *p.GCO2PerKWH / 1000 * s.CarbonDollarsPerKG
+}
+
+// Tariff is the retail charges on top of the supply price.
+type Tariff struct {
+	// Delivery charge for each kWh imported (in $/kWh)
+	DeliveryDollarsPerKWH float64 `json:"deliveryDollarsPerKWH"`
+	// Transmission charge for each kWh imported (in $/kWh)
+	TransmissionDollarsPerKWH float64 `json:"transmissionDollarsPerKWH"`
+	// Time of day charges for each kWh imported. Every period covering a time
+	// is added.
+	TimeOfDay []TariffPeriod `json:"timeOfDay"`
+	// Taxes as a percent of the per kWh charges
+	TaxPercent float64 `json:"taxPercent"`
+	// Fixed charges each month (in $)
+	MonthlyFixedDollars float64 `json:"monthlyFixedDollars"`
+	// Peak load contribution on the bill (in kW). It's charged at the
+	// capacity charge each year.
+	PeakLoadContributionKW float64 `json:"peakLoadContributionKW"`
+}
+
+// TariffPeriod is a per kWh charge during part of the day on some days.
+type TariffPeriod struct {
+	Name string `json:"name,omitempty"`
+	// Start and end of the period (formatted as 15:04). An end before the
+	// start wraps past midnight.
+	Start string `json:"start"`
+	End   string `json:"end"`
+	// Days of the week the period applies to. Empty means every day.
+	Days []time.Weekday `json:"days,omitempty"`
+	// Months the period applies to. Empty means every month.
+	Months        []time.Month `json:"months,omitempty"`
+	DollarsPerKWH float64      `json:"dollarsPerKWH"`
+}
+
+// Contains returns true if t is within the period. Periods that can't be
+// parsed never contain t.
+func (p TariffPeriod) Contains(t time.Time) bool {
+	start, err := time.Parse("15:04", p.Start)
+	if err != nil {
+		return false
+	}
+	end, err := time.Parse("15:04", p.End)
+	if err != nil {
+		return false
+	}
+	if len(p.Months) > 0 && !slices.Contains(p.Months, t.Month()) {
+		return false
+	}
+	if len(p.Days) > 0 && !slices.Contains(p.Days, t.Weekday()) {
+		return false
+	}
+	tod := t.Hour()*60 + t.Minute()
+	startTOD := start.Hour()*60 + start.Minute()
+	endTOD := end.Hour()*60 + end.Minute()
+	if endTOD <= startTOD {
+		return tod >= startTOD || tod < endTOD
+	}
+	return tod >= startTOD && tod < endTOD
+}
+
+// PerKWH returns the per kWh charges before taxes at t, not including the
+// supply price.
+func (t Tariff) PerKWH(ts time.Time) float64 {
+	charges := t.DeliveryDollarsPerKWH + t.TransmissionDollarsPerKWH
+	for _, p := range t.TimeOfDay {
+		if p.Contains(ts) {
+			charges += p.DollarsPerKWH
+		}
+	}
+	return charges
+}
+
+// MonthlyFixedDollars returns the tariff's fixed charges each month including
+// the capacity charge for the peak load contribution.
+func (s Settings) MonthlyFixedDollars() float64 {
+	return s.Tariff.MonthlyFixedDollars + s.Tariff.PeakLoadContributionKW*s.CapacityChargeDollarsPerKW/12
+}
+
+// ImportPrice returns the all-in $/kWh to import energy during the price's
+// interval. It's the supply price plus AdditionalFeesDollarsPerKWH and the
+// tariff's per kWh charges with taxes. Monthly fixed and capacity charges
+// aren't included.
+func (s Settings) ImportPrice(p Price) float64 {
+	perKWH := p.DollarsPerKWH + s.AdditionalFeesDollarsPerKWH + s.Tariff.PerKWH(p.TSStart)
+	return perKWH * (1 + s.Tariff.TaxPercent/100)
+}
+
+// ExportCreditType determines how energy exported to the grid is credited.
+type ExportCreditType string
+
+const (
+	// ExportCreditTypeUtility uses the utility's export price if it publishes one,
+	// otherwise exports are credited at the import price. This is the default.
+	ExportCreditTypeUtility ExportCreditType = "utility"
+	// ExportCreditTypeFixed credits exports at ExportCreditDollarsPerKWH.
+	ExportCreditTypeFixed ExportCreditType = "fixed"
+	// ExportCreditTypePercent credits exports at ExportCreditPercent of the import
+	// price.
+	ExportCreditTypePercent ExportCreditType = "percent"
+)
+
+// ExportPrice returns the $/kWh credited for exporting energy during the
+// price's interval.
+func (s Settings) ExportPrice(p Price) float64 {
+	switch s.ExportCreditType {
+	case ExportCreditTypeFixed:
+		return s.ExportCreditDollarsPerKWH
+	case ExportCreditTypePercent:
+		return p.DollarsPerKWH * s.ExportCreditPercent / 100
+	}
+	if p.ExportDollarsPerKWH != nil {
+		return *p.ExportDollarsPerKWH
+	}
+	return p.DollarsPerKWH
+}
+
+// TOUSchedule is a fixed time-of-use rate schedule made up of seasons with
+// rates for hour ranges on weekdays and weekends.
+type TOUSchedule struct {
+	// IANA timezone the hours are in
+	Timezone string      `json:"timezone"`
+	Seasons  []TOUSeason `json:"seasons"`
+	// Days priced like weekends (formatted as 2006-01-02)
+	Holidays []string `json:"holidays,omitempty"`
+}
+
+// TOUSeason is the rates between two months, inclusive. A start month after
+// the end month wraps past December.
+type TOUSeason struct {
+	Name       string      `json:"name,omitempty"`
+	StartMonth time.Month  `json:"startMonth"`
+	EndMonth   time.Month  `json:"endMonth"`
+	Periods    []TOUPeriod `json:"periods"`
+}
+
+// TOUDays is which days a TOU period applies to.
+type TOUDays string
+
+const (
+	// TOUDaysAll applies to every day. This is the default.
+	TOUDaysAll TOUDays = "all"
+	// TOUDaysWeekday applies Monday through Friday, except holidays.
+	TOUDaysWeekday TOUDays = "weekday"
+	// TOUDaysWeekend applies on Saturday, Sunday and holidays.
+	TOUDaysWeekend TOUDays = "weekend"
+)
+
+// TOUPeriod is the rate for the hours from StartHour up to EndHour. An end
+// hour at or before the start hour wraps past midnight.
+type TOUPeriod struct {
+	Name          string  `json:"name,omitempty"`
+	Days          TOUDays `json:"days,omitempty"`
+	StartHour     int     `json:"startHour"`
+	EndHour       int     `json:"endHour"`
+	DollarsPerKWH float64 `json:"dollarsPerKWH"`
+	// Credit for exports during the period (in $/kWh). Nil means exports are
+	// credited at the import rate.
+	ExportDollarsPerKWH *float64 `json:"exportDollarsPerKWH,omitempty"`
+}
+
+// Location returns the timezone of the schedule. The server usually runs in
+// UTC so there is no default.
+func (s TOUSchedule) Location() (*time.Location, error) {
+	if s.Timezone == "" {
+		return nil, fmt.Errorf("no timezone")
+	}
+	return time.LoadLocation(s.Timezone)
+}
+
+// Validate returns an error if the schedule can't be used or doesn't have a
+// rate for every hour of weekdays and weekends in every month.
+func (s TOUSchedule) Validate() error {
+	if _, err := s.Location(); err != nil {
+		return fmt.Errorf("invalid timezone: %w", err)
+	}
+	if len(s.Seasons) == 0 {
+		return fmt.Errorf("no seasons")
+	}
+	for _, season := range s.Seasons {
+		if season.StartMonth < time.January || season.StartMonth > time.December ||
+			season.EndMonth < time.January || season.EndMonth > time.December {
+			return fmt.Errorf("invalid months in season %q", season.Name)
+		}
+		for _, period := range season.Periods {
+			switch period.Days {
+			case "", TOUDaysAll, TOUDaysWeekday, TOUDaysWeekend:
+			default:
+				return fmt.Errorf("invalid days in period %q: %s", period.Name, period.Days)
+			}
+			if period.StartHour < 0 || period.StartHour > 23 || period.EndHour < 0 || period.EndHour > 24 {
+				return fmt.Errorf("invalid hours in period %q", period.Name)
+			}
+		}
+	}
+	for _, holiday := range s.Holidays {
+		if _, err := time.Parse(time.DateOnly, holiday); err != nil {
+			return fmt.Errorf("invalid holiday: %s", holiday)
+		}
+	}
+	for month := time.January; month <= time.December; month++ {
+		for _, weekend := range []bool{false, true} {
+			for hour := 0; hour < 24; hour++ {
+				if _, ok := s.rate(month, weekend, hour); ok {
+					continue
+				}
+				days := TOUDaysWeekday
+				if weekend {
+					days = TOUDaysWeekend
+				}
+				return fmt.Errorf("no rate for %s %s hour %d", month, days, hour)
+			}
+		}
+	}
+	return nil
+}
+
+// Rate returns the first period covering t in the first season covering t's
+// month. t should already be in the schedule's timezone.
+func (s TOUSchedule) Rate(t time.Time) (TOUPeriod, bool) {
+	weekend := t.Weekday() == time.Saturday || t.Weekday() == time.Sunday || slices.Contains(s.Holidays, t.Format(time.DateOnly))
+	return s.rate(t.Month(), weekend, t.Hour())
+}
+
+// rate returns the first period covering the hour in the first season covering
+// the month.
+func (s TOUSchedule) rate(month time.Month, weekend bool, hour int) (TOUPeriod, bool) {
+	for _, season := range s.Seasons {
+		if !season.contains(month) {
+			continue
+		}
+		for _, period := range season.Periods {
+			if (period.Days == TOUDaysWeekday && weekend) || (period.Days == TOUDaysWeekend && !weekend) {
+				continue
+			}
+			if period.contains(hour) {
+				return period, true
+			}
+		}
+		return TOUPeriod{}, false
+	}
+	return TOUPeriod{}, false
+}
+
+// contains returns true if the month is in the season.
+func (s TOUSeason) contains(m time.Month) bool {
+	if s.StartMonth <= s.EndMonth {
+		return m >= s.StartMonth && m <= s.EndMonth
+	}
+	return m >= s.StartMonth || m <= s.EndMonth
+}
+
+// contains returns true if the hour is in the period.
+func (p TOUPeriod) contains(hour int) bool {
+	if p.EndHour <= p.StartHour {
+		return hour >= p.StartHour || hour < p.EndHour
+	}
+	return hour >= p.StartHour && hour < p.EndHour
 }
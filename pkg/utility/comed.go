@@ -41,10 +41,14 @@ const pjmComedPNodeID = "33092371"
 // ComEd implements the Provider interface for ComEd (Commonwealth Edison) hourly pricing API.
 // It retrieves real-time and predicted electricity prices.
 type ComEd struct {
-	apiURL    string
-	pjmAPIKey string
-	pjmAPIURL string
-	client    *http.Client
+	apiURL        string
+	pjmAPIKey     string
+	pjmAPIURL     string
+	pjmLoadAPIURL string
+	client        *http.Client
+	// priceInterval is the interval current prices are averaged into. The
+	// default is hourly which matches how ComEd bills.
+	priceInterval time.Duration
 
 	mu            sync.Mutex
 	lastFetchTime time.Time
@@ -60,11 +64,15 @@ func configuredComEd() *ComEd {
 	apiURL := lflag.String("comed-api-url", "https://hourlypricing.comed.com/api", "URL for the ComEd Hourly Pricing API")
 	pjmURL := lflag.String("pjm-api-url", "https://api.pjm.com/api/v1/da_hrl_lmps", "URL for the PJM API")
 	pjmKey := lflag.String("pjm-api-key", "", "API Key for PJM Data Miner 2 (optional)")
+	pjmLoadURL := lflag.String("pjm-load-api-url", "https://api.pjm.com/api/v1/load_frcstd_7_day", "URL for the PJM load forecast API used to predict capacity peaks (empty to disable)")
+	priceInterval := lflag.Duration("comed-price-interval", time.Hour, "Interval to average current prices into (1h matches how ComEd bills, sub-hourly 5m, 15m or 30m is opt-in to act on short spikes)")
 
 	lflag.Do(func() {
 		c.apiURL = *apiURL
 		c.pjmAPIURL = *pjmURL
 		c.pjmAPIKey = *pjmKey
+		c.pjmLoadAPIURL = *pjmLoadURL
+		c.priceInterval = *priceInterval
 	})
 
 	return c
@@ -83,9 +91,30 @@ func (c *ComEd) Validate() error {
 			return fmt.Errorf("failed to parse pjm url (%s): %w", c.pjmAPIURL, err)
 		}
 	}
+	if c.pjmLoadAPIURL != "" {
+		if _, err := url.Parse(c.pjmLoadAPIURL); err != nil {
+			return fmt.Errorf("failed to parse pjm load url (%s): %w", c.pjmLoadAPIURL, err)
+		}
+	}
+	if c.priceInterval != 0 && (c.priceInterval < 5*time.Minute || c.priceInterval%(5*time.Minute) != 0 || time.Hour%c.priceInterval != 0) {
+		return fmt.Errorf("comed-price-interval must be a multiple of 5m that divides an hour: %s", c.priceInterval)
+	}
+	return nil
+}
+
+// ApplySettings does nothing since ComEd prices don't depend on the settings.
+func (c *ComEd) ApplySettings(ctx context.Context, settings types.Settings) error {
 	return nil
 }
 
+// currentInterval returns the interval current prices are averaged into.
+func (c *ComEd) currentInterval() time.Duration {
+	if c.priceInterval <= 0 {
+		return time.Hour
+	}
+	return c.priceInterval
+}
+
 // apiResponse represents the structure of the JSON returned by ComEd.
 type comedPriceEntry struct {
 	MillisUTC string `json:"millisUTC"`
@@ -109,7 +138,7 @@ func (c *ComEd) fetchPrices(ctx context.Context) ([]types.Price, error) {
 	// Fetch enough history to get at least the last few hours complete.
 	// 6 hours back should be plenty to get full hours even with delays.
 	start := now.Add(-6 * time.Hour)
-	prices, err := c.fetchPricesRange(ctx, start, now)
+	prices, err := c.fetchPricesRange(ctx, start, now, c.currentInterval())
 	if err != nil {
 		return nil, err
 	}
@@ -131,7 +160,7 @@ func (c *ComEd) GetConfirmedPrices(ctx context.Context, start, end time.Time) ([
 		slog.Time("start", start),
 		slog.Time("end", end),
 	)
-	prices, err := c.fetchPricesRange(ctx, start, end)
+	prices, err := c.fetchPricesRange(ctx, start, end, time.Hour)
 	if err != nil {
 		return nil, err
 	}
@@ -176,8 +205,8 @@ func (c *ComEd) GetConfirmedPrices(ctx context.Context, start, end time.Time) ([
 }
 
 // fetchPricesRange retrieves prices from the ComEd API for a specific range.
-// useCache determines if we should look at/update the cache.
-func (c *ComEd) fetchPricesRange(ctx context.Context, start, end time.Time) ([]types.Price, error) {
+// The 5-minute prices are averaged into buckets of the given interval.
+func (c *ComEd) fetchPricesRange(ctx context.Context, start, end time.Time, interval time.Duration) ([]types.Price, error) {
 	start = start.In(ctLocation)
 	end = end.In(ctLocation)
 
@@ -224,14 +253,14 @@ func (c *ComEd) fetchPricesRange(ctx context.Context, start, end time.Time) ([]t
 		slog.String("end", end.Format(time.RFC3339)),
 	)
 
-	// Map to group prices by hour
+	// Map to group prices by interval
 	type hourlyData struct {
 		start    time.Time
 		sum      float64
 		count    int
 		lastTime time.Time
 	}
-	hours := make(map[int64]*hourlyData) // Key by unix hour to handle map keys
+	hours := make(map[int64]*hourlyData) // Key by unix interval start to handle map keys
 
 	for _, item := range data {
 		ms, err := strconv.ParseInt(item.MillisUTC, 10, 64)
@@ -246,9 +275,9 @@ func (c *ComEd) fetchPricesRange(ctx context.Context, start, end time.Time) ([]t
 		}
 
 		tsEnd := time.UnixMilli(ms).In(ctLocation)
-		// Truncate to hour start but we subtract 5 minutes because if the price is for
-		// 11:55-12:00, it should be included in the 11:00 hour.
-		hourStart := tsEnd.Add(-5 * time.Minute).Truncate(time.Hour)
+		// Truncate to interval start but we subtract 5 minutes because if the price
+		// is for 11:55-12:00, it should be included in the 11:00 hour.
+		hourStart := tsEnd.Add(-5 * time.Minute).Truncate(interval)
 		key := hourStart.Unix()
 
 		if _, exists := hours[key]; !exists {
@@ -280,8 +309,9 @@ func (c *ComEd) fetchPricesRange(ctx context.Context, start, end time.Time) ([]t
 	return prices, nil
 }
 
-// GetCurrentPrice returns the latest hourly-averaged price.
-// Note: This may be an incomplete average if the current hour is not yet finished.
+// GetCurrentPrice returns the latest price averaged over the configured
+// interval (hourly by default).
+// Note: This may be an incomplete average if the current interval is not yet finished.
 func (c *ComEd) GetCurrentPrice(ctx context.Context) (types.Price, error) {
 	slog.Debug("getting current price")
 
@@ -306,13 +336,30 @@ func (c *ComEd) GetCurrentPrice(ctx context.Context) (types.Price, error) {
 }
 
 // GetFuturePrices returns predicted or day-ahead prices.
-// Prefers PJM API if configured, otherwise returns nothing
+// Prefers PJM API if configured, otherwise returns nothing. The prices include
+// PJM's load forecast if it's available.
 func (c *ComEd) GetFuturePrices(ctx context.Context) ([]types.Price, error) {
-	if c.pjmAPIKey != "" {
-		slog.Debug("fetching pjm day ahead prices for comed")
-		return c.fetchPJMDayAhead(ctx, pjmComedPNodeID)
+	if c.pjmAPIKey == "" {
+		return nil, nil
+	}
+	slog.Debug("fetching pjm day ahead prices for comed")
+	prices, err := c.fetchPJMDayAhead(ctx, pjmComedPNodeID)
+	if err != nil {
+		return nil, err
+	}
+	if c.pjmLoadAPIURL != "" {
+		loads, err := c.fetchPJMLoadForecast(ctx)
+		if err != nil {
+			// the prices are still useful without the load
+			slog.WarnContext(ctx, "failed to get pjm load forecast", slog.Any("error", err))
+		}
+		for i := range prices {
+			if mw, ok := loads[prices[i].TSStart.Unix()]; ok {
+				prices[i].GridLoadMW = &mw
+			}
+		}
 	}
-	return nil, nil
+	return prices, nil
 }
 
 // PJM API Support
@@ -410,3 +457,76 @@ func (c *ComEd) fetchPJMDayAhead(ctx context.Context, pnodeID string) ([]types.P
 	)
 	return prices, nil
 }
+
+type pjmLoadItem struct {
+	EvaluatedAtEPT       string  `json:"evaluated_at_datetime_ept"`
+	ForecastBeginningEPT string  `json:"forecast_datetime_beginning_ept"`
+	ForecastLoadMW       float64 `json:"forecast_load_mw"`
+}
+
+// fetchPJMLoadForecast returns PJM's RTO load forecast for today and tomorrow
+// in MW keyed by the unix start of each hour. Capacity peaks are the hours
+// with the highest RTO load.
+func (c *ComEd) fetchPJMLoadForecast(ctx context.Context) (map[int64]float64, error) {
+	now := time.Now().In(etLocation)
+	today := now.Format("2006-01-02")
+	tomorrow := now.AddDate(0, 0, 1).Format("2006-01-02")
+	dateRange := fmt.Sprintf("%s 00:00 to %s 23:59", today, tomorrow)
+
+	u, err := url.Parse(c.pjmLoadAPIURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse pjm load url (%s): %w", c.pjmLoadAPIURL, err)
+	}
+	q := u.Query()
+	q.Set("forecast_area", "RTO_COMBINED")
+	q.Set("forecast_datetime_beginning_ept", dateRange)
+	q.Set("format", "json")
+	q.Set("fields", "evaluated_at_datetime_ept,forecast_datetime_beginning_ept,forecast_load_mw")
+	q.Set("download", "true")
+	q.Set("startRow", "1")
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Ocp-Apim-Subscription-Key", c.pjmAPIKey)
+	req.Header.Set("Cache-Control", "no-cache")
+	req.Header.Set("Accept", "application/json")
+
+	slog.DebugContext(ctx, "fetching pjm load forecast", slog.String("url", u.String()))
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("pjm load api status: %d", resp.StatusCode)
+	}
+
+	var res []pjmLoadItem
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, err
+	}
+
+	// keep the latest forecast for each hour
+	loads := make(map[int64]float64)
+	evaluated := make(map[int64]string)
+	for _, item := range res {
+		t, err := time.ParseInLocation("2006-01-02T15:04:05", item.ForecastBeginningEPT, etLocation)
+		if err != nil {
+			slog.Warn("failed to parse pjm load time", slog.String("time", item.ForecastBeginningEPT), slog.Any("error", err))
+			continue
+		}
+		key := t.Truncate(time.Hour).Unix()
+		if prev, ok := evaluated[key]; ok && prev > item.EvaluatedAtEPT {
+			continue
+		}
+		evaluated[key] = item.EvaluatedAtEPT
+		loads[key] = item.ForecastLoadMW
+	}
+
+	slog.DebugContext(ctx, "fetched pjm load forecast", slog.Int("count", len(loads)))
+	return loads, nil
+}
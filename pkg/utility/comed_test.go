@@ -47,6 +47,33 @@ func TestComEd(t *testing.T) {
 		assert.Equal(t, expectedTime, price.TSStart)
 	})
 
+	t.Run("GetCurrentPrice_FiveMinute", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Two entries in the same hour: 2.0 and 3.0
+			response := `[
+			{"millisUTC":"1706227500000","price":"2.0"},
+			{"millisUTC":"1706227800000","price":"3.0"}
+		]`
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(response))
+		}))
+		defer ts.Close()
+
+		c := &ComEd{
+			apiURL:        ts.URL,
+			client:        ts.Client(),
+			priceInterval: 5 * time.Minute,
+		}
+
+		price, err := c.GetCurrentPrice(context.Background())
+		require.NoError(t, err)
+
+		// the latest 5-minute price is not averaged with the earlier one
+		assert.Equal(t, 0.03, price.DollarsPerKWH)
+		assert.Equal(t, time.UnixMilli(1706227500000).In(ctLocation), price.TSStart)
+		assert.Equal(t, time.UnixMilli(1706227800000).In(ctLocation), price.TSEnd)
+	})
+
 	t.Run("Caching", func(t *testing.T) {
 		requests := 0
 		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -130,6 +157,51 @@ func TestComEd(t *testing.T) {
 		assert.Equal(t, expectedTime, prices[0].TSEnd)
 	})
 
+	t.Run("GetFuturePrices_PJM_Load", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.URL.Path {
+			case "/api/v1/da_hrl_lmps":
+				_, _ = w.Write([]byte(`[
+					{"datetime_beginning_ept": "2026-07-15T15:00:00", "total_lmp_da": 85.0},
+					{"datetime_beginning_ept": "2026-07-15T16:00:00", "total_lmp_da": 95.0}
+				]`))
+			case "/api/v1/load_frcstd_7_day":
+				assert.Equal(t, "RTO_COMBINED", r.URL.Query().Get("forecast_area"))
+				assert.Equal(t, "test-key", r.Header.Get("Ocp-Apim-Subscription-Key"))
+				// the older evaluation is replaced by the newer one
+				_, _ = w.Write([]byte(`[
+					{"evaluated_at_datetime_ept": "2026-07-15T06:00:00", "forecast_datetime_beginning_ept": "2026-07-15T15:00:00", "forecast_load_mw": 140000},
+					{"evaluated_at_datetime_ept": "2026-07-15T09:00:00", "forecast_datetime_beginning_ept": "2026-07-15T15:00:00", "forecast_load_mw": 148000}
+				]`))
+			default:
+				http.Error(w, "not found", http.StatusNotFound)
+			}
+		}))
+		defer ts.Close()
+
+		c := &ComEd{
+			pjmAPIKey:     "test-key",
+			pjmAPIURL:     ts.URL + "/api/v1/da_hrl_lmps",
+			pjmLoadAPIURL: ts.URL + "/api/v1/load_frcstd_7_day",
+			client:        ts.Client(),
+		}
+
+		prices, err := c.GetFuturePrices(context.Background())
+		require.NoError(t, err)
+		require.Len(t, prices, 2)
+		require.NotNil(t, prices[0].GridLoadMW)
+		assert.Equal(t, 148000.0, *prices[0].GridLoadMW)
+		assert.Nil(t, prices[1].GridLoadMW)
+
+		// prices are still returned without the load forecast
+		c.pjmLoadAPIURL = ts.URL + "/missing"
+		prices, err = c.GetFuturePrices(context.Background())
+		require.NoError(t, err)
+		require.Len(t, prices, 2)
+		assert.Nil(t, prices[0].GridLoadMW)
+	})
+
 	t.Run("Integration_RealAPI", func(t *testing.T) {
 		c := &ComEd{
 			apiURL: "https://hourlypricing.comed.com/api?",
@@ -8,12 +8,13 @@ import (
 
 // Configured sets up the utility provider based on flags.
 func Configured() Provider {
-	provider := lflag.String("utility-provider", "comed", "Utility provider to use (available: comed)")
+	provider := lflag.String("utility-provider", "comed", "Utility provider to use (available: comed, tou)")
 
 	var p struct{ Provider }
 
 	// Configure implementations
 	comed := configuredComEd()
+	tou := configuredTOU()
 
 	lflag.Do(func() {
 		switch *provider {
@@ -22,6 +23,11 @@ func Configured() Provider {
 				panic(fmt.Sprintf("comed validation failed: %v", err))
 			}
 			p.Provider = comed
+		case "tou":
+			if err := tou.Validate(); err != nil {
+				panic(fmt.Sprintf("tou validation failed: %v", err))
+			}
+			p.Provider = tou
 		default:
 			panic(fmt.Sprintf("unknown utility provider: %s", *provider))
 		}
@@ -0,0 +1,165 @@
+package utility
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+)
+
+// minProfileSamples is the number of historical prices needed for an
+// hour-of-day and day type before we trust it over the all-days average.
+const minProfileSamples = 2
+
+// PriceHistory is the subset of storage needed to forecast prices.
+type PriceHistory interface {
+	GetPriceHistory(ctx context.Context, start, end time.Time) ([]types.Price, error)
+}
+
+// PriceForecaster predicts future prices from an hour-of-day and
+// weekday/weekend profile of historical prices. It is used to fill in the
+// hours that the utility doesn't provide day-ahead prices for.
+type PriceForecaster struct {
+	history  PriceHistory
+	lookback time.Duration
+}
+
+// NewPriceForecaster returns a PriceForecaster that builds its profile from the
+// last lookback of price history.
+func NewPriceForecaster(history PriceHistory, lookback time.Duration) *PriceForecaster {
+	return &PriceForecaster{
+		history:  history,
+		lookback: lookback,
+	}
+}
+
+type profileKey struct {
+	weekend bool
+	hour    int
+}
+
+type profileBucket struct {
+	sum         float64
+	count       int
+	exportSum   float64
+	exportCount int
+}
+
+func (b profileBucket) add(p types.Price) profileBucket {
+	b.sum += p.DollarsPerKWH
+	b.count++
+	if p.ExportDollarsPerKWH != nil {
+		b.exportSum += *p.ExportDollarsPerKWH
+		b.exportCount++
+	}
+	return b
+}
+
+func (b profileBucket) avg() float64 {
+	return b.sum / float64(b.count)
+}
+
+// exportAvg returns the average export price, or nil if any of the prices were
+// missing an export price.
+func (b profileBucket) exportAvg() *float64 {
+	if b.exportCount == 0 || b.exportCount != b.count {
+		return nil
+	}
+	avg := b.exportSum / float64(b.exportCount)
+	return &avg
+}
+
+func isWeekend(t time.Time) bool {
+	return t.Weekday() == time.Saturday || t.Weekday() == time.Sunday
+}
+
+// Forecast returns hourly prices from now until now+horizon. Hours covered by
+// dayAhead use those prices and the rest come from the historical profile.
+// Every returned price has its Source set. Hours with no day-ahead price and
+// no history are omitted.
+func (f *PriceForecaster) Forecast(ctx context.Context, now time.Time, dayAhead []types.Price, horizon time.Duration) ([]types.Price, error) {
+	history, err := f.history.GetPriceHistory(ctx, now.Add(-f.lookback), now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get price history: %w", err)
+	}
+
+	// use the utility's timezone for the hour of day if we know it
+	loc := now.Location()
+	if len(history) > 0 {
+		loc = history[len(history)-1].TSStart.Location()
+	}
+
+	byDayType := make(map[profileKey]profileBucket)
+	byHour := make(map[int]profileBucket)
+	for _, p := range history {
+		ts := p.TSStart.In(loc)
+		key := profileKey{weekend: isWeekend(ts), hour: ts.Hour()}
+		byDayType[key] = byDayType[key].add(p)
+		byHour[ts.Hour()] = byHour[ts.Hour()].add(p)
+	}
+
+	var prices []types.Price
+	var dayAheadCount, historicalCount int
+	start := now.In(loc).Truncate(time.Hour)
+	end := now.Add(horizon)
+	for ts := start; ts.Before(end); ts = ts.Add(time.Hour) {
+		var covered bool
+		for _, p := range dayAhead {
+			pEnd := p.TSEnd
+			if !pEnd.After(p.TSStart) {
+				pEnd = p.TSStart.Truncate(time.Hour).Add(time.Hour)
+			}
+			// day-ahead prices can overlap the hour without starting on it
+			if p.TSStart.Before(ts.Add(time.Hour)) && pEnd.After(ts) {
+				covered = true
+				break
+			}
+		}
+		if covered {
+			continue
+		}
+
+		b, ok := byDayType[profileKey{weekend: isWeekend(ts), hour: ts.Hour()}]
+		if !ok || b.count < minProfileSamples {
+			b, ok = byHour[ts.Hour()]
+		}
+		if !ok {
+			continue
+		}
+		prices = append(prices, types.Price{
+			TSStart:             ts,
+			TSEnd:               ts.Add(time.Hour),
+			DollarsPerKWH:       b.avg(),
+			ExportDollarsPerKWH: b.exportAvg(),
+			Source:              types.PriceSourceHistorical,
+		})
+		historicalCount++
+	}
+
+	for _, p := range dayAhead {
+		if p.TSEnd.IsZero() || p.TSEnd.After(now) {
+			if p.Source == "" {
+				p.Source = types.PriceSourceDayAhead
+			}
+			prices = append(prices, p)
+			dayAheadCount++
+		}
+	}
+
+	sort.Slice(prices, func(i, j int) bool {
+		return prices[i].TSStart.Before(prices[j].TSStart)
+	})
+
+	slog.DebugContext(
+		ctx,
+		"forecasted future prices",
+		slog.Int("history", len(history)),
+		slog.Int("dayAhead", dayAheadCount),
+		slog.Int("historical", historicalCount),
+	)
+
+	return prices, nil
+}
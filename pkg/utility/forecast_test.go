@@ -0,0 +1,118 @@
+package utility
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockPriceHistory struct {
+	prices []types.Price
+}
+
+func (m *mockPriceHistory) GetPriceHistory(ctx context.Context, start, end time.Time) ([]types.Price, error) {
+	var prices []types.Price
+	for _, p := range m.prices {
+		if !p.TSStart.Before(start) && p.TSStart.Before(end) {
+			prices = append(prices, p)
+		}
+	}
+	return prices, nil
+}
+
+func TestPriceForecaster(t *testing.T) {
+	// Wednesday at noon
+	now := time.Date(2026, 2, 4, 12, 30, 0, 0, ctLocation)
+
+	// two weeks of history where weekdays cost 0.10 except 5pm costs 0.30
+	// and weekends cost 0.05
+	history := &mockPriceHistory{}
+	for ts := now.Truncate(time.Hour).Add(-14 * 24 * time.Hour); ts.Before(now); ts = ts.Add(time.Hour) {
+		price := 0.10
+		if isWeekend(ts) {
+			price = 0.05
+		} else if ts.Hour() == 17 {
+			price = 0.30
+		}
+		history.prices = append(history.prices, types.Price{
+			TSStart:       ts,
+			TSEnd:         ts.Add(time.Hour),
+			DollarsPerKWH: price,
+		})
+	}
+
+	f := NewPriceForecaster(history, 14*24*time.Hour)
+
+	t.Run("Historical Only", func(t *testing.T) {
+		prices, err := f.Forecast(context.Background(), now, nil, 24*time.Hour)
+		require.NoError(t, err)
+		require.Len(t, prices, 25)
+
+		for _, p := range prices {
+			assert.Equal(t, types.PriceSourceHistorical, p.Source)
+			if p.TSStart.Hour() == 17 {
+				assert.InDelta(t, 0.30, p.DollarsPerKWH, 0.0001)
+			} else {
+				assert.InDelta(t, 0.10, p.DollarsPerKWH, 0.0001)
+			}
+		}
+	})
+
+	t.Run("Weekend Profile", func(t *testing.T) {
+		saturday := time.Date(2026, 2, 7, 0, 0, 0, 0, ctLocation)
+		prices, err := f.Forecast(context.Background(), saturday, nil, 2*time.Hour)
+		require.NoError(t, err)
+		require.NotEmpty(t, prices)
+		for _, p := range prices {
+			assert.InDelta(t, 0.05, p.DollarsPerKWH, 0.0001)
+		}
+	})
+
+	t.Run("Blends Day Ahead", func(t *testing.T) {
+		dayAhead := []types.Price{
+			{TSStart: now.Truncate(time.Hour).Add(time.Hour), TSEnd: now.Truncate(time.Hour).Add(2 * time.Hour), DollarsPerKWH: 0.50},
+		}
+		prices, err := f.Forecast(context.Background(), now, dayAhead, 24*time.Hour)
+		require.NoError(t, err)
+		require.Len(t, prices, 25)
+
+		assert.Equal(t, types.PriceSourceHistorical, prices[0].Source)
+		assert.Equal(t, types.PriceSourceDayAhead, prices[1].Source)
+		assert.Equal(t, 0.50, prices[1].DollarsPerKWH)
+		assert.Equal(t, types.PriceSourceHistorical, prices[2].Source)
+	})
+
+	t.Run("Export Prices", func(t *testing.T) {
+		exportHistory := &mockPriceHistory{}
+		for _, p := range history.prices {
+			exportPrice := p.DollarsPerKWH / 2
+			p.ExportDollarsPerKWH = &exportPrice
+			exportHistory.prices = append(exportHistory.prices, p)
+		}
+		prices, err := NewPriceForecaster(exportHistory, 14*24*time.Hour).Forecast(context.Background(), now, nil, 24*time.Hour)
+		require.NoError(t, err)
+		require.NotEmpty(t, prices)
+		for _, p := range prices {
+			require.NotNil(t, p.ExportDollarsPerKWH)
+			assert.InDelta(t, p.DollarsPerKWH/2, *p.ExportDollarsPerKWH, 0.0001)
+		}
+
+		// without export prices in the history there's no export forecast
+		prices, err = f.Forecast(context.Background(), now, nil, 24*time.Hour)
+		require.NoError(t, err)
+		for _, p := range prices {
+			assert.Nil(t, p.ExportDollarsPerKWH)
+		}
+	})
+
+	t.Run("No History", func(t *testing.T) {
+		empty := NewPriceForecaster(&mockPriceHistory{}, 14*24*time.Hour)
+		prices, err := empty.Forecast(context.Background(), now, nil, 24*time.Hour)
+		require.NoError(t, err)
+		assert.Empty(t, prices)
+	})
+}
@@ -18,4 +18,7 @@ type Provider interface {
 	// GetConfirmedPrices returns confirmed prices for a specific time range.
 	// This should be used for syncing historical data.
 	GetConfirmedPrices(ctx context.Context, start, end time.Time) ([]types.Price, error)
+
+	// ApplySettings updates the provider using the provided global settings.
+	ApplySettings(ctx context.Context, settings types.Settings) error
 }
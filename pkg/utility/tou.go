@@ -0,0 +1,212 @@
+package utility
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+	"github.com/levenlabs/go-lflag"
+)
+
+// touFutureHours is how far ahead TOU prices are returned. It covers the
+// longest planning horizon.
+const touFutureHours = 48
+
+// TOU implements the Provider interface for a fixed time-of-use schedule. The
+// schedule comes from a JSON file, an OpenEI URDB rate or, without either,
+// from the settings.
+type TOU struct {
+	scheduleFile string
+	urdbFile     string
+	urdbLabel    string
+	openEIURL    string
+	openEIKey    string
+	timezone     string
+	client       *http.Client
+	now          func() time.Time
+
+	mu       sync.Mutex
+	schedule *types.TOUSchedule
+	// fromFile is true if the schedule was loaded from a file or URDB and
+	// shouldn't be replaced by the settings
+	fromFile bool
+	// monthlyFixedDollars is the URDB rate's fixed charges which have to be
+	// copied to the settings' tariff since providers only return prices
+	monthlyFixedDollars float64
+	// warnedFixedDollars is the tariff's fixed charge we last warned about
+	warnedFixedDollars *float64
+}
+
+// configuredTOU sets up flags for the TOU provider and returns the instance.
+func configuredTOU() *TOU {
+	t := &TOU{
+		client: &http.Client{Timeout: 10 * time.Second},
+		now:    time.Now,
+	}
+	scheduleFile := lflag.String("tou-schedule-file", "", "Path to a JSON TOU schedule (optional, defaults to the schedule in the settings)")
+	urdbFile := lflag.String("tou-urdb-file", "", "Path to an OpenEI URDB rate JSON to use as the TOU schedule (optional, its fixed charges must be copied to the tariff in the settings)")
+	urdbLabel := lflag.String("tou-urdb-label", "", "Label of the OpenEI URDB rate to fetch and use as the TOU schedule (optional, its fixed charges must be copied to the tariff in the settings)")
+	openEIURL := lflag.String("openei-api-url", "https://api.openei.org", "URL for the OpenEI API")
+	openEIKey := lflag.String("openei-api-key", "", "API Key for the OpenEI API")
+	timezone := lflag.String("tou-timezone", "", "Timezone of the URDB rate's hours (required with tou-urdb-file or tou-urdb-label)")
+
+	lflag.Do(func() {
+		t.scheduleFile = *scheduleFile
+		t.urdbFile = *urdbFile
+		t.urdbLabel = *urdbLabel
+		t.openEIURL = *openEIURL
+		t.openEIKey = *openEIKey
+		t.timezone = *timezone
+	})
+
+	return t
+}
+
+// Validate ensures the configuration is valid and loads the schedule file or
+// URDB rate if there is one.
+func (t *TOU) Validate() error {
+	var sources int
+	for _, source := range []string{t.scheduleFile, t.urdbFile, t.urdbLabel} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return fmt.Errorf("only one of tou-schedule-file, tou-urdb-file and tou-urdb-label can be set")
+	}
+
+	var schedule types.TOUSchedule
+	switch {
+	case t.scheduleFile != "":
+		b, err := os.ReadFile(t.scheduleFile)
+		if err != nil {
+			return fmt.Errorf("failed to read tou schedule: %w", err)
+		}
+		if err := json.Unmarshal(b, &schedule); err != nil {
+			return fmt.Errorf("failed to parse tou schedule: %w", err)
+		}
+	case t.urdbFile != "" || t.urdbLabel != "":
+		if t.timezone == "" {
+			return fmt.Errorf("tou-timezone is required with tou-urdb-file and tou-urdb-label")
+		}
+		var rate URDBRate
+		var err error
+		if t.urdbFile != "" {
+			rate, err = LoadURDBFile(t.urdbFile)
+		} else {
+			rate, err = FetchURDB(context.Background(), t.client, t.openEIURL, t.openEIKey, t.urdbLabel)
+		}
+		if err != nil {
+			return err
+		}
+		schedule, err = rate.Schedule(t.timezone)
+		if err != nil {
+			return fmt.Errorf("failed to convert urdb rate: %w", err)
+		}
+		slog.Info(
+			"loaded urdb rate",
+			slog.String("name", rate.Name),
+			slog.String("utility", rate.Utility),
+			slog.Int("seasons", len(schedule.Seasons)),
+			slog.Float64("monthlyFixedDollars", rate.MonthlyFixedDollars()),
+		)
+		t.monthlyFixedDollars = rate.MonthlyFixedDollars()
+	default:
+		return nil
+	}
+	if err := schedule.Validate(); err != nil {
+		return fmt.Errorf("invalid tou schedule: %w", err)
+	}
+	t.mu.Lock()
+	t.schedule = &schedule
+	t.fromFile = true
+	t.mu.Unlock()
+	return nil
+}
+
+// ApplySettings uses the schedule in the settings unless one was loaded from
+// a file. Fixed charges aren't prices so it warns if the URDB rate's aren't in
+// the settings' tariff since they'd be missing from the costs.
+func (t *TOU) ApplySettings(ctx context.Context, settings types.Settings) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.fromFile {
+		fixed := settings.Tariff.MonthlyFixedDollars
+		if math.Abs(fixed-t.monthlyFixedDollars) >= 0.01 && (t.warnedFixedDollars == nil || *t.warnedFixedDollars != fixed) {
+			slog.WarnContext(
+				ctx,
+				"tariff monthly fixed charge doesn't match the urdb rate",
+				slog.Float64("tariffMonthlyFixedDollars", fixed),
+				slog.Float64("urdbMonthlyFixedDollars", t.monthlyFixedDollars),
+			)
+			t.warnedFixedDollars = &fixed
+		}
+		return nil
+	}
+	t.schedule = settings.TOUSchedule
+	return nil
+}
+
+// prices returns the hourly prices from the hour containing start up to end.
+func (t *TOU) prices(start, end time.Time) ([]types.Price, error) {
+	t.mu.Lock()
+	schedule := t.schedule
+	t.mu.Unlock()
+	if schedule == nil {
+		return nil, fmt.Errorf("no tou schedule")
+	}
+	loc, err := schedule.Location()
+	if err != nil {
+		return nil, fmt.Errorf("invalid tou timezone: %w", err)
+	}
+
+	var prices []types.Price
+	for ts := start.In(loc).Truncate(time.Hour); ts.Before(end); ts = ts.Add(time.Hour) {
+		rate, ok := schedule.Rate(ts)
+		if !ok {
+			return nil, fmt.Errorf("no tou rate at %s", ts.Format(time.RFC3339))
+		}
+		prices = append(prices, types.Price{
+			TSStart:             ts,
+			TSEnd:               ts.Add(time.Hour),
+			DollarsPerKWH:       rate.DollarsPerKWH,
+			ExportDollarsPerKWH: rate.ExportDollarsPerKWH,
+			Source:              types.PriceSourceDayAhead,
+		})
+	}
+	return prices, nil
+}
+
+// GetCurrentPrice returns the price for the current hour.
+func (t *TOU) GetCurrentPrice(ctx context.Context) (types.Price, error) {
+	now := t.now()
+	prices, err := t.prices(now, now.Add(time.Nanosecond))
+	if err != nil {
+		return types.Price{}, err
+	}
+	slog.DebugContext(
+		ctx,
+		"got current tou price",
+		slog.Float64("price", prices[0].DollarsPerKWH),
+		slog.Time("ts", prices[0].TSStart),
+	)
+	return prices[0], nil
+}
+
+// GetFuturePrices returns the prices for the hours after the current one.
+func (t *TOU) GetFuturePrices(ctx context.Context) ([]types.Price, error) {
+	next := t.now().Truncate(time.Hour).Add(time.Hour)
+	return t.prices(next, next.Add(touFutureHours*time.Hour))
+}
+
+// GetConfirmedPrices returns the prices for each hour between start and end.
+func (t *TOU) GetConfirmedPrices(ctx context.Context, start, end time.Time) ([]types.Price, error) {
+	return t.prices(start, end)
+}
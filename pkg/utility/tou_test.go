@@ -0,0 +1,135 @@
+package utility
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTOU(t *testing.T) {
+	export := 0.03
+	schedule := types.TOUSchedule{
+		Timezone: "America/Chicago",
+		Seasons: []types.TOUSeason{
+			{
+				Name:       "Summer",
+				StartMonth: time.June,
+				EndMonth:   time.September,
+				Periods: []types.TOUPeriod{
+					{Name: "Peak", Days: types.TOUDaysWeekday, StartHour: 14, EndHour: 19, DollarsPerKWH: 0.30},
+					{Name: "Off Peak", StartHour: 0, EndHour: 0, DollarsPerKWH: 0.10, ExportDollarsPerKWH: &export},
+				},
+			},
+			{
+				Name:       "Winter",
+				StartMonth: time.October,
+				EndMonth:   time.May,
+				Periods: []types.TOUPeriod{
+					// overnight wraps past midnight
+					{Name: "Super Off Peak", StartHour: 23, EndHour: 6, DollarsPerKWH: 0.05},
+					{Name: "Off Peak", DollarsPerKWH: 0.12},
+				},
+			},
+		},
+		Holidays: []string{"2026-07-03"},
+	}
+	require.NoError(t, schedule.Validate())
+
+	// Thursday July 2nd at 2:30pm
+	now := time.Date(2026, 7, 2, 14, 30, 0, 0, ctLocation)
+	tou := &TOU{now: func() time.Time { return now }}
+
+	t.Run("No Schedule", func(t *testing.T) {
+		require.NoError(t, tou.Validate())
+		_, err := tou.GetCurrentPrice(context.Background())
+		assert.Error(t, err)
+	})
+
+	t.Run("Settings", func(t *testing.T) {
+		require.NoError(t, tou.ApplySettings(context.Background(), types.Settings{TOUSchedule: &schedule}))
+
+		current, err := tou.GetCurrentPrice(context.Background())
+		require.NoError(t, err)
+		assert.True(t, current.TSStart.Equal(time.Date(2026, 7, 2, 14, 0, 0, 0, ctLocation)))
+		assert.True(t, current.TSEnd.Equal(time.Date(2026, 7, 2, 15, 0, 0, 0, ctLocation)))
+		assert.Equal(t, 0.30, current.DollarsPerKWH)
+		assert.Nil(t, current.ExportDollarsPerKWH)
+
+		future, err := tou.GetFuturePrices(context.Background())
+		require.NoError(t, err)
+		require.Len(t, future, touFutureHours)
+		assert.True(t, future[0].TSStart.Equal(current.TSEnd))
+		assert.Equal(t, 0.30, future[3].DollarsPerKWH, "5pm")
+		assert.Equal(t, 0.10, future[4].DollarsPerKWH, "7pm")
+		require.NotNil(t, future[4].ExportDollarsPerKWH)
+		assert.Equal(t, 0.03, *future[4].ExportDollarsPerKWH)
+		// the next day is a holiday
+		assert.Equal(t, 0.10, future[23].DollarsPerKWH, "holiday 2pm")
+
+		// the same range always returns the same prices
+		start := time.Date(2026, 12, 31, 22, 0, 0, 0, ctLocation)
+		confirmed, err := tou.GetConfirmedPrices(context.Background(), start, start.Add(3*time.Hour))
+		require.NoError(t, err)
+		require.Len(t, confirmed, 3)
+		assert.Equal(t, []float64{0.12, 0.05, 0.05}, []float64{confirmed[0].DollarsPerKWH, confirmed[1].DollarsPerKWH, confirmed[2].DollarsPerKWH})
+		again, err := tou.GetConfirmedPrices(context.Background(), start, start.Add(3*time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, confirmed, again)
+	})
+
+	t.Run("File", func(t *testing.T) {
+		fileSchedule := schedule
+		fileSchedule.Seasons = []types.TOUSeason{{StartMonth: time.January, EndMonth: time.December, Periods: []types.TOUPeriod{{DollarsPerKWH: 0.15}}}}
+		b, err := json.Marshal(fileSchedule)
+		require.NoError(t, err)
+		path := filepath.Join(t.TempDir(), "tou.json")
+		require.NoError(t, os.WriteFile(path, b, 0o600))
+
+		tou := &TOU{scheduleFile: path, now: func() time.Time { return now }}
+		require.NoError(t, tou.Validate())
+		// the file takes precedence over the settings
+		require.NoError(t, tou.ApplySettings(context.Background(), types.Settings{TOUSchedule: &schedule}))
+
+		current, err := tou.GetCurrentPrice(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 0.15, current.DollarsPerKWH)
+
+		require.NoError(t, os.WriteFile(path, []byte(`{"seasons": []}`), 0o600))
+		assert.Error(t, (&TOU{scheduleFile: path}).Validate())
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		noTimezone := schedule
+		noTimezone.Timezone = ""
+		assert.Error(t, noTimezone.Validate())
+
+		// no rates outside of the summer
+		gap := schedule
+		gap.Seasons = schedule.Seasons[:1]
+		assert.ErrorContains(t, gap.Validate(), "no rate for January weekday hour 0")
+
+		// weekends are missing in the winter
+		weekdays := schedule
+		weekdays.Seasons = []types.TOUSeason{schedule.Seasons[0], {
+			StartMonth: time.October,
+			EndMonth:   time.May,
+			Periods:    []types.TOUPeriod{{Days: types.TOUDaysWeekday, DollarsPerKWH: 0.12}},
+		}}
+		assert.ErrorContains(t, weekdays.Validate(), "no rate for January weekend hour 0")
+	})
+
+	t.Run("Missing Rate", func(t *testing.T) {
+		gap := types.TOUSchedule{Timezone: "America/Chicago", Seasons: []types.TOUSeason{{StartMonth: time.June, EndMonth: time.September, Periods: []types.TOUPeriod{{DollarsPerKWH: 0.10}}}}}
+		tou := &TOU{now: func() time.Time { return now.AddDate(0, 6, 0) }}
+		require.NoError(t, tou.ApplySettings(context.Background(), types.Settings{TOUSchedule: &gap}))
+		_, err := tou.GetCurrentPrice(context.Background())
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,210 @@
+package utility
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+)
+
+// URDBRate is a rate from the OpenEI Utility Rate Database (URDB). Only the
+// fields needed to build a TOU schedule are decoded.
+type URDBRate struct {
+	Label   string `json:"label"`
+	Name    string `json:"name"`
+	Utility string `json:"utility"`
+	// EnergyRateStructure is the tiers of each period
+	EnergyRateStructure [][]URDBTier `json:"energyratestructure"`
+	// EnergyWeekdaySchedule and EnergyWeekendSchedule are the period for
+	// each hour (24) of each month (12)
+	EnergyWeekdaySchedule [][]int `json:"energyweekdayschedule"`
+	EnergyWeekendSchedule [][]int `json:"energyweekendschedule"`
+	FixedChargeFirstMeter float64 `json:"fixedchargefirstmeter"`
+	// FixedChargeUnits is $/month or $/day
+	FixedChargeUnits string `json:"fixedchargeunits"`
+	// FixedMonthlyCharge is the deprecated fixed charge in $/month
+	FixedMonthlyCharge float64 `json:"fixedmonthlycharge"`
+}
+
+// URDBTier is a tier of a URDB energy rate period.
+type URDBTier struct {
+	Rate float64 `json:"rate"`
+	Adj  float64 `json:"adj"`
+	Unit string  `json:"unit"`
+}
+
+// ParseURDB decodes a URDB rate from either a single rate document or an API
+// response, in which case the first item is used.
+func ParseURDB(r io.Reader) (URDBRate, error) {
+	var doc struct {
+		URDBRate
+		Items []URDBRate `json:"items"`
+	}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return URDBRate{}, fmt.Errorf("failed to decode urdb rate: %w", err)
+	}
+	rate := doc.URDBRate
+	if len(doc.Items) > 0 {
+		rate = doc.Items[0]
+	}
+	if len(rate.EnergyRateStructure) == 0 {
+		return URDBRate{}, fmt.Errorf("urdb rate has no energy rate structure")
+	}
+	return rate, nil
+}
+
+// LoadURDBFile reads a URDB rate from a local JSON file.
+func LoadURDBFile(path string) (URDBRate, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return URDBRate{}, fmt.Errorf("failed to open urdb file: %w", err)
+	}
+	defer f.Close()
+	return ParseURDB(f)
+}
+
+// FetchURDB fetches the rate with the label from the OpenEI API at apiURL.
+func FetchURDB(ctx context.Context, client *http.Client, apiURL, apiKey, label string) (URDBRate, error) {
+	u, err := url.Parse(apiURL)
+	if err != nil {
+		return URDBRate{}, fmt.Errorf("failed to parse openei url: %w", err)
+	}
+	u = u.JoinPath("utility_rates")
+	q := url.Values{}
+	q.Set("version", "latest")
+	q.Set("format", "json")
+	q.Set("detail", "full")
+	q.Set("getpage", label)
+	if apiKey != "" {
+		q.Set("api_key", apiKey)
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return URDBRate{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return URDBRate{}, fmt.Errorf("failed to fetch urdb rate: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return URDBRate{}, fmt.Errorf("unexpected status code fetching urdb rate: %d", resp.StatusCode)
+	}
+	return ParseURDB(resp.Body)
+}
+
+// MonthlyFixedDollars returns the fixed charges per month.
+func (r URDBRate) MonthlyFixedDollars() float64 {
+	switch strings.ToLower(r.FixedChargeUnits) {
+	case "$/day":
+		return r.FixedChargeFirstMeter * 365 / 12
+	case "$/month", "":
+		if r.FixedChargeFirstMeter > 0 {
+			return r.FixedChargeFirstMeter
+		}
+	}
+	return r.FixedMonthlyCharge
+}
+
+// Schedule converts the rate to a TOU schedule in the timezone. Each period
+// is priced at its first tier plus adjustment since tiers depend on the
+// month's total usage. Consecutive months with the same rates are merged
+// into a season. URDB rates don't have a timezone so it is required.
+func (r URDBRate) Schedule(timezone string) (types.TOUSchedule, error) {
+	if timezone == "" {
+		return types.TOUSchedule{}, fmt.Errorf("timezone is required")
+	}
+	if len(r.EnergyWeekdaySchedule) != 12 || len(r.EnergyWeekendSchedule) != 12 {
+		return types.TOUSchedule{}, fmt.Errorf("urdb schedules must have 12 months")
+	}
+	rates := make([]float64, len(r.EnergyRateStructure))
+	for i, tiers := range r.EnergyRateStructure {
+		if len(tiers) == 0 {
+			return types.TOUSchedule{}, fmt.Errorf("urdb period %d has no tiers", i)
+		}
+		rates[i] = tiers[0].Rate + tiers[0].Adj
+	}
+
+	schedule := types.TOUSchedule{Timezone: timezone}
+	for m := range 12 {
+		month := time.Month(m + 1)
+		var periods []types.TOUPeriod
+		if slices.Equal(r.EnergyWeekdaySchedule[m], r.EnergyWeekendSchedule[m]) {
+			all, err := urdbPeriods(r.EnergyWeekdaySchedule[m], rates, types.TOUDaysAll)
+			if err != nil {
+				return types.TOUSchedule{}, fmt.Errorf("invalid schedule in %s: %w", month, err)
+			}
+			periods = all
+		} else {
+			weekday, err := urdbPeriods(r.EnergyWeekdaySchedule[m], rates, types.TOUDaysWeekday)
+			if err != nil {
+				return types.TOUSchedule{}, fmt.Errorf("invalid weekday schedule in %s: %w", month, err)
+			}
+			weekend, err := urdbPeriods(r.EnergyWeekendSchedule[m], rates, types.TOUDaysWeekend)
+			if err != nil {
+				return types.TOUSchedule{}, fmt.Errorf("invalid weekend schedule in %s: %w", month, err)
+			}
+			periods = append(weekday, weekend...)
+		}
+
+		if n := len(schedule.Seasons); n > 0 && slices.EqualFunc(schedule.Seasons[n-1].Periods, periods, touPeriodEqual) {
+			schedule.Seasons[n-1].EndMonth = month
+			continue
+		}
+		schedule.Seasons = append(schedule.Seasons, types.TOUSeason{
+			StartMonth: month,
+			EndMonth:   month,
+			Periods:    periods,
+		})
+	}
+	for i, season := range schedule.Seasons {
+		schedule.Seasons[i].Name = season.StartMonth.String()[:3]
+		if season.EndMonth != season.StartMonth {
+			schedule.Seasons[i].Name += "-" + season.EndMonth.String()[:3]
+		}
+	}
+	return schedule, schedule.Validate()
+}
+
+// urdbPeriods converts the 24 hourly period indexes of a day into TOU periods
+// for each run of hours in the same period.
+func urdbPeriods(hours []int, rates []float64, days types.TOUDays) ([]types.TOUPeriod, error) {
+	if len(hours) != 24 {
+		return nil, fmt.Errorf("expected 24 hours, got %d", len(hours))
+	}
+	var periods []types.TOUPeriod
+	for start := 0; start < 24; {
+		idx := hours[start]
+		if idx < 0 || idx >= len(rates) {
+			return nil, fmt.Errorf("unknown period %d", idx)
+		}
+		end := start + 1
+		for end < 24 && hours[end] == idx {
+			end++
+		}
+		periods = append(periods, types.TOUPeriod{
+			Name:          fmt.Sprintf("Period %d", idx),
+			Days:          days,
+			StartHour:     start,
+			EndHour:       end,
+			DollarsPerKWH: rates[idx],
+		})
+		start = end
+	}
+	return periods, nil
+}
+
+// touPeriodEqual returns true if the periods have the same hours and rates.
+func touPeriodEqual(a, b types.TOUPeriod) bool {
+	return a.Name == b.Name && a.Days == b.Days && a.StartHour == b.StartHour && a.EndHour == b.EndHour && a.DollarsPerKWH == b.DollarsPerKWH
+}
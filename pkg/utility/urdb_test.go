@@ -0,0 +1,166 @@
+package utility
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jameshartig/autoenergy/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testURDBRate returns a rate with a weekday peak from 2pm to 7pm in June
+// through September and a flat rate the rest of the year.
+func testURDBRate() URDBRate {
+	rate := URDBRate{
+		Label:   "abc123",
+		Name:    "Residential TOU",
+		Utility: "Test Electric",
+		EnergyRateStructure: [][]URDBTier{
+			{{Rate: 0.08, Adj: 0.01, Unit: "kWh"}},
+			{{Rate: 0.25, Adj: 0.01, Unit: "kWh"}, {Rate: 0.30, Unit: "kWh"}},
+			{{Rate: 0.11, Unit: "kWh"}},
+		},
+		FixedChargeFirstMeter: 0.5,
+		FixedChargeUnits:      "$/day",
+	}
+	for m := range 12 {
+		weekday := make([]int, 24)
+		weekend := make([]int, 24)
+		for h := range 24 {
+			if m >= 5 && m <= 8 {
+				if h >= 14 && h < 19 {
+					weekday[h] = 1
+				}
+			} else {
+				weekday[h] = 2
+				weekend[h] = 2
+			}
+		}
+		rate.EnergyWeekdaySchedule = append(rate.EnergyWeekdaySchedule, weekday)
+		rate.EnergyWeekendSchedule = append(rate.EnergyWeekendSchedule, weekend)
+	}
+	return rate
+}
+
+func TestURDB(t *testing.T) {
+	rate := testURDBRate()
+
+	t.Run("Parse", func(t *testing.T) {
+		b, err := json.Marshal(map[string]any{"items": []URDBRate{rate}})
+		require.NoError(t, err)
+		parsed, err := ParseURDB(strings.NewReader(string(b)))
+		require.NoError(t, err)
+		assert.Equal(t, rate, parsed)
+
+		b, err = json.Marshal(rate)
+		require.NoError(t, err)
+		parsed, err = ParseURDB(strings.NewReader(string(b)))
+		require.NoError(t, err)
+		assert.Equal(t, rate, parsed)
+
+		_, err = ParseURDB(strings.NewReader(`{"items":[{"label":"empty"}]}`))
+		assert.Error(t, err)
+	})
+
+	t.Run("Schedule", func(t *testing.T) {
+		schedule, err := rate.Schedule("America/Chicago")
+		require.NoError(t, err)
+		require.Len(t, schedule.Seasons, 3)
+
+		assert.Equal(t, "Jan-May", schedule.Seasons[0].Name)
+		assert.Equal(t, []types.TOUPeriod{
+			{Name: "Period 2", Days: types.TOUDaysAll, StartHour: 0, EndHour: 24, DollarsPerKWH: 0.11},
+		}, schedule.Seasons[0].Periods)
+
+		summer := schedule.Seasons[1]
+		assert.Equal(t, "Jun-Sep", summer.Name)
+		assert.Equal(t, time.June, summer.StartMonth)
+		assert.Equal(t, time.September, summer.EndMonth)
+		require.Len(t, summer.Periods, 4)
+		assert.Equal(t, types.TOUPeriod{Name: "Period 1", Days: types.TOUDaysWeekday, StartHour: 14, EndHour: 19, DollarsPerKWH: 0.26}, summer.Periods[1])
+		assert.Equal(t, types.TOUPeriod{Name: "Period 0", Days: types.TOUDaysWeekend, StartHour: 0, EndHour: 24, DollarsPerKWH: 0.09}, summer.Periods[3])
+
+		assert.Equal(t, "Oct-Dec", schedule.Seasons[2].Name)
+
+		_, err = rate.Schedule("")
+		assert.Error(t, err)
+
+		// Thursday July 2nd at 3pm
+		period, ok := schedule.Rate(time.Date(2026, 7, 2, 15, 0, 0, 0, ctLocation))
+		require.True(t, ok)
+		assert.Equal(t, 0.26, period.DollarsPerKWH)
+		// Saturday July 4th at 3pm
+		period, ok = schedule.Rate(time.Date(2026, 7, 4, 15, 0, 0, 0, ctLocation))
+		require.True(t, ok)
+		assert.Equal(t, 0.09, period.DollarsPerKWH)
+
+		bad := testURDBRate()
+		bad.EnergyWeekdaySchedule[0][3] = 5
+		_, err = bad.Schedule("")
+		assert.Error(t, err)
+	})
+
+	t.Run("Fixed Charges", func(t *testing.T) {
+		assert.InDelta(t, 15.21, rate.MonthlyFixedDollars(), 0.01)
+		assert.Equal(t, 12.0, URDBRate{FixedChargeFirstMeter: 12, FixedChargeUnits: "$/month"}.MonthlyFixedDollars())
+		assert.Equal(t, 10.0, URDBRate{FixedMonthlyCharge: 10}.MonthlyFixedDollars())
+	})
+
+	t.Run("Fetch", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/utility_rates", r.URL.Path)
+			assert.Equal(t, "abc123", r.URL.Query().Get("getpage"))
+			assert.Equal(t, "key", r.URL.Query().Get("api_key"))
+			assert.Equal(t, "full", r.URL.Query().Get("detail"))
+			json.NewEncoder(w).Encode(map[string]any{"items": []URDBRate{rate}})
+		}))
+		defer ts.Close()
+
+		fetched, err := FetchURDB(context.Background(), ts.Client(), ts.URL, "key", "abc123")
+		require.NoError(t, err)
+		assert.Equal(t, rate, fetched)
+
+		tou := &TOU{urdbLabel: "abc123", openEIURL: ts.URL, openEIKey: "key", timezone: "America/Chicago", client: ts.Client(), now: time.Now}
+		require.NoError(t, tou.Validate())
+		require.NotNil(t, tou.schedule)
+		assert.Len(t, tou.schedule.Seasons, 3)
+	})
+
+	t.Run("File", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "rate.json")
+		b, err := json.Marshal(rate)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path, b, 0o600))
+
+		// Thursday July 2nd at 2:30pm
+		now := time.Date(2026, 7, 2, 14, 30, 0, 0, ctLocation)
+		tou := &TOU{urdbFile: path, timezone: "America/Chicago", now: func() time.Time { return now }}
+		require.NoError(t, tou.Validate())
+
+		// the settings can't replace the rate
+		require.NoError(t, tou.ApplySettings(context.Background(), types.Settings{}))
+		current, err := tou.GetCurrentPrice(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 0.26, current.DollarsPerKWH)
+
+		// the fixed charges are missing from the tariff
+		require.NotNil(t, tou.warnedFixedDollars)
+		assert.Equal(t, 0.0, *tou.warnedFixedDollars)
+		tou.warnedFixedDollars = nil
+		require.NoError(t, tou.ApplySettings(context.Background(), types.Settings{Tariff: types.Tariff{MonthlyFixedDollars: rate.MonthlyFixedDollars()}}))
+		assert.Nil(t, tou.warnedFixedDollars)
+
+		tou = &TOU{urdbFile: path, scheduleFile: path}
+		assert.Error(t, tou.Validate())
+		tou = &TOU{urdbFile: path}
+		assert.ErrorContains(t, tou.Validate(), "tou-timezone is required")
+	})
+}
@@ -9,6 +9,7 @@ const getBatteryModeLabel = (mode: number) => {
         case BatteryMode.ChargeAny: return 'Charge From Solar+Grid';
         case BatteryMode.ChargeSolar: return 'Charge From Solar';
         case BatteryMode.Load: return 'Use Battery';
+        case BatteryMode.Export: return 'Export Battery';
         case BatteryMode.NoChange: return 'No Change';
         default: return 'Unknown';
     }
@@ -20,6 +21,7 @@ const getBatteryModeClass = (mode: number) => {
         case BatteryMode.ChargeAny: return 'charge_any';
         case BatteryMode.ChargeSolar: return 'charge_solar';
         case BatteryMode.Load: return 'load';
+        case BatteryMode.Export: return 'export';
         case BatteryMode.NoChange: return 'no_change';
         default: return 'unknown';
     }
@@ -230,6 +232,12 @@ const ActionList: React.FC = () => {
                                 <span><strong>Grid Import:</strong> {savings.gridImported.toFixed(2)} kWh</span>
                                 <span><strong>Grid Export:</strong> {savings.gridExported.toFixed(2)} kWh</span>
                                 <span><strong>Battery Use:</strong> {savings.batteryUsed.toFixed(2)} kWh</span>
+                                {savings.fixedCost > 0 && (
+                                    <span><strong>Fixed Charges:</strong> ${savings.fixedCost.toFixed(2)}</span>
+                                )}
+                                {savings.peakKWAvoided > 0 && (
+                                    <span><strong>Peak Avoided:</strong> {savings.peakKWAvoided.toFixed(2)} kW ({savings.peakGridKWWithoutBattery.toFixed(2)} &rarr; {savings.peakGridKW.toFixed(2)} kW)</span>
+                                )}
                             </div>
                         </div>
                     )}
@@ -275,6 +283,12 @@ const ActionList: React.FC = () => {
                                             {action.dryRun && (
                                                 <span className="tag dry-run">Dry Run</span>
                                             )}
+                                            {action.override && (
+                                                <span className="tag override">Manual Override</span>
+                                            )}
+                                            {action.degradedInputs && action.degradedInputs.length > 0 && (
+                                                <span className="tag degraded" title={action.degradedInputs.join(', ')}>Degraded Inputs</span>
+                                            )}
                                         </div>
                                         {action.currentPrice && (
                                             <div className="action-footer">
@@ -1,12 +1,16 @@
 import { useEffect, useState } from 'react';
-import { fetchSettings, updateSettings, type Settings as SettingsType } from './api';
+import { fetchSettings, updateSettings, type Settings as SettingsType, type SOCTarget, type Tariff, type TariffPeriod } from './api';
 import './Settings.css';
 
+const weekdays = ['Sun', 'Mon', 'Tue', 'Wed', 'Thu', 'Fri', 'Sat'];
+const months = ['Jan', 'Feb', 'Mar', 'Apr', 'May', 'Jun', 'Jul', 'Aug', 'Sep', 'Oct', 'Nov', 'Dec'];
+
 const Settings = ({ isAdmin }: { isAdmin: boolean }) => {
     const [settings, setSettings] = useState<SettingsType | null>(null);
     const [loading, setLoading] = useState(true);
     const [error, setError] = useState<string | null>(null);
     const [successMessage, setSuccessMessage] = useState<string | null>(null);
+    const [touScheduleText, setTOUScheduleText] = useState('');
 
     useEffect(() => {
         loadSettings();
@@ -17,6 +21,7 @@ const Settings = ({ isAdmin }: { isAdmin: boolean }) => {
             setLoading(true);
             const data = await fetchSettings();
             setSettings(data);
+            setTOUScheduleText(data.touSchedule ? JSON.stringify(data.touSchedule, null, 2) : '');
             setError(null);
         } catch (err) {
             setError(err instanceof Error ? err.message : 'Failed to load settings');
@@ -29,10 +34,23 @@ const Settings = ({ isAdmin }: { isAdmin: boolean }) => {
         e.preventDefault();
         if (!settings) return;
 
+        let touSchedule = null;
+        try {
+            touSchedule = touScheduleText.trim() === '' ? null : JSON.parse(touScheduleText);
+        } catch {
+            setError('TOU schedule is not valid JSON');
+            return;
+        }
+
         try {
             setError(null);
             setSuccessMessage(null);
-            await updateSettings(settings);
+            await updateSettings({
+                ...settings,
+                holidays: (settings.holidays ?? []).map((h) => h.trim()).filter((h) => h !== ''),
+                capacityPeakAlerts: (settings.capacityPeakAlerts ?? []).map((a) => a.trim()).filter((a) => a !== ''),
+                touSchedule,
+            });
             setSuccessMessage('Settings saved successfully');
             setTimeout(() => setSuccessMessage(null), 3000);
         } catch (err) {
@@ -45,6 +63,35 @@ const Settings = ({ isAdmin }: { isAdmin: boolean }) => {
         setSettings({ ...settings, [field]: value });
     };
 
+    const handleTargetChange = (index: number, target: SOCTarget) => {
+        if (!settings) return;
+        const targets = [...(settings.socTargets ?? [])];
+        targets[index] = target;
+        handleChange('socTargets', targets);
+    };
+
+    const removeTarget = (index: number) => {
+        if (!settings) return;
+        handleChange('socTargets', (settings.socTargets ?? []).filter((_, i) => i !== index));
+    };
+
+    const handleTariffChange = (field: keyof Tariff, value: any) => {
+        if (!settings) return;
+        handleChange('tariff', { ...settings.tariff, [field]: value });
+    };
+
+    const handlePeriodChange = (index: number, period: TariffPeriod) => {
+        if (!settings) return;
+        const periods = [...(settings.tariff.timeOfDay ?? [])];
+        periods[index] = period;
+        handleTariffChange('timeOfDay', periods);
+    };
+
+    const removePeriod = (index: number) => {
+        if (!settings) return;
+        handleTariffChange('timeOfDay', (settings.tariff.timeOfDay ?? []).filter((_, i) => i !== index));
+    };
+
     if (loading) return <div>Loading settings...</div>;
     if (!settings) return <div>Error loading settings</div>;
 
@@ -79,18 +126,136 @@ const Settings = ({ isAdmin }: { isAdmin: boolean }) => {
                     <span className="help-text">Stop automatic updates (prices and history will still sync)</span>
                 </div>
 
+                <div className="form-group">
+                    <label htmlFor="strategy">Strategy</label>
+                    <select
+                        id="strategy"
+                        value={settings.strategy || ''}
+                        onChange={(e) => handleChange('strategy', e.target.value)}
+                    >
+                        <option value="">Server Default</option>
+                        <option value="heuristic">Heuristic</option>
+                    </select>
+                    <span className="help-text">How the battery mode is decided. Server Default uses the --strategy flag.</span>
+                </div>
+
+                <div className="form-group">
+                    <label htmlFor="planningHorizonHours">Planning Horizon (hours)</label>
+                    <input
+                        id="planningHorizonHours"
+                        type="number"
+                        step="1"
+                        min="24"
+                        max="48"
+                        value={settings.planningHorizonHours || 24}
+                        onChange={(e) => handleChange('planningHorizonHours', parseInt(e.target.value))}
+                    />
+                    <span className="help-text">How far ahead to plan using known and forecasted prices (24-48).</span>
+                </div>
+
+                <div className="form-group">
+                    <label htmlFor="minModeDwellMinutes">Minimum Mode Dwell (minutes)</label>
+                    <input
+                        id="minModeDwellMinutes"
+                        type="number"
+                        step="1"
+                        min="0"
+                        max="1440"
+                        value={settings.minModeDwellMinutes}
+                        onChange={(e) => handleChange('minModeDwellMinutes', parseInt(e.target.value))}
+                    />
+                    <span className="help-text">How long to stay in a battery mode before switching to another one. Safety overrides still switch immediately.</span>
+                </div>
+
+                <div className="form-group">
+                    <label htmlFor="modeHysteresisDollarsPerKWH">Mode Hysteresis ($/kWh)</label>
+                    <input
+                        id="modeHysteresisDollarsPerKWH"
+                        type="number"
+                        step="0.001"
+                        min="0"
+                        value={settings.modeHysteresisDollarsPerKWH}
+                        onChange={(e) => handleChange('modeHysteresisDollarsPerKWH', parseFloat(e.target.value))}
+                    />
+                    <span className="help-text">How much a new battery mode has to save per kWh before switching away from the current mode.</span>
+                </div>
+
+                <div className="form-group">
+                    <label htmlFor="failSafeMode">Fail-Safe Mode</label>
+                    <select
+                        id="failSafeMode"
+                        value={settings.failSafeMode}
+                        onChange={(e) => handleChange('failSafeMode', e.target.value)}
+                    >
+                        <option value="">Default (Reserve)</option>
+                        <option value="reserve">Use Battery Down to Reserve</option>
+                        <option value="standby">Hold Battery</option>
+                        <option value="continue">Continue Deciding</option>
+                    </select>
+                    <span className="help-text">What to do when the status or prices are missing or stale.</span>
+                </div>
+
+                <div className="form-group">
+                    <label htmlFor="failSafeReserveSOC">Fail-Safe Reserve SOC (%)</label>
+                    <input
+                        id="failSafeReserveSOC"
+                        type="number"
+                        step="1"
+                        min="0"
+                        max="100"
+                        value={settings.failSafeReserveSOC}
+                        onChange={(e) => handleChange('failSafeReserveSOC', parseFloat(e.target.value))}
+                    />
+                    <span className="help-text">Battery SOC to keep when using the battery in the fail-safe. It's set as the battery's reserve while failing safe. 0 uses the minimum battery SOC.</span>
+                </div>
+
+                <div className="form-group">
+                    <label htmlFor="staleDataMinutes">Stale Data (minutes)</label>
+                    <input
+                        id="staleDataMinutes"
+                        type="number"
+                        step="1"
+                        min="0"
+                        value={settings.staleDataMinutes}
+                        onChange={(e) => handleChange('staleDataMinutes', parseInt(e.target.value))}
+                    />
+                    <span className="help-text">How old the status or current price can be before it's stale. 0 means 15 minutes.</span>
+                </div>
+
+                <div className="form-group">
+                    <label htmlFor="timezone">Timezone</label>
+                    <input
+                        id="timezone"
+                        type="text"
+                        placeholder="America/Chicago"
+                        value={settings.timezone ?? ''}
+                        onChange={(e) => handleChange('timezone', e.target.value.trim())}
+                    />
+                    <span className="help-text">IANA timezone of the site that recurring SOC target times and the usage model's days and hours are in. Empty means America/Chicago.</span>
+                </div>
+
                 <h3>Power History Settings</h3>
                 <div className="form-group">
-                    <label htmlFor="ignoreHourUsageOverMultiple">Ignore Usage Outlier Multiple</label>
+                    <label htmlFor="holidays">Holidays</label>
+                    <textarea
+                        id="holidays"
+                        rows={3}
+                        value={(settings.holidays ?? []).join('\n')}
+                        onChange={(e) => handleChange('holidays', e.target.value.split('\n'))}
+                    />
+                    <span className="help-text">Dates (YYYY-MM-DD), one per line, when the home uses power like a weekend.</span>
+                </div>
+                <div className="form-group">
+                    <label htmlFor="loadOutlierStdDevs">Usage Outlier Threshold (std devs)</label>
                     <input
-                        id="ignoreHourUsageOverMultiple"
+                        id="loadOutlierStdDevs"
                         type="number"
-                        step="0.1"
-                        min="1"
-                        value={settings.ignoreHourUsageOverMultiple}
-                        onChange={(e) => handleChange('ignoreHourUsageOverMultiple', parseFloat(e.target.value))}
+                        step="0.5"
+                        min="0"
+                        value={settings.loadOutlierStdDevs}
+                        onChange={(e) => handleChange('loadOutlierStdDevs', parseFloat(e.target.value))}
                     />
-                    <span className="help-text">If a single hour's usage is this many times greater than the average of other data points for that hour, ignore it. Must be &ge; 1.</span>
+                    <span className="help-text">How far from the typical usage for an hour (in robust standard deviations) before the hour is ignored, like during a party or a trip. 0 means 3.5.</span>
                 </div>
 
                 <h3>Price Settings</h3>
@@ -114,8 +279,48 @@ const Settings = ({ isAdmin }: { isAdmin: boolean }) => {
                         value={settings.additionalFeesDollarsPerKWH}
                         onChange={(e) => handleChange('additionalFeesDollarsPerKWH', parseFloat(e.target.value))}
                     />
-                    <span className="help-text">Fees added to the base price per kWh (e.g. delivery charges).</span>
+                    <span className="help-text">Other fees added to the supply price per kWh, before taxes.</span>
+                </div>
+                <div className="form-group">
+                    <label htmlFor="exportCreditType">Export Credit</label>
+                    <select
+                        id="exportCreditType"
+                        value={settings.exportCreditType || 'utility'}
+                        onChange={(e) => handleChange('exportCreditType', e.target.value)}
+                    >
+                        <option value="utility">Utility Price</option>
+                        <option value="fixed">Fixed ($/kWh)</option>
+                        <option value="percent">Percent of Price</option>
+                    </select>
+                    <span className="help-text">How exported energy is credited. Utility Price uses the utility's export price, or the import price if it has none.</span>
                 </div>
+                {settings.exportCreditType === 'fixed' && (
+                    <div className="form-group">
+                        <label htmlFor="exportCreditDollarsPerKWH">Export Credit ($/kWh)</label>
+                        <input
+                            id="exportCreditDollarsPerKWH"
+                            type="number"
+                            step="0.01"
+                            min="0"
+                            value={settings.exportCreditDollarsPerKWH}
+                            onChange={(e) => handleChange('exportCreditDollarsPerKWH', parseFloat(e.target.value))}
+                        />
+                    </div>
+                )}
+                {settings.exportCreditType === 'percent' && (
+                    <div className="form-group">
+                        <label htmlFor="exportCreditPercent">Export Credit (% of Price)</label>
+                        <input
+                            id="exportCreditPercent"
+                            type="number"
+                            step="1"
+                            min="0"
+                            max="100"
+                            value={settings.exportCreditPercent}
+                            onChange={(e) => handleChange('exportCreditPercent', parseFloat(e.target.value))}
+                        />
+                    </div>
+                )}
                 <div className="form-group">
                     <label htmlFor="minArbitrage">Min Arbitrage Difference ($/kWh)</label>
                     <input
@@ -127,6 +332,161 @@ const Settings = ({ isAdmin }: { isAdmin: boolean }) => {
                     />
                     <span className="help-text">Minimum profit required to trigger charging for arbitrage.</span>
                 </div>
+                <div className="form-group">
+                    <label htmlFor="carbonDollarsPerKG">Carbon Weight ($/kg CO2)</label>
+                    <input
+                        id="carbonDollarsPerKG"
+                        type="number"
+                        step="0.01"
+                        min="0"
+                        value={settings.carbonDollarsPerKG}
+                        onChange={(e) => handleChange('carbonDollarsPerKG', parseFloat(e.target.value))}
+                    />
+                    <span className="help-text">Cost added to grid energy for its emissions. Requires a carbon provider, 0 to ignore emissions.</span>
+                </div>
+
+                <h3>Tariff</h3>
+                <div className="form-group">
+                    <label htmlFor="deliveryCharge">Delivery ($/kWh)</label>
+                    <input
+                        id="deliveryCharge"
+                        type="number"
+                        step="0.001"
+                        min="0"
+                        value={settings.tariff.deliveryDollarsPerKWH}
+                        onChange={(e) => handleTariffChange('deliveryDollarsPerKWH', parseFloat(e.target.value))}
+                    />
+                </div>
+                <div className="form-group">
+                    <label htmlFor="transmissionCharge">Transmission ($/kWh)</label>
+                    <input
+                        id="transmissionCharge"
+                        type="number"
+                        step="0.001"
+                        min="0"
+                        value={settings.tariff.transmissionDollarsPerKWH}
+                        onChange={(e) => handleTariffChange('transmissionDollarsPerKWH', parseFloat(e.target.value))}
+                    />
+                </div>
+                <div className="form-group">
+                    <label>Time of Day Charges</label>
+                    {(settings.tariff.timeOfDay ?? []).map((period, i) => (
+                        <div key={i} className="tariff-period">
+                            <input
+                                type="text"
+                                placeholder="Name"
+                                value={period.name ?? ''}
+                                onChange={(e) => handlePeriodChange(i, { ...period, name: e.target.value })}
+                            />
+                            <input
+                                type="time"
+                                aria-label="Start"
+                                value={period.start}
+                                onChange={(e) => handlePeriodChange(i, { ...period, start: e.target.value })}
+                            />
+                            to
+                            <input
+                                type="time"
+                                aria-label="End"
+                                value={period.end}
+                                onChange={(e) => handlePeriodChange(i, { ...period, end: e.target.value })}
+                            />
+                            <input
+                                type="number"
+                                step="0.001"
+                                aria-label="Charge ($/kWh)"
+                                value={period.dollarsPerKWH}
+                                onChange={(e) => handlePeriodChange(i, { ...period, dollarsPerKWH: parseFloat(e.target.value) })}
+                            />
+                            $/kWh
+                            {weekdays.map((day, d) => (
+                                <label key={day}>
+                                    <input
+                                        type="checkbox"
+                                        checked={(period.days ?? []).includes(d)}
+                                        onChange={(e) => handlePeriodChange(i, {
+                                            ...period,
+                                            days: e.target.checked
+                                                ? [...(period.days ?? []), d].sort()
+                                                : (period.days ?? []).filter((x) => x !== d),
+                                        })}
+                                    />
+                                    {day}
+                                </label>
+                            ))}
+                            {months.map((month, m) => (
+                                <label key={month}>
+                                    <input
+                                        type="checkbox"
+                                        checked={(period.months ?? []).includes(m + 1)}
+                                        onChange={(e) => handlePeriodChange(i, {
+                                            ...period,
+                                            months: e.target.checked
+                                                ? [...(period.months ?? []), m + 1].sort((a, b) => a - b)
+                                                : (period.months ?? []).filter((x) => x !== m + 1),
+                                        })}
+                                    />
+                                    {month}
+                                </label>
+                            ))}
+                            <button type="button" onClick={() => removePeriod(i)}>Remove</button>
+                        </div>
+                    ))}
+                    <button
+                        type="button"
+                        onClick={() => handleTariffChange('timeOfDay', [...(settings.tariff.timeOfDay ?? []), { start: '13:00', end: '19:00', dollarsPerKWH: 0 }])}
+                    >
+                        Add Period
+                    </button>
+                    <span className="help-text">Per kWh charges during part of the day. An end before the start wraps past midnight. No days or months checked means every one.</span>
+                </div>
+                <div className="form-group">
+                    <label htmlFor="taxPercent">Taxes (%)</label>
+                    <input
+                        id="taxPercent"
+                        type="number"
+                        step="0.1"
+                        min="0"
+                        value={settings.tariff.taxPercent}
+                        onChange={(e) => handleTariffChange('taxPercent', parseFloat(e.target.value))}
+                    />
+                    <span className="help-text">Taxes as a percent of the per kWh charges.</span>
+                </div>
+                <div className="form-group">
+                    <label htmlFor="monthlyFixed">Monthly Fixed Charges ($)</label>
+                    <input
+                        id="monthlyFixed"
+                        type="number"
+                        step="0.01"
+                        min="0"
+                        value={settings.tariff.monthlyFixedDollars}
+                        onChange={(e) => handleTariffChange('monthlyFixedDollars', parseFloat(e.target.value))}
+                    />
+                    <span className="help-text">Customer and meter charges. Only used to report costs.</span>
+                </div>
+                <div className="form-group">
+                    <label htmlFor="peakLoadContribution">Peak Load Contribution (kW)</label>
+                    <input
+                        id="peakLoadContribution"
+                        type="number"
+                        step="0.01"
+                        min="0"
+                        value={settings.tariff.peakLoadContributionKW}
+                        onChange={(e) => handleTariffChange('peakLoadContributionKW', parseFloat(e.target.value))}
+                    />
+                    <span className="help-text">Capacity obligation on the bill, charged at the Capacity Charge each year. Only used to report costs.</span>
+                </div>
+
+                <div className="form-group">
+                    <label htmlFor="touSchedule">TOU Schedule (JSON)</label>
+                    <textarea
+                        id="touSchedule"
+                        rows={6}
+                        value={touScheduleText}
+                        onChange={(e) => setTOUScheduleText(e.target.value)}
+                    />
+                    <span className="help-text">Timezone, seasons, weekday/weekend hour ranges and holidays used by the tou utility provider without a schedule file. Every hour must have a rate. Leave empty for other providers.</span>
+                </div>
 
                 <h3>Battery Settings</h3>
                 <div className="form-group">
@@ -142,8 +502,230 @@ const Settings = ({ isAdmin }: { isAdmin: boolean }) => {
                     />
                     <span className="help-text">Minimum State of Charge to maintain.</span>
                 </div>
+                <div className="form-group">
+                    <label htmlFor="batteryRoundTripEfficiency">Round Trip Efficiency (%)</label>
+                    <input
+                        id="batteryRoundTripEfficiency"
+                        type="number"
+                        step="1"
+                        min="0"
+                        max="100"
+                        value={settings.batteryRoundTripEfficiency}
+                        onChange={(e) => handleChange('batteryRoundTripEfficiency', parseFloat(e.target.value))}
+                    />
+                    <span className="help-text">Percentage of charged energy that can be discharged. 0 treats the battery as lossless.</span>
+                </div>
+                <div className="form-group">
+                    <label htmlFor="batteryDegradation">Degradation Cost ($/kWh)</label>
+                    <input
+                        id="batteryDegradation"
+                        type="number"
+                        step="0.01"
+                        min="0"
+                        value={settings.batteryDegradationDollarsPerKWH}
+                        onChange={(e) => handleChange('batteryDegradationDollarsPerKWH', parseFloat(e.target.value))}
+                    />
+                    <span className="help-text">Battery wear cost for each kWh discharged.</span>
+                </div>
+                <div className="form-group">
+                    <label htmlFor="maxBatteryCyclesPerDay">Max Cycles Per Day</label>
+                    <input
+                        id="maxBatteryCyclesPerDay"
+                        type="number"
+                        step="0.1"
+                        min="0"
+                        value={settings.maxBatteryCyclesPerDay}
+                        onChange={(e) => handleChange('maxBatteryCyclesPerDay', parseFloat(e.target.value))}
+                    />
+                    <span className="help-text">Maximum equivalent full cycles per day. 0 means no limit.</span>
+                </div>
+
+                <div className="form-group">
+                    <label>SOC Targets</label>
+                    {(settings.socTargets ?? []).map((target, i) => (
+                        <div key={i} className="soc-target">
+                            <input
+                                type="text"
+                                placeholder="Name"
+                                value={target.name ?? ''}
+                                onChange={(e) => handleTargetChange(i, { ...target, name: e.target.value })}
+                            />
+                            <input
+                                type="number"
+                                step="1"
+                                min="1"
+                                max="100"
+                                aria-label="Target SOC"
+                                value={target.soc}
+                                onChange={(e) => handleTargetChange(i, { ...target, soc: parseFloat(e.target.value) })}
+                            />
+                            % by
+                            <input
+                                type="time"
+                                aria-label="Time"
+                                value={target.time ?? ''}
+                                onChange={(e) => handleTargetChange(i, { ...target, time: e.target.value })}
+                            />
+                            {weekdays.map((day, d) => (
+                                <label key={day}>
+                                    <input
+                                        type="checkbox"
+                                        checked={(target.days ?? []).includes(d)}
+                                        onChange={(e) => handleTargetChange(i, {
+                                            ...target,
+                                            days: e.target.checked
+                                                ? [...(target.days ?? []), d].sort()
+                                                : (target.days ?? []).filter((x) => x !== d),
+                                        })}
+                                    />
+                                    {day}
+                                </label>
+                            ))}
+                            <button type="button" onClick={() => removeTarget(i)}>Remove</button>
+                        </div>
+                    ))}
+                    <button
+                        type="button"
+                        onClick={() => handleChange('socTargets', [...(settings.socTargets ?? []), { soc: 90, time: '16:00' }])}
+                    >
+                        Add Target
+                    </button>
+                    <span className="help-text">Charge to a SOC by a time of day, using the cheapest hours before it. No days checked means every day.</span>
+                </div>
+
+                <h3>Solar Settings</h3>
+                <div className="form-group">
+                    <label htmlFor="solarLatitude">Latitude</label>
+                    <input
+                        id="solarLatitude"
+                        type="number"
+                        step="0.0001"
+                        value={settings.solarLatitude}
+                        onChange={(e) => handleChange('solarLatitude', parseFloat(e.target.value))}
+                    />
+                    <span className="help-text">Location of the solar array.</span>
+                </div>
+                <div className="form-group">
+                    <label htmlFor="solarLongitude">Longitude</label>
+                    <input
+                        id="solarLongitude"
+                        type="number"
+                        step="0.0001"
+                        value={settings.solarLongitude}
+                        onChange={(e) => handleChange('solarLongitude', parseFloat(e.target.value))}
+                    />
+                    <span className="help-text">Location of the solar array.</span>
+                </div>
+                <div className="form-group">
+                    <label htmlFor="solarKWP">Array Size (kW)</label>
+                    <input
+                        id="solarKWP"
+                        type="number"
+                        step="0.1"
+                        min="0"
+                        value={settings.solarKWP}
+                        onChange={(e) => handleChange('solarKWP', parseFloat(e.target.value))}
+                    />
+                    <span className="help-text">Peak power of the solar array. 0 disables the clear-sky solar model and Forecast.Solar.</span>
+                </div>
+                <div className="form-group">
+                    <label htmlFor="solarTiltDegrees">Tilt (°)</label>
+                    <input
+                        id="solarTiltDegrees"
+                        type="number"
+                        step="1"
+                        min="0"
+                        max="90"
+                        value={settings.solarTiltDegrees}
+                        onChange={(e) => handleChange('solarTiltDegrees', parseFloat(e.target.value))}
+                    />
+                    <span className="help-text">Tilt of the array from horizontal.</span>
+                </div>
+                <div className="form-group">
+                    <label htmlFor="solarAzimuthDegrees">Azimuth (°)</label>
+                    <input
+                        id="solarAzimuthDegrees"
+                        type="number"
+                        step="1"
+                        min="0"
+                        max="360"
+                        value={settings.solarAzimuthDegrees}
+                        onChange={(e) => handleChange('solarAzimuthDegrees', parseFloat(e.target.value))}
+                    />
+                    <span className="help-text">Compass direction the array faces (180 is south).</span>
+                </div>
 
                 <h3>Grid Settings</h3>
+                <div className="form-group">
+                    <label htmlFor="maxGridUseKW">Max Grid Use (kW)</label>
+                    <input
+                        id="maxGridUseKW"
+                        type="number"
+                        step="0.1"
+                        min="0"
+                        value={settings.maxGridUseKW}
+                        onChange={(e) => handleChange('maxGridUseKW', parseFloat(e.target.value))}
+                    />
+                    <span className="help-text">Use the battery to keep grid use under this limit and cap grid charging to stay under it. 0 means no limit.</span>
+                </div>
+                <div className="form-group">
+                    <label htmlFor="demandCharge">Demand Charge ($/kW)</label>
+                    <input
+                        id="demandCharge"
+                        type="number"
+                        step="0.01"
+                        min="0"
+                        value={settings.demandChargeDollarsPerKW}
+                        onChange={(e) => handleChange('demandChargeDollarsPerKW', parseFloat(e.target.value))}
+                    />
+                    <span className="help-text">Charge for the highest grid use in each billing period.</span>
+                </div>
+                <div className="form-group">
+                    <label htmlFor="capacityCharge">Capacity Charge ($/kW per year)</label>
+                    <input
+                        id="capacityCharge"
+                        type="number"
+                        step="0.01"
+                        min="0"
+                        value={settings.capacityChargeDollarsPerKW}
+                        onChange={(e) => handleChange('capacityChargeDollarsPerKW', parseFloat(e.target.value))}
+                    />
+                    <span className="help-text">Charge for each kW of peak load contribution set during PJM's summer peaks. If set, the battery is kept full for and used during predicted peaks.</span>
+                </div>
+                <div className="form-group">
+                    <label htmlFor="capacityPeakLoad">Capacity Peak Load (MW)</label>
+                    <input
+                        id="capacityPeakLoad"
+                        type="number"
+                        step="1000"
+                        min="0"
+                        value={settings.capacityPeakLoadMW}
+                        onChange={(e) => handleChange('capacityPeakLoadMW', parseFloat(e.target.value))}
+                    />
+                    <span className="help-text">Summer weekday afternoons with a forecasted PJM load at or above this are predicted to be peaks. 0 disables.</span>
+                </div>
+                <div className="form-group">
+                    <label htmlFor="capacityPeakPrice">Capacity Peak Price ($/kWh)</label>
+                    <input
+                        id="capacityPeakPrice"
+                        type="number"
+                        step="0.01"
+                        min="0"
+                        value={settings.capacityPeakPriceDollarsPerKWH}
+                        onChange={(e) => handleChange('capacityPeakPriceDollarsPerKWH', parseFloat(e.target.value))}
+                    />
+                    <span className="help-text">Summer weekday afternoons with a day-ahead price at or above this are predicted to be peaks. 0 disables.</span>
+                </div>
+                <div className="form-group">
+                    <label htmlFor="capacityPeakAlerts">Capacity Peak Alerts</label>
+                    <textarea
+                        id="capacityPeakAlerts"
+                        rows={3}
+                        value={(settings.capacityPeakAlerts ?? []).join('\n')}
+                        onChange={(e) => handleChange('capacityPeakAlerts', e.target.value.split('\n'))}
+                    />
+                    <span className="help-text">Dates (YYYY-MM-DD), one per line, with a peak alert. Their afternoons are always treated as peaks.</span>
+                </div>
                 <div className="form-group checkbox-group">
                     <label>
                         <input
@@ -166,6 +748,17 @@ const Settings = ({ isAdmin }: { isAdmin: boolean }) => {
                     </label>
                     <span className="help-text">Allow exporting solar generation to the grid.</span>
                 </div>
+                <div className="form-group checkbox-group">
+                    <label>
+                        <input
+                            type="checkbox"
+                            checked={settings.gridExportBatteries}
+                            onChange={(e) => handleChange('gridExportBatteries', e.target.checked)}
+                        />
+                        Grid Export Batteries
+                    </label>
+                    <span className="help-text">Allow discharging batteries to the grid when prices are high.</span>
+                </div>
 
                 <button type="submit" className="save-button" disabled={!isAdmin}>
                     {isAdmin ? 'Save Settings' : 'Read Only'}
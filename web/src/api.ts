@@ -7,9 +7,21 @@ export interface Action {
         tsStart: string;
         tsEnd: string;
         dollarsPerKWH: number;
+        gCO2PerKWH?: number;
     };
     systemStatus?: any;
     dryRun?: boolean;
+    override?: Override;
+    degradedInputs?: string[];
+}
+
+export interface Override {
+    batteryMode: number;
+    targetSOC?: number;
+    expires: string;
+    reason?: string;
+    createdBy?: string;
+    createdAt: string;
 }
 
 export const BatteryMode = {
@@ -18,6 +30,7 @@ export const BatteryMode = {
     ChargeAny: 2,
     ChargeSolar: 3,
     Load: -1,
+    Export: -2,
 } as const;
 
 export type BatteryMode = typeof BatteryMode[keyof typeof BatteryMode];
@@ -43,16 +56,23 @@ export const fetchActions = async (start: Date, end: Date): Promise<Action[]|nul
 export interface SavingsStats {
     timestamp: string;
     cost: number;
+    fixedCost: number;
     credit: number;
     batterySavings: number;
     solarSavings: number;
     avoidedCost: number;
     chargingCost: number;
+    degradationCost: number;
+    efficiencyLossCost: number;
     solarGenerated: number;
     gridImported: number;
     gridExported: number;
     homeUsed: number;
     batteryUsed: number;
+    peakGridKW: number;
+    peakGridKWWithoutBattery: number;
+    peakKWAvoided: number;
+    demandChargeAvoided: number;
 }
 
 export const fetchSavings = async (start: Date, end: Date): Promise<SavingsStats|null> => {
@@ -70,11 +90,86 @@ export interface Settings {
     pause: boolean;
     alwaysChargeUnderDollarsPerKWH: number;
     additionalFeesDollarsPerKWH: number;
+    tariff: Tariff;
+    touSchedule: TOUSchedule | null;
+    exportCreditType: '' | 'utility' | 'fixed' | 'percent';
+    exportCreditDollarsPerKWH: number;
+    exportCreditPercent: number;
     minArbitrageDifferenceDollarsPerKWH: number;
+    carbonDollarsPerKG: number;
     minBatterySOC: number;
-    ignoreHourUsageOverMultiple: number;
+    batteryRoundTripEfficiency: number;
+    batteryDegradationDollarsPerKWH: number;
+    maxBatteryCyclesPerDay: number;
+    socTargets: SOCTarget[] | null;
+    strategy: string;
+    planningHorizonHours: number;
+    minModeDwellMinutes: number;
+    modeHysteresisDollarsPerKWH: number;
+    failSafeMode: '' | 'reserve' | 'standby' | 'continue';
+    failSafeReserveSOC: number;
+    staleDataMinutes: number;
+    timezone: string;
+    holidays: string[] | null;
+    loadOutlierStdDevs: number;
+    solarLatitude: number;
+    solarLongitude: number;
+    solarKWP: number;
+    solarTiltDegrees: number;
+    solarAzimuthDegrees: number;
+    maxGridUseKW: number;
+    demandChargeDollarsPerKW: number;
+    capacityChargeDollarsPerKW: number;
+    capacityPeakLoadMW: number;
+    capacityPeakPriceDollarsPerKWH: number;
+    capacityPeakAlerts: string[] | null;
     gridChargeBatteries: boolean;
     gridExportSolar: boolean;
+    gridExportBatteries: boolean;
+}
+
+export interface Tariff {
+    deliveryDollarsPerKWH: number;
+    transmissionDollarsPerKWH: number;
+    timeOfDay: TariffPeriod[] | null;
+    taxPercent: number;
+    monthlyFixedDollars: number;
+    peakLoadContributionKW: number;
+}
+
+export interface TariffPeriod {
+    name?: string;
+    start: string;
+    end: string;
+    days?: number[];
+    months?: number[];
+    dollarsPerKWH: number;
+}
+
+export interface TOUSchedule {
+    timezone: string;
+    seasons: {
+        name?: string;
+        startMonth: number;
+        endMonth: number;
+        periods: {
+            name?: string;
+            days?: '' | 'all' | 'weekday' | 'weekend';
+            startHour: number;
+            endHour: number;
+            dollarsPerKWH: number;
+            exportDollarsPerKWH?: number;
+        }[];
+    }[];
+    holidays?: string[];
+}
+
+export interface SOCTarget {
+    name?: string;
+    soc: number;
+    deadline?: string;
+    time?: string;
+    days?: number[];
 }
 
 export const fetchSettings = async (): Promise<Settings> => {